@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Give the col an external name (ie an API field name) used by
+// RecordValue FieldMap and MarshalJSON in place of the column name
+func (c *col) As(alias string) *col {
+	c.alias = alias
+	return c
+}
+
+// the external name of the col
+func (c *col) field() string {
+	if c.alias != "" {
+		return c.alias
+	}
+	return c.name
+}
+
+// Set the external name of the column name. Aliases are also read from
+// column comments containing "alias: name" when the Relation is loaded
+func (r *Relation) SetAlias(name, alias string) error {
+	c := r.col(name)
+	if c == nil {
+		return fmt.Errorf("No column %s", name)
+	}
+	for _, other := range r.cols {
+		if other != c && alias != "" && (other.name == alias || other.alias == alias) {
+			return fmt.Errorf("alias %s for %s clashes with column %s", alias, name, other.name)
+		}
+	}
+	c.alias = alias
+	return nil
+}
+
+// Like Map but keyed by each column's alias (if any)
+func (k *pgRecord) FieldMap() map[string]Value {
+	m := make(map[string]Value)
+	for i, v := range k.vs {
+		m[k.cs[i].field()] = v
+	}
+	return m
+}
+
+// Encode the record as a json object keyed by each column's
+// alias (if any) in column order. NULLs are encoded as null
+func (k *pgRecord) MarshalJSON() ([]byte, error) {
+	b := bytes.NewBufferString("{")
+	for i, v := range k.vs {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(k.cs[i].field())
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		var val []byte
+		switch x := v.(type) {
+		case json.Marshaler:
+			val, err = x.MarshalJSON()
+		default:
+			val, err = json.Marshal(v.Val())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode column %s: %v", k.cs[i].name, err)
+		}
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
@@ -3,8 +3,21 @@ package postgres
 import (
 	"bytes"
 	"database/sql/driver"
+	"fmt"
+	"strconv"
 )
 
+// An array Value that knows the shape of its (possibly nested) elements
+type ArrayValue interface {
+	IteratorValue
+	// the length of each dimension (nil for an empty array)
+	Dims() []int
+	// the length of dimension dim (counted from 1 like array_length)
+	Len(dim int) int
+	// the lower bound of dimension dim (1 unless set with [n:m]= syntax)
+	Lower(dim int) int
+}
+
 func Array(el ToValue) ToValue {
 	return func(data interface{}) (v Value, err error) {
 		k := new(pgArray)
@@ -16,12 +29,14 @@ func Array(el ToValue) ToValue {
 type pgArray struct {
 	vs    []Value
 	el    ToValue
+	lower []int // lower bound of each dim if not all 1
 	valid bool
 }
 
 func (k *pgArray) Scan(src interface{}) (err error) {
 	// reset
 	k.vs = make([]Value, 0)
+	k.lower = nil
 	// check null
 	if src == nil {
 		k.valid = false
@@ -32,7 +47,11 @@ func (k *pgArray) Scan(src interface{}) (err error) {
 	switch x := src.(type) {
 	case []interface{}:
 		for _, d := range x {
-			err = k.Append(d)
+			if _, ok := d.([]interface{}); ok {
+				err = k.appendSub(d)
+			} else {
+				err = k.Append(d)
+			}
 			if err != nil {
 				return err
 			}
@@ -45,22 +64,85 @@ func (k *pgArray) Scan(src interface{}) (err error) {
 		if err != nil {
 			return err
 		}
+		// strip any [lower:upper]= decoration
+		b, err = k.scanBounds(b)
+		if err != nil {
+			return err
+		}
 		// split on ','
 		parts, err := split(b)
 		if err != nil {
 			return err
 		}
+		// an element that is itself {…} (rather than "{…}") means
+		// a multi-dimensional array so every element is a sub-array
+		inner := bytes.TrimLeft(b[1:], " ")
+		sub := len(inner) > 0 && inner[0] == '{'
 		// add vals
 		for _, part := range parts {
-			err = k.Append(part)
+			switch {
+			case part == nil:
+				err = k.Append(nil)
+			case sub:
+				err = k.appendSub(part)
+			default:
+				err = k.Append(part)
+			}
 			if err != nil {
 				return err
 			}
 		}
+		if k.lower != nil && len(k.lower) != len(k.Dims()) {
+			return fmt.Errorf("cannot set ARRAY value: bounds do not match dimensions: %s", src)
+		}
 	}
 	return
 }
 
+// parse leading [l:u][l:u]= bounds into k.lower and return the rest
+func (k *pgArray) scanBounds(b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != '[' {
+		return b, nil
+	}
+	eq := bytes.IndexByte(b, '=')
+	if eq < 0 {
+		return nil, fmt.Errorf("cannot set ARRAY value: missing '=' after bounds: %s", b)
+	}
+	bounds := bytes.TrimSpace(b[:eq])
+	for len(bounds) > 0 {
+		end := bytes.IndexByte(bounds, ']')
+		colon := bytes.IndexByte(bounds, ':')
+		if bounds[0] != '[' || end < 0 || colon < 0 || colon > end {
+			return nil, fmt.Errorf("cannot set ARRAY value: invalid bounds: %s", b[:eq])
+		}
+		lower, err := strconv.Atoi(string(bounds[1:colon]))
+		if err != nil {
+			return nil, fmt.Errorf("cannot set ARRAY value: invalid bounds: %s", b[:eq])
+		}
+		k.lower = append(k.lower, lower)
+		bounds = bounds[end+1:]
+	}
+	return bytes.TrimSpace(b[eq+1:]), nil
+}
+
+// add a sub-array for multi-dimensional arrays. If el is not
+// already an Array kind the sub-array shares this array's el
+func (k *pgArray) appendSub(src interface{}) error {
+	vx, err := k.el(nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := vx.(*pgArray); ok {
+		return k.Append(src)
+	}
+	sub := &pgArray{el: k.el}
+	err = sub.Scan(src)
+	if err != nil {
+		return err
+	}
+	return k.Append(sub)
+}
+
 func (k *pgArray) IsNull() bool {
 	return !k.valid
 }
@@ -76,16 +158,35 @@ func (k *pgArray) bytes() ([]byte, error) {
 	if !k.valid {
 		return nullBytes, nil
 	}
+	err := k.checkDims()
+	if err != nil {
+		return nil, err
+	}
 	b := bytes.NewBufferString("")
+	if k.lower != nil {
+		dims := k.Dims()
+		for i, lower := range k.lower {
+			fmt.Fprintf(b, "[%d:%d]", lower, lower+dims[i]-1)
+		}
+		b.WriteString("=")
+	}
 	b.WriteString("{")
 	last := len(k.vs) - 1
 	for i, child := range k.vs {
+		// NULL must not be quoted ("NULL" would be read as text)
+		if child.IsNull() {
+			b.Write(nullBytes)
+			if i != last {
+				b.WriteString(",")
+			}
+			continue
+		}
 		cb, err := child.bytes()
 		if err != nil {
 			return nil, err
 		}
 		switch child.(type) {
-		case *pgNumeric, *pgInteger, *pgFloat, *pgBool, *pgArray, *pgTimestamp:
+		case *pgNumeric, *pgInteger, *pgFloat, *pgBool, *pgArray, *pgTimestamp, *pgTimestampTZ, *pgDate:
 			b.Write(cb)
 		default:
 			b.WriteString(`"`)
@@ -100,6 +201,73 @@ func (k *pgArray) bytes() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// multi-dimensional arrays must be rectangular
+func (k *pgArray) checkDims() error {
+	if len(k.vs) == 0 {
+		return nil
+	}
+	first, nested := k.vs[0].(*pgArray)
+	var want []int
+	if nested {
+		want = first.Dims()
+	}
+	for _, v := range k.vs {
+		sub, ok := v.(*pgArray)
+		if ok != nested {
+			return fmt.Errorf("cannot mix sub-arrays and elements in ARRAY value")
+		}
+		if !nested {
+			continue
+		}
+		if sub.IsNull() || !equalInts(sub.Dims(), want) {
+			return fmt.Errorf("multidimensional arrays must have sub-arrays with matching dimensions")
+		}
+		err := sub.checkDims()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *pgArray) Dims() []int {
+	if !k.valid || len(k.vs) == 0 {
+		return nil
+	}
+	dims := []int{len(k.vs)}
+	if sub, ok := k.vs[0].(*pgArray); ok {
+		dims = append(dims, sub.Dims()...)
+	}
+	return dims
+}
+
+func (k *pgArray) Len(dim int) int {
+	dims := k.Dims()
+	if dim < 1 || dim > len(dims) {
+		return 0
+	}
+	return dims[dim-1]
+}
+
+func (k *pgArray) Lower(dim int) int {
+	if dim < 1 || dim > len(k.lower) {
+		return 1
+	}
+	return k.lower[dim-1]
+}
+
 func (k *pgArray) String() string {
 	if !k.valid {
 		return ""
@@ -119,6 +287,13 @@ func (k *pgArray) Val() interface{} {
 	return vals
 }
 
+func (k *pgArray) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
 func (k *pgArray) Values() []Value {
 	return k.vs
 }
@@ -77,3 +77,10 @@ func (k *pgBool) Val() interface{} {
 	}
 	return k.b
 }
+
+func (k *pgBool) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
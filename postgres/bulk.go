@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UPDATE every row matching the Query setting the columns in set.
+// Returns the number of rows updated
+func (q *Query) Update(set map[string]interface{}) (int64, error) {
+	err := q.checkWrite()
+	if err != nil {
+		return 0, err
+	}
+	if len(set) == 0 {
+		return 0, errors.New("Update requires at least one column to set")
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sets := make([]string, len(names))
+	params := make([]interface{}, len(names))
+	for i, name := range names {
+		c := q.from.col(name)
+		if c == nil {
+			return 0, fmt.Errorf("could not Update %s unknown column name", name)
+		}
+		params[i] = set[name]
+		if _, ok := params[i].(Value); !ok && params[i] != nil {
+			params[i], err = c.k(set[name])
+			if err != nil {
+				return 0, err
+			}
+		}
+		sets[i] = fmt.Sprintf("%s = $%d", name, i+1)
+	}
+	s := fmt.Sprintf(`UPDATE %s SET %s %s`,
+		q.from.Name,
+		strings.Join(sets, ","),
+		q.whereExprFrom(len(params)))
+	return q.write(s, append(params, q.selectArgs()...)...)
+}
+
+// DELETE every row matching the Query.
+// Returns the number of rows deleted
+func (q *Query) Delete() (int64, error) {
+	err := q.checkWrite()
+	if err != nil {
+		return 0, err
+	}
+	s := fmt.Sprintf(`DELETE FROM %s %s`, q.from.Name, q.whereExpr())
+	return q.write(s, q.selectArgs()...)
+}
+
+// run an UPDATE/DELETE returning the pks of affected rows
+// so they can be removed from the relation's cache
+func (q *Query) write(s string, params ...interface{}) (int64, error) {
+	pk := q.from.pk()
+	ret := "1"
+	if pk != nil {
+		ret = pk.name
+	}
+	rs, err := q.rows(fmt.Sprintf(`%s RETURNING %s`, s, ret), params...)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Close()
+	var n int64
+	var keys []Value
+	for rs.Next() {
+		n++
+		if pk == nil {
+			continue
+		}
+		v, err := pk.k(nil)
+		if err != nil {
+			return 0, err
+		}
+		err = rs.Scan(v)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, v)
+	}
+	err = rs.Err()
+	if err != nil {
+		return 0, err
+	}
+	err = rs.Close()
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		err = invalidateWritten(q.tx, q.from, k)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
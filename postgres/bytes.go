@@ -61,3 +61,10 @@ func (k *pgBytea) Val() interface{} {
 	}
 	return k.b
 }
+
+func (k *pgBytea) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
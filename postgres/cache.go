@@ -0,0 +1,385 @@
+package postgres
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// RecordCache stores RecordValues by primary key for a Relation.
+// Implementations must be safe for concurrent use. Anything that
+// can hold a RecordValue (or rebuild one via Relation.New) can be
+// used, ie an in-memory LRU or a client for a shared store like redis
+type RecordCache interface {
+	Get(key string) (RecordValue, bool)
+	Set(key string, v RecordValue)
+	Delete(key string)
+}
+
+// Set the cache used by Query.Get for this relation
+// pass nil to disable caching. Should be set before the
+// Relation is shared between goroutines
+func (r *Relation) SetCache(c RecordCache) {
+	r.cache = c
+}
+
+// Remove the record with primary key pk from the relation's cache (if any)
+func (r *Relation) Invalidate(pk interface{}) error {
+	if r.cache == nil {
+		return nil
+	}
+	key, err := r.cacheKey(pk)
+	if err != nil {
+		return err
+	}
+	r.cache.Delete(key)
+	return nil
+}
+
+// invalidate the cached record written with ex (after the
+// Tx commits as well if ex is a Tx)
+func invalidateWritten(ex interface{}, r *Relation, pk interface{}) error {
+	if tx, ok := ex.(*Tx); ok {
+		return tx.invalidate(r, pk)
+	}
+	return r.Invalidate(pk)
+}
+
+// Invalidate cached records for each primary key received on ch.
+// Intended to be fed from a LISTEN/NOTIFY listener where a trigger sends
+// the pk as the notification payload. Returns when ch is closed
+func (r *Relation) InvalidateFrom(ch <-chan string) {
+	for pk := range ch {
+		r.Invalidate(pk)
+	}
+}
+
+// normalize pk via the pk column Value so that 1, int64(1) and "1"
+// all produce the same key
+func (r *Relation) cacheKey(pk interface{}) (string, error) {
+	c := r.pk()
+	if c == nil {
+		return "", fmt.Errorf("No primary key found for relation %s", r.Name)
+	}
+	if v, ok := pk.(Value); ok {
+		return v.String(), nil
+	}
+	v, err := c.k(pk)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// fetch a copy of a cached record
+func (r *Relation) cached(pk interface{}) RecordValue {
+	key, err := r.cacheKey(pk)
+	if err != nil {
+		return nil
+	}
+	v, ok := r.cache.Get(key)
+	if !ok {
+		return nil
+	}
+	// hand out a copy so callers can't mutate the cached record
+	return v.Clone().(RecordValue)
+}
+
+// store a copy of v in the cache
+func (r *Relation) cacheRecord(v RecordValue) {
+	c := r.pk()
+	if c == nil {
+		return
+	}
+	pkv := v.ValueBy(c.name)
+	if pkv == nil || pkv.IsNull() {
+		return
+	}
+	r.cache.Set(pkv.String(), v.Clone().(RecordValue))
+}
+
+// NewLRUCache returns an in-memory RecordCache holding
+// at most size records, evicting the least recently used
+func NewLRUCache(size int) RecordCache {
+	if size < 1 {
+		panic("LRU cache size must be at least 1")
+	}
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+type lruEntry struct {
+	key string
+	v   RecordValue
+}
+
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func (c *lruCache) Get(key string) (RecordValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).v, true
+}
+
+func (c *lruCache) Set(key string, v RecordValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).v = v
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key, v})
+	if c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// CacheStore is a byte oriented cache with expiry. It is the extension
+// point for sharing cached results between instances (memcached, redis etc).
+// A ttl of zero means the entry does not expire.
+type CacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, b []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+func init() {
+	// concrete types that can appear in Val() results
+	gob.Register([]interface{}{})
+	gob.Register(map[string]string{})
+	gob.Register(time.Time{})
+	gob.Register(time.Duration(0))
+	gob.Register(net.IP{})
+	gob.Register(&net.IPNet{})
+	gob.Register(net.HardwareAddr{})
+}
+
+// a record as put in a CacheStore
+type cachedRecord struct {
+	Val      interface{}
+	Unloaded []string               // columns not fetched (see IsPartial)
+	Extra    map[string]interface{} // values of SelectExpr expressions
+}
+
+// encode the Val() of each record (along with the columns it was
+// fetched without and its extras) so it can be put in a CacheStore
+func encodeRecords(vs []RecordValue) ([]byte, error) {
+	crs := make([]cachedRecord, len(vs))
+	for i, v := range vs {
+		crs[i].Val = v.Val()
+		if k, ok := v.(*pgRecord); ok {
+			for name := range k.unloaded {
+				crs[i].Unloaded = append(crs[i].Unloaded, name)
+			}
+			crs[i].Extra = k.extra
+		}
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(crs)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rebuild records for rel from the output of encodeRecords
+func decodeRecords(rel *Relation, b []byte) ([]RecordValue, error) {
+	var crs []cachedRecord
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&crs)
+	if err != nil {
+		return nil, err
+	}
+	vs := make([]RecordValue, len(crs))
+	for i, cr := range crs {
+		vs[i], err = rel.New(cr.Val)
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := vs[i].(*pgRecord); ok && len(cr.Unloaded) > 0 {
+			k.unloaded = make(map[string]bool, len(cr.Unloaded))
+			for _, name := range cr.Unloaded {
+				k.unloaded[name] = true
+			}
+		}
+		for name, val := range cr.Extra {
+			setExtra(vs[i], name, val)
+		}
+	}
+	return vs, nil
+}
+
+// Return a new Query whose Fetch results are read from and
+// written to store for ttl. Results are keyed by CacheKey(). The
+// store is not used when the query runs in a transaction, as it may
+// hold rows the transaction can't see (or has since changed)
+func (q *Query) Cache(store CacheStore, ttl time.Duration) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.cache = store
+	q2.ttl = ttl
+	return q2
+}
+
+// A key identifying the results of this query. The key is stable
+// across processes so can be used to share (or Delete) entries in
+// a distributed CacheStore
+func (q *Query) CacheKey() string {
+	if q.err != nil {
+		return ""
+	}
+	h := sha1.New()
+	io.WriteString(h, q.selectSql())
+	for _, arg := range q.selectArgs() {
+		if v, ok := arg.(driver.Valuer); ok {
+			dv, err := v.Value()
+			if err == nil {
+				arg = dv
+			}
+		}
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+	return fmt.Sprintf("%s:%x", q.from.Name, h.Sum(nil))
+}
+
+// Fetch via the query's CacheStore
+func (q *Query) cachedQuery() ([]RecordValue, error) {
+	key := q.CacheKey()
+	b, ok, err := q.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return decodeRecords(q.from, b)
+	}
+	vs, err := q.query(q.selectSql(), q.selectArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	b, err = encodeRecords(vs)
+	if err != nil {
+		return nil, err
+	}
+	return vs, q.cache.Set(key, b, q.ttl)
+}
+
+// StoreCache adapts a CacheStore into a RecordCache for rel
+// so Get-by-pk caching can use a shared store
+func StoreCache(rel *Relation, store CacheStore, ttl time.Duration) RecordCache {
+	return &storeCache{rel, store, ttl}
+}
+
+type storeCache struct {
+	rel   *Relation
+	store CacheStore
+	ttl   time.Duration
+}
+
+func (c *storeCache) key(key string) string {
+	return fmt.Sprintf("%s#%s", c.rel.Name, key)
+}
+
+func (c *storeCache) Get(key string) (RecordValue, bool) {
+	b, ok, err := c.store.Get(c.key(key))
+	if err != nil || !ok {
+		return nil, false
+	}
+	vs, err := decodeRecords(c.rel, b)
+	if err != nil || len(vs) != 1 {
+		return nil, false
+	}
+	return vs[0], true
+}
+
+func (c *storeCache) Set(key string, v RecordValue) {
+	b, err := encodeRecords([]RecordValue{v})
+	if err != nil {
+		return
+	}
+	c.store.Set(c.key(key), b, c.ttl)
+}
+
+func (c *storeCache) Delete(key string) {
+	c.store.Delete(c.key(key))
+}
+
+// NewMemoryStore returns a CacheStore backed by a map.
+// Useful for tests or single instance deployments
+func NewMemoryStore() CacheStore {
+	return &memoryStore{m: make(map[string]memoryEntry)}
+}
+
+type memoryEntry struct {
+	b       []byte
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu sync.Mutex
+	m  map[string]memoryEntry
+}
+
+func (s *memoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(s.m, key)
+		return nil, false, nil
+	}
+	return e.b, true, nil
+}
+
+func (s *memoryStore) Set(key string, b []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := memoryEntry{b: b}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	s.m[key] = e
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
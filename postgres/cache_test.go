@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	k := Record(Col("id", Int), Col("name", Text))
+	c := NewLRUCache(2)
+	for i, name := range []string{"a", "b", "c"} {
+		v, err := k([]interface{}{i, name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Set(name, v.(RecordValue))
+		if name == "b" {
+			// touch a so that b is the least recently used
+			if _, ok := c.Get("a"); !ok {
+				t.Fatal("expected a to be cached")
+			}
+		}
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to have been evicted")
+	}
+	v, ok := c.Get("c")
+	if !ok {
+		t.Fatal("expected c to be cached")
+	}
+	if v.Get("name").(string) != "c" {
+		t.Errorf("unexpected cached record: %v", v)
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a to have been deleted")
+	}
+}
+
+func TestEncodeRecords(t *testing.T) {
+	cols := []*col{
+		Col("id", BigInt),
+		Col("name", Text),
+		Col("at", Timestamp),
+		Col("data", Bytes),
+		Col("tags", Array(Text)),
+	}
+	rel := &Relation{Name: "thing", k: Record(cols...), cols: cols}
+	v, err := rel.New([]interface{}{1, "bob", "2011-01-01", []byte("xyz"), []interface{}{"a", nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encodeRecords([]RecordValue{v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := decodeRecords(rel, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 {
+		t.Fatalf("expected 1 record got: %d", len(vs))
+	}
+	if vs[0].String() != v.String() {
+		t.Errorf("expected %s got: %s", v.String(), vs[0].String())
+	}
+	if vs[0].Relation() != rel {
+		t.Errorf("expected decoded record to belong to relation")
+	}
+	setPartial(v, []string{"id", "name"})
+	setExtra(v, "n", int64(2))
+	b, err = encodeRecords([]RecordValue{v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err = decodeRecords(rel, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vs[0].IsPartial() || vs[0].Loaded("data") || !vs[0].Loaded("name") || vs[0].Extra("n") != int64(2) {
+		t.Errorf("expected the partial and extra state to be restored")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	err := s.Set("a", []byte("x"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Set("b", []byte("y"), time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if b, ok, _ := s.Get("a"); !ok || string(b) != "x" {
+		t.Errorf("expected a => x got: %v", string(b))
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Errorf("expected b to have expired")
+	}
+}
+
+func TestTxInvalidate(t *testing.T) {
+	rel := NewRelation("thing", Col("id", BigInt, PrimaryKey()), Col("name", Text))
+	rel.SetCache(NewLRUCache(2))
+	v, err := rel.New([]interface{}{1, "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel.cacheRecord(v)
+	tx := &Tx{}
+	err = tx.invalidate(rel, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.cached(1) != nil {
+		t.Errorf("expected the write to invalidate the record")
+	}
+	// a Get before the commit caches the old row
+	rel.cacheRecord(v)
+	for _, fn := range tx.onCommit {
+		fn()
+	}
+	if rel.cached(1) != nil {
+		t.Errorf("expected the commit to invalidate the record again")
+	}
+}
+
+func TestCachedCopy(t *testing.T) {
+	rel := NewRelation("thing", Col("id", BigInt, PrimaryKey()), Col("name", Text))
+	rel.SetCache(NewLRUCache(2))
+	v, err := rel.New([]interface{}{1, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPartial(v, []string{"id"})
+	setExtra(v, "n", int64(2))
+	rel.cacheRecord(v)
+	c := rel.cached(1)
+	if c == nil || !c.IsPartial() || c.Loaded("name") || c.Extra("n") != int64(2) {
+		t.Errorf("expected the cached copy to keep the partial and extra state got: %v", c)
+	}
+	if c == v {
+		t.Errorf("expected a copy of the cached record")
+	}
+	q := &Query{from: rel}
+	if !q.plainLookup() {
+		t.Errorf("expected an unfiltered query to use the cache")
+	}
+	for _, q := range []*Query{q.Select("name"), q.SelectExpr("1 AS n"), q.ForUpdate()} {
+		if q.plainLookup() {
+			t.Errorf("expected a query with %v %v %q not to use the cache", q.cols, q.exprs, q.lock)
+		}
+	}
+}
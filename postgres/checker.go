@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+// CheckNamedValue converts a Value argument to its driver.Value exactly
+// once and returns driver.ErrSkip for anything else so the driver's own
+// conversion applies. Drivers or driver wrappers (ie otelsql, sqlhooks)
+// that implement driver.NamedValueChecker can delegate to it so Values
+// are not converted twice or passed through as opaque types
+func CheckNamedValue(nv *driver.NamedValue) error {
+	v, ok := nv.Value.(Value)
+	if !ok {
+		return driver.ErrSkip
+	}
+	// a typed nil Value is NULL rather than a panic
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		nv.Value = nil
+		return nil
+	}
+	dv, err := v.Value()
+	if err != nil {
+		return fmt.Errorf("cannot convert argument %d: %v", nv.Ordinal, err)
+	}
+	if !driver.IsValue(dv) {
+		return fmt.Errorf("cannot convert argument %d: %T is not a driver.Value", nv.Ordinal, dv)
+	}
+	nv.Value = dv
+	return nil
+}
+
+// NamedValueChecker can be embedded in a driver.Conn or driver.Stmt
+// (or a wrapper of one) to make it a driver.NamedValueChecker using
+// CheckNamedValue
+type NamedValueChecker struct{}
+
+func (NamedValueChecker) CheckNamedValue(nv *driver.NamedValue) error {
+	return CheckNamedValue(nv)
+}
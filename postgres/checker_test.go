@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// a driver that records the args it is given
+type fakeDriver struct {
+	args  []driver.NamedValue
+	rows  int           // rows returned by each query (default 1)
+	delay time.Duration // delay before each row
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+type fakeConn struct {
+	NamedValueChecker
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.args = args
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.args = args
+	n := c.d.rows
+	if n == 0 {
+		n = 1
+	}
+	return &fakeRows{n: n, delay: c.d.delay, ctx: ctx}, nil
+}
+
+// driver rows with n rows of a single "1" column
+type fakeRows struct {
+	n     int
+	delay time.Duration
+	ctx   context.Context
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"x"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+	}
+	r.n--
+	dest[0] = int64(1)
+	return nil
+}
+
+// wraps a driver the way tracing/hook libraries do: delegating
+// CheckNamedValue to the wrapped conn
+type wrapDriver struct {
+	driver.Driver
+}
+
+func (w wrapDriver) Open(name string) (driver.Conn, error) {
+	c, err := w.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return wrapConn{c.(*fakeConn)}, nil
+}
+
+type wrapConn struct {
+	*fakeConn
+}
+
+func (w wrapConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return w.fakeConn.CheckNamedValue(nv)
+}
+
+var fakeDrv = &fakeDriver{}
+
+func init() {
+	sql.Register("pql_fake", fakeDrv)
+	sql.Register("pql_fake_wrapped", wrapDriver{fakeDrv})
+}
+
+func TestNamedValueChecker(t *testing.T) {
+	var nilText *pgText
+	for _, name := range []string{"pql_fake", "pql_fake_wrapped"} {
+		db, err := sql.Open(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec("x",
+			MustInteger(1),
+			Must(Array(Text)([]interface{}{"a", "b"})),
+			MustText(nil),
+			nilText,
+			"plain",
+		)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		args := fakeDrv.args
+		if n, ok := args[0].Value.(int64); !ok || n != 1 {
+			t.Errorf("%s: expected int64 got: %#v", name, args[0].Value)
+		}
+		if b, ok := args[1].Value.([]byte); !ok || string(b) != `{"a","b"}` {
+			t.Errorf("%s: expected array to be encoded once got: %#v", name, args[1].Value)
+		}
+		if args[2].Value != nil || args[3].Value != nil {
+			t.Errorf("%s: expected NULLs to be nil got: %#v %#v", name, args[2].Value, args[3].Value)
+		}
+		if args[4].Value != "plain" {
+			t.Errorf("%s: expected non Values to be left to the driver got: %#v", name, args[4].Value)
+		}
+		_, err = db.Exec("x", &pgDomain{v: MustText(nil), name: "email"})
+		if err == nil {
+			t.Errorf("%s: expected error from Value to be returned", name)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"reflect"
+	"time"
+)
+
+// convert "civil" date/time structs (like cloud.google.com/go/civil's
+// Date and DateTime) to a UTC time.Time. Accepts structs with integer
+// Year, Month and Day fields (and optionally Hour, Minute, Second and
+// Nanosecond) or with Date and Time struct fields
+func civilTime(src interface{}) (time.Time, bool) {
+	rv := reflect.ValueOf(src)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return time.Time{}, false
+	}
+	d, t := rv.FieldByName("Date"), rv.FieldByName("Time")
+	if d.IsValid() && t.IsValid() && d.Kind() == reflect.Struct && t.Kind() == reflect.Struct {
+		day, ok := civilTime(d.Interface())
+		if !ok {
+			return time.Time{}, false
+		}
+		var parts [4]int
+		if !civilFields(t, []string{"Hour", "Minute", "Second", "Nanosecond"}, parts[:]) {
+			return time.Time{}, false
+		}
+		return day.Add(time.Duration(parts[0])*time.Hour +
+			time.Duration(parts[1])*time.Minute +
+			time.Duration(parts[2])*time.Second +
+			time.Duration(parts[3])), true
+	}
+	var ymd [3]int
+	if !civilFields(rv, []string{"Year", "Month", "Day"}, ymd[:]) {
+		return time.Time{}, false
+	}
+	var hms [4]int
+	civilFields(rv, []string{"Hour", "Minute", "Second", "Nanosecond"}, hms[:])
+	return time.Date(ymd[0], time.Month(ymd[1]), ymd[2], hms[0], hms[1], hms[2], hms[3], time.UTC), true
+}
+
+// read the integer fields names of rv into dst. false if any are missing
+func civilFields(rv reflect.Value, names []string, dst []int) bool {
+	for i, name := range names {
+		f := rv.FieldByName(name)
+		if !f.IsValid() {
+			return false
+		}
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst[i] = int(f.Int())
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package postgres
+
+import "net"
+
+// deep copy each of vs
+func cloneValues(vs []Value) []Value {
+	if vs == nil {
+		return nil
+	}
+	cp := make([]Value, len(vs))
+	for i, v := range vs {
+		cp[i] = v.Clone()
+	}
+	return cp
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (k *pgArray) Clone() Value {
+	c := *k
+	c.vs = cloneValues(k.vs)
+	c.lower = append([]int(nil), k.lower...)
+	return &c
+}
+
+func (k *pgBool) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgBytea) Clone() Value {
+	c := *k
+	c.b = cloneBytes(k.b)
+	return &c
+}
+
+func (k *pgDomain) Clone() Value {
+	c := *k
+	c.v = k.v.Clone()
+	return &c
+}
+
+func (k *pgEnum) Clone() Value {
+	// labels are never modified so can be shared
+	c := *k
+	return &c
+}
+
+func (k *pgFloat) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgHStore) Clone() Value {
+	c := *k
+	if k.m != nil {
+		c.m = make(map[string]Value, len(k.m))
+		for key, v := range k.m {
+			c.m[key] = v.Clone()
+		}
+	}
+	return &c
+}
+
+func (k *pgInteger) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgInterval) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgJSON) Clone() Value {
+	c := *k
+	c.b = cloneBytes(k.b)
+	// decode again rather than share the document
+	c.doc, c.ok = nil, false
+	return &c
+}
+
+func (k *pgLTree) Clone() Value {
+	c := *k
+	c.labels = append([]string(nil), k.labels...)
+	return &c
+}
+
+func (k *pgMacAddr) Clone() Value {
+	c := *k
+	c.addr = net.HardwareAddr(cloneBytes(k.addr))
+	return &c
+}
+
+func (k *pgMultirange) Clone() Value {
+	c := *k
+	c.vs = cloneValues(k.vs)
+	return &c
+}
+
+func (k *pgInet) Clone() Value {
+	c := *k
+	c.ip = net.IP(cloneBytes(k.ip))
+	c.mask = net.IPMask(cloneBytes(k.mask))
+	return &c
+}
+
+func (k *pgNumeric) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgRange) Clone() Value {
+	c := *k
+	if k.lower != nil {
+		c.lower = k.lower.Clone()
+	}
+	if k.upper != nil {
+		c.upper = k.upper.Clone()
+	}
+	return &c
+}
+
+// the clone shares the cols and Relation of k
+func (k *pgRecord) Clone() Value {
+	c := *k
+	c.vs = cloneValues(k.vs)
+	if k.unloaded != nil {
+		c.unloaded = make(map[string]bool, len(k.unloaded))
+		for name := range k.unloaded {
+			c.unloaded[name] = true
+		}
+	}
+	if k.defaulted != nil {
+		c.defaulted = make(map[string]bool, len(k.defaulted))
+		for name := range k.defaulted {
+			c.defaulted[name] = true
+		}
+	}
+	if k.extra != nil {
+		c.extra = make(map[string]interface{}, len(k.extra))
+		for name, val := range k.extra {
+			c.extra[name] = val
+		}
+	}
+	if k.related != nil {
+		c.related = make(map[string][]RecordValue, len(k.related))
+		for name, vs := range k.related {
+			rs := make([]RecordValue, len(vs))
+			for i, v := range vs {
+				rs[i] = v.Clone().(RecordValue)
+			}
+			c.related[name] = rs
+		}
+	}
+	return &c
+}
+
+func (k *pgReg) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgRow) Clone() Value {
+	c := *k
+	c.vs = cloneValues(k.vs)
+	return &c
+}
+
+func (k *pgText) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgTimestamp) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgTimestampTZ) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgDate) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgTSVector) Clone() Value {
+	c := *k
+	if k.ls != nil {
+		c.ls = make([]Lexeme, len(k.ls))
+		for i, l := range k.ls {
+			l.Positions = append([]int(nil), l.Positions...)
+			l.Weights = cloneBytes(l.Weights)
+			c.ls[i] = l
+		}
+	}
+	return &c
+}
+
+func (k *pgTSQuery) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgLSN) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgXID) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgSnapshot) Clone() Value {
+	c := *k
+	c.xip = append([]uint64(nil), k.xip...)
+	return &c
+}
+
+func (k *pgUint) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgUUID) Clone() Value {
+	c := *k
+	return &c
+}
+
+func (k *pgXML) Clone() Value {
+	c := *k
+	c.b = cloneBytes(k.b)
+	return &c
+}
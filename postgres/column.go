@@ -5,22 +5,72 @@ import (
 	"strings"
 )
 
-func Col(name string, k ToValue) *col {
+func Col(name string, k ToValue, opts ...ColOption) *col {
 	c := new(col)
 	c.k = k
 	c.name = name
+	for _, opt := range opts {
+		opt(c)
+	}
 	return c
 }
 
+// ColOption sets the metadata of a hand-built column that would
+// otherwise be introspected from the database, ie:
+//
+//	Col("id", BigInt, PrimaryKey())
+type ColOption func(c *col)
+
+// mark the column NOT NULL
+func NotNull() ColOption {
+	return func(c *col) {
+		c.notNull = true
+	}
+}
+
+// mark the column as (part of) the primary key
+func PrimaryKey() ColOption {
+	return func(c *col) {
+		c.pk = true
+		c.notNull = true
+	}
+}
+
+// set the default value of the column. Relation.New(nil) fills it in and
+// Insert leaves the column to the database default when it is NULL.
+// Panics if v is not a valid value for the column
+func Default(v interface{}) ColOption {
+	return func(c *col) {
+		dv, err := c.k(v)
+		if err != nil {
+			panic(fmt.Sprintf("invalid default for column %s: %v", c.name, err))
+		}
+		c.def = "'" + strings.Replace(dv.String(), "'", "''", -1) + "'"
+		c.defv = dv
+	}
+}
+
+// mark the column as a foreign key to the named field of table
+func References(table, field string) ColOption {
+	return func(c *col) {
+		c.refT = table
+		c.refF = field
+	}
+}
+
 type col struct {
-	k       ToValue // the Value kind
-	typ     string  // the pg_type name for casting
-	oid     uint32  // the pg_type oid (if available)
-	name    string  // name of this col
-	refT    string  // name of referenced relation (if any)
-	refF    string  // name of field in referenced relation (if any)
-	pk      bool    // is col a primary key
-	notNull bool    // is col marked as notNull
+	k         ToValue // the Value kind
+	typ       string  // the pg_type name for casting
+	oid       uint32  // the pg_type oid (if available)
+	name      string  // name of this col
+	refT      string  // name of referenced relation (if any)
+	refF      string  // name of field in referenced relation (if any)
+	pk        bool    // is col (part of) the primary key
+	notNull   bool    // is col marked as notNull
+	generated bool    // is col GENERATED (so never written)
+	alias     string  // external name for FieldMap/MarshalJSON (if any)
+	def       string  // DEFAULT expression (if any)
+	defv      Value   // value of def if it is a literal (or nil)
 }
 
 type refKind uint
@@ -41,14 +91,30 @@ type ref struct {
 // Relation holds column and reference info about a relation.
 // Usually inferred from the database. See Relation methods on DB
 type Relation struct {
-	Name string
-	k    ToValue
-	cols []*col
-	refs []*ref
+	Name  string
+	db    *DB    // the DB this relation was loaded from (if any)
+	oid   uint32 // pg_class oid (if loaded from the db)
+	k     ToValue
+	cols  []*col
+	refs  []*ref
+	cache RecordCache // optional Get-by-pk cache
+	// columns re-read after Insert/Update (nil means all)
+	refreshInsert *RefreshPolicy
+	refreshUpdate *RefreshPolicy
+	identity      Identity   // how Update/Delete find rows
+	uniques       [][]string // cols of each unique index (nil if unknown)
+}
+
+// Return a Relation for hand-built columns so its records can be
+// used with Insert, Update, Upsert and Delete without introspection
+func NewRelation(name string, cols ...*col) *Relation {
+	return &Relation{Name: name, k: Record(cols...), cols: cols}
 }
 
 // return a new RecordValue that represents a row
-// from this relation
+// from this relation. New(nil) fills in the columns
+// that have literal defaults and leaves those with a
+// default expression out of an Insert until they are Set
 func (r *Relation) New(data interface{}) (RecordValue, error) {
 	v, err := r.k(data)
 	if err != nil {
@@ -56,6 +122,9 @@ func (r *Relation) New(data interface{}) (RecordValue, error) {
 	}
 	k := v.(RecordValue)
 	k.SetRelation(r)
+	if data == nil {
+		r.setDefaults(k)
+	}
 	return k, nil
 }
 
@@ -65,82 +134,127 @@ func (r *Relation) fields(pk bool) string {
 	if r.cols == nil {
 		panic("Cols not defined?")
 	}
-	n := len(r.cols)
-	if !pk {
-		n--
-	}
-	cols := make([]string, n)
-	i := 0
+	cols := make([]string, 0, len(r.cols))
 	for _, c := range r.cols {
 		if c.pk && !pk {
 			continue
 		}
-		cols[i] = c.name
-		i++
+		cols = append(cols, c.name)
 	}
 	return strings.Join(cols, ",")
 }
 
-func (r *Relation) bindings(pk bool, set bool) (string, int) {
-	n := len(r.cols)
-	if !pk {
-		n--
+// return the primary key column or nil if there
+// is no primary key or it spans multiple columns
+func (r *Relation) pk() *col {
+	pks := r.pks()
+	if len(pks) != 1 {
+		return nil
 	}
-	ss := make([]string, n)
-	i := 0
+	return pks[0]
+}
+
+// return all the primary key columns
+func (r *Relation) pks() []*col {
+	pks := make([]*col, 0, 1)
 	for _, c := range r.cols {
-		if c.pk && !pk {
-			continue
-		}
-		bnd := fmt.Sprintf("$%d", i+1)
-		if c.typ != "" {
-			bnd = fmt.Sprintf("cast(%s as %s)\n", bnd, c.typ)
-		}
-		if set {
-			bnd = fmt.Sprintf("%s = %s", c.name, bnd)
+		if c.pk {
+			pks = append(pks, c)
 		}
-		ss[i] = bnd
-		i++
 	}
-	return strings.Join(ss, ","), i
+	return pks
 }
 
-func (r *Relation) pk() *col {
-	if r.cols == nil {
-		return nil
-	}
+// find a column by name (or nil)
+func (r *Relation) col(name string) *col {
 	for _, c := range r.cols {
-		if c.pk {
+		if c.name == name {
 			return c
 		}
 	}
 	return nil
 }
 
-func (r *Relation) valArgs(v RecordValue, update bool) []interface{} {
-	n := len(r.cols)
-	if !update {
-		n--
+// reports whether a set of column names is known to identify at most one
+// row, ie contains all the columns of a unique index. If no index info
+// was loaded (the relation was not loaded from the db) assume it does
+func (r *Relation) isUnique(names []string) bool {
+	if r.uniques == nil {
+		return true
 	}
-	infs := make([]interface{}, n)
-	i := 0
-	var pk *col
-	for _, c := range r.cols {
-		if c.pk {
-			pk = c
-			continue
+	for _, idx := range r.uniques {
+		covered := true
+		for _, c := range idx {
+			found := false
+			for _, name := range names {
+				if name == c {
+					found = true
+					break
+				}
+			}
+			if !found {
+				covered = false
+				break
+			}
 		}
-		infs[i] = v.ValueBy(c.name)
-		i++
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether names are exactly the columns of a unique index, as
+// ON CONFLICT (names) requires. Assumed true if no index info was loaded
+func (r *Relation) hasUniqueIndex(names []string) bool {
+	if r.uniques == nil {
+		return true
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
 	}
-	if update {
-		infs[i] = v.ValueBy(pk.name)
-		i++
+	for _, idx := range r.uniques {
+		match := len(idx) == len(set)
+		for _, c := range idx {
+			match = match && set[c]
+		}
+		if match {
+			return true
+		}
 	}
-	return infs
+	return false
 }
 
 // return list of column data in the order postgres expects them
 func (r *Relation) Cols() []*col {
 	return r.cols
 }
+
+// reports whether the relation has no rows
+func (r *Relation) IsEmpty() (bool, error) {
+	if r.db == nil {
+		return false, fmt.Errorf("relation %s was not loaded from a DB", r.Name)
+	}
+	var empty bool
+	err := r.db.scanRow([]interface{}{&empty}, fmt.Sprintf(`SELECT NOT EXISTS (SELECT 1 FROM %s LIMIT 1)`, r.Name))
+	return empty, err
+}
+
+// return the planner's estimate of the number of rows (pg_class.reltuples)
+// which is cheap but only as fresh as the last ANALYZE. Falls back to an
+// exact count if the relation has never been analyzed
+func (r *Relation) ApproxCount() (int64, error) {
+	if r.db == nil {
+		return 0, fmt.Errorf("relation %s was not loaded from a DB", r.Name)
+	}
+	var n int64
+	err := r.db.scanRow([]interface{}{&n}, `SELECT reltuples::bigint FROM pg_class WHERE oid = $1`, r.oid)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		err = r.db.scanRow([]interface{}{&n}, fmt.Sprintf(`SELECT count(*) FROM %s`, r.Name))
+	}
+	return n, err
+}
@@ -31,8 +31,20 @@ func escape(s []byte, t int) []byte {
 	return s
 }
 
+// IntRangeError is returned when an integer does not fit into the
+// size of the integer Value. Unsigned values that are too big for a
+// BIGINT can be stored in a NUMERIC(20,0) column or an OIDUint Value
+type IntRangeError struct {
+	Val     interface{}
+	BitSize int
+}
+
+func (e *IntRangeError) Error() string {
+	return fmt.Sprintf("Cannot fit %v into int%d", e.Val, e.BitSize)
+}
+
 // converts n to int64
-// returns error if n does not fit into the int bitsize
+// returns an *IntRangeError if n does not fit into the int bitsize
 func fitInt(v interface{}, bitSize int) (r int64, err error) {
 	// convert to int64
 	switch n := v.(type) {
@@ -53,34 +65,32 @@ func fitInt(v interface{}, bitSize int) (r int64, err error) {
 	case uint32:
 		r = int64(n)
 	case uint:
-		if n < math.MaxInt64 {
-			r = int64(n)
-		} else {
-			return 0, fmt.Errorf("Cannot fit %v into int%d", n, bitSize)
+		if uint64(n) > math.MaxInt64 {
+			return 0, &IntRangeError{v, bitSize}
 		}
+		r = int64(n)
 	case uint64:
-		if n < math.MaxInt64 {
-			r = int64(n)
-		} else {
-			return 0, fmt.Errorf("Cannot fit %v into int%d", n, bitSize)
+		if n > math.MaxInt64 {
+			return 0, &IntRangeError{v, bitSize}
 		}
+		r = int64(n)
 	}
 	// check fits
 	ok := false
 	switch bitSize {
 	case 8:
-		ok = r < math.MaxInt8
+		ok = r >= math.MinInt8 && r <= math.MaxInt8
 	case 16: // INT2
-		ok = r < math.MaxInt16
+		ok = r >= math.MinInt16 && r <= math.MaxInt16
 	case 32: // INT4
-		ok = r < math.MaxInt32
+		ok = r >= math.MinInt32 && r <= math.MaxInt32
 	case 64: // INT8
 		ok = true
 	default:
 		return 0, fmt.Errorf("invalid bitSize %d", bitSize)
 	}
 	if !ok {
-		return 0, fmt.Errorf("Cannot fit %v into int%d", r, bitSize)
+		return 0, &IntRangeError{v, bitSize}
 	}
 	return r, nil
 }
@@ -98,11 +108,14 @@ func srcToBytes(src interface{}) (b []byte, err error) {
 }
 
 // take a byte representation of an array or row and return
-// each element unescaped
+// each element unescaped. NULL elements (empty row fields or
+// unquoted NULL array elements) are returned as nil
 // will also decode any hex bytea fields (although not sure if that should be done here really)
 func split(s []byte) ([][]byte, error) {
 	parts := make([][]byte, 0)
 	ignore := false
+	seen := false   // a value has started since the last row separator
+	commas := false // a row separator has been seen
 	dep := 0
 	var mode byte // }=array )=record
 	var closer byte
@@ -123,6 +136,17 @@ func split(s []byte) ([][]byte, error) {
 		// if not inside value
 		case a == -1:
 			switch {
+			// an empty row field is NULL
+			case mode == ')' && b == ',':
+				if !seen {
+					parts = append(parts, nil)
+				}
+				seen = false
+				commas = true
+			case mode == ')' && b == ')' && i == len(s)-1:
+				if commas && !seen {
+					parts = append(parts, nil)
+				}
 			// skip whitespace
 			case b == ' ' || b == ',':
 			// consume whitespace or commas
@@ -131,14 +155,17 @@ func split(s []byte) ([][]byte, error) {
 				a = i
 				dep++
 				closer = '}'
+				seen = true
 			// mark val wrapped in "
 			case b == '"':
 				a = i + 1
 				closer = '"'
+				seen = true
 			// anything else mark
 			default:
 				a = i
 				closer = ','
+				seen = true
 			}
 		// EOF
 		case i == len(s)-1:
@@ -175,11 +202,22 @@ func split(s []byte) ([][]byte, error) {
 			// mark end of simple , val
 			case closer == ',' && b == closer:
 				z = i - 1
+				// the comma also separates this row field from the next
+				if mode == ')' {
+					seen = false
+					commas = true
+				}
 			}
 		}
 		// check for end
 		if z != -1 {
 			part := s[a : z+1]
+			// an unquoted NULL array element
+			if mode == '}' && closer == ',' && string(part) == "NULL" {
+				parts = append(parts, nil)
+				a, z, dep = -1, -1, 0
+				continue
+			}
 			// unescape
 			part = bytes.Replace(part, []byte(`\\`), []byte(`\`), -1)
 			if mode == '}' {
@@ -191,6 +229,10 @@ func split(s []byte) ([][]byte, error) {
 			if len(part) >= 2 && part[0] == '\\' && part[1] == 'x' {
 				part, _ = hex.DecodeString(string(part[2:]))
 			}
+			// keep empty values distinct from NULL
+			if part == nil {
+				part = []byte{}
+			}
 			parts = append(parts, part)
 			a = -1
 			z = -1
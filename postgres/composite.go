@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the composite type a RecordValue param is cast to (if known)
+func (k *pgRecord) typeName() string {
+	if k.rel != nil {
+		return k.rel.Name
+	}
+	return k.typ
+}
+
+// like Record but the Values know their composite type name so
+// they can be cast when used as params
+func compositeRecord(name string, cols ...*col) ToValue {
+	k := Record(cols...)
+	return func(data interface{}) (Value, error) {
+		v, err := k(data)
+		if r, ok := v.(*pgRecord); ok {
+			r.typ = name
+		}
+		return v, err
+	}
+}
+
+// regexp to match $X placeholders and any cast that follows them
+var castPlacePat = regexp.MustCompile(`\$(\d+)(::)?`)
+
+// add a ::typename cast to the placeholders of params that are
+// RecordValues of a known composite type (or Relation) so they can
+// be used for composite columns and function arguments without
+// postgres having to guess their type. Placeholders that are already
+// cast are left alone
+func castComposites(q string, vals []interface{}) string {
+	var names map[int]string
+	for i, v := range vals {
+		r, ok := v.(*pgRecord)
+		if !ok || r.typeName() == "" {
+			continue
+		}
+		if names == nil {
+			names = make(map[int]string)
+		}
+		names[i+1] = r.typeName()
+	}
+	if names == nil {
+		return q
+	}
+	return castPlacePat.ReplaceAllStringFunc(q, func(m string) string {
+		if strings.HasSuffix(m, "::") {
+			return m
+		}
+		n, _ := strconv.Atoi(m[1:])
+		if name, ok := names[n]; ok {
+			return m + "::" + name
+		}
+		return m
+	})
+}
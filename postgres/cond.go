@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"strings"
+)
+
+// Condition is a tree of WHERE expressions joined by AND and OR, ie:
+//
+//	q.WhereCond(Or(Cond("status = $1", "open"), Cond("owner = $1", 7)))
+//
+// Like Where each expression numbers its own placeholders from $1
+type Condition struct {
+	op     string // "AND" or "OR" (empty for a single expression)
+	expr   string
+	params []interface{}
+	conds  []*Condition
+}
+
+// a single expression (see Query.Where)
+func Cond(w string, params ...interface{}) *Condition {
+	return &Condition{expr: w, params: params}
+}
+
+// a Condition true if all of conds are
+func And(conds ...*Condition) *Condition {
+	return &Condition{op: "AND", conds: conds}
+}
+
+// a Condition true if any of conds are
+func Or(conds ...*Condition) *Condition {
+	return &Condition{op: "OR", conds: conds}
+}
+
+// build the expression (with placeholders after $offset) and its params
+func (c *Condition) sql(offset int) (string, []interface{}) {
+	if c.op == "" {
+		// wrapped so a leading placeholder is renumbered too
+		return renumber("("+c.expr+")", offset), c.params
+	}
+	if len(c.conds) == 0 {
+		if c.op == "AND" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	parts := make([]string, len(c.conds))
+	var params []interface{}
+	for i, sub := range c.conds {
+		var ps []interface{}
+		parts[i], ps = sub.sql(offset + len(params))
+		params = append(params, ps...)
+	}
+	return "(" + strings.Join(parts, " "+c.op+" ") + ")", params
+}
+
+// Return a new Query with an additional (WHERE) filter built
+// from the Condition. Params are bound like Where
+func (q *Query) WhereCond(c *Condition) *Query {
+	s, params := c.sql(0)
+	return q.Where(s, params...)
+}
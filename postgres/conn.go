@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// wrapper type around sql.Conn
+// Pins a sequence of operations to a single physical
+// connection so session state (temp tables, advisory locks,
+// SET variables) is shared between them without a transaction
+type Conn struct {
+	*sql.Conn
+	db     *DB
+	active int32 // 1 while counted as in progress by the DB (see Shutdown)
+}
+
+// Reserve a single connection from the pool
+// the Conn must be closed to return it to the pool
+func (db *DB) Conn(ctx context.Context) (*Conn, error) {
+	if !db.inflight.add() {
+		return nil, ErrShutdown
+	}
+	rawconn, err := db.DB.Conn(ctx)
+	if err != nil {
+		db.inflight.done()
+		return nil, err
+	}
+	return &Conn{Conn: rawconn, db: db, active: 1}, nil
+}
+
+// like sql.Conn.Close. The DB stops counting the Conn as in progress
+func (c *Conn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.active, 1, 0) {
+		c.db.inflight.done()
+	}
+	return c.Conn.Close()
+}
+
+func (c *Conn) Relations() (rels map[string]*Relation, err error) {
+	return c.db.Relations()
+}
+
+// Get Relation info by name
+func (c *Conn) Relation(name string) (*Relation, error) {
+	return c.db.Relation(name)
+}
+
+// Create a Query for a named relation that will run on this connection
+// any errors are defered until an actual query is performed
+func (c *Conn) From(name string) *Query {
+	q := new(Query)
+	rel, err := c.db.Relation(name)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	q.from = rel
+	q.tx = c
+	return q
+}
+
+// like sql.Conn.QueryContext only returns a *Rows rather than *sql.Rows
+func (c *Conn) Query(q string, vals ...interface{}) (*Rows, error) {
+	return c.QueryContext(context.Background(), q, vals...)
+}
+
+// like Query but the query is cancelled when ctx is done
+func (c *Conn) QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error) {
+	rows, err := c.Conn.QueryContext(ctx, castComposites(q, vals), vals...)
+	if err != nil {
+		return nil, err
+	}
+	return c.db.newRows(q, rows), nil
+}
+
+// Start a transaction on this connection
+func (c *Conn) Begin() (*Tx, error) {
+	return c.BeginTx(context.Background(), nil)
+}
+
+// like sql.Conn.BeginTx only returns a *Tx. The transaction
+// is rolled back if ctx is done before it is committed
+func (c *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	rawtx, err := c.Conn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.db.newTx(rawtx), nil
+}
+
+// Like DB.Transaction but runs on this connection
+func (c *Conn) Transaction(fn func(tx *Tx) error) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	return runTx(tx, fn)
+}
+
+func (c *Conn) Insert(vs ...RecordValue) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.Insert(vs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Conn) Update(vs ...RecordValue) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.Update(vs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Conn) Upsert(vs ...RecordValue) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.Upsert(vs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Conn) Delete(vs ...RecordValue) error {
+	tx, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.Delete(vs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// queryer that can run a query bound to a context
+// (DB, Tx, Conn and ReadOnlyDB)
+type ctxQueryer interface {
+	QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error)
+}
+
+// Return a new Query whose statements (Fetch, Count, Each etc) are run
+// with ctx, so they are cancelled when ctx is done, ie when the client
+// of an HTTP request goes away or its deadline passes
+func (q *Query) WithContext(ctx context.Context) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.ctx = ctx
+	return q2
+}
+
+// like Fetch but the query is cancelled when ctx is done
+func (q *Query) FetchContext(ctx context.Context) ([]RecordValue, error) {
+	return q.WithContext(ctx).Fetch()
+}
+
+// Return a new Query whose statements are cancelled if they take longer
+// than d, ie as a guardrail against runaway reporting queries. The time
+// includes reading the rows. Zero means no timeout
+func (q *Query) Timeout(d time.Duration) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.timeout = d
+	return q2
+}
+
+// run the query on q.tx with q.ctx and q.timeout (if set)
+func (q *Query) runQuery(s string, params ...interface{}) (*Rows, error) {
+	if q.ctx == nil && q.timeout == 0 {
+		return q.tx.Query(s, params...)
+	}
+	cq, ok := q.tx.(ctxQueryer)
+	if !ok {
+		if q.timeout != 0 {
+			return nil, fmt.Errorf("cannot set a timeout on a query on %T", q.tx)
+		}
+		return q.tx.Query(s, params...)
+	}
+	ctx := q.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if q.timeout == 0 {
+		return cq.QueryContext(ctx, s, params...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	timeout := func() error {
+		if ctx.Err() != context.DeadlineExceeded {
+			return nil
+		}
+		return fmt.Errorf("query on %s timed out after %v: %w", q.from.Name, q.timeout, ctx.Err())
+	}
+	rs, err := cq.QueryContext(ctx, s, params...)
+	if err != nil {
+		cancel()
+		if terr := timeout(); terr != nil {
+			return nil, terr
+		}
+		return nil, err
+	}
+	rs.timeout = timeout
+	// the rows are read with ctx so it lives until they are closed
+	release := rs.release
+	rs.release = func() {
+		if release != nil {
+			release()
+		}
+		cancel()
+	}
+	return rs, nil
+}
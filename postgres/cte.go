@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// a common table expression added by With or WithRecursive
+type cte struct {
+	name      string
+	sql       string        // numbers its own placeholders from $1
+	args      []interface{} // params for sql
+	recursive bool
+}
+
+// Return a new Query with sub as a common table expression (WITH name
+// AS (...)) so it can be referred to by name in Where, ie:
+//
+//	db.From("person").
+//		With("nearby", db.From("location").Select("id").Where("name = $1", "g1")).
+//		Where("location_id IN (SELECT id FROM nearby)")
+func (q *Query) With(name string, sub *Query) *Query {
+	if q.err != nil {
+		return q
+	}
+	if sub.err != nil {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("invalid WITH %s: %w", name, sub.err)
+		return q2
+	}
+	return q.withCTE(cte{name: name, sql: sub.subquerySql(), args: sub.selectArgs()})
+}
+
+// Return a new Query with a recursive common table expression that
+// starts with the rows of anchor and repeatedly adds the rows of the
+// anchor's relation joined to the rows found so far using on, ie every
+// report of a manager in an org chart:
+//
+//	db.From("employee").
+//		WithRecursive("org", db.From("employee").Where("id = $1", bossID), "employee.manager_id = org.id").
+//		Where("id IN (SELECT id FROM org)")
+//
+// Rows are combined with UNION (not UNION ALL) so cycles terminate
+func (q *Query) WithRecursive(name string, anchor *Query, on string) *Query {
+	if q.err != nil {
+		return q
+	}
+	if anchor.err != nil {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("invalid WITH RECURSIVE %s: %w", name, anchor.err)
+		return q2
+	}
+	names := anchor.picked
+	if len(names) == 0 {
+		for _, c := range anchor.from.cols {
+			names = append(names, c.name)
+		}
+	}
+	fields := make([]string, len(names))
+	for i, n := range names {
+		fields[i] = anchor.from.Name + "." + n
+	}
+	s := fmt.Sprintf("%s UNION SELECT %s FROM %s JOIN %s ON %s",
+		anchor.subquerySql(), strings.Join(fields, ","), anchor.from.Name, name, on)
+	return q.withCTE(cte{name: name, sql: s, args: anchor.selectArgs(), recursive: true})
+}
+
+func (q *Query) withCTE(c cte) *Query {
+	q2 := q.cp()
+	for _, x := range q.ctes {
+		if x.name == c.name {
+			q2.err = fmt.Errorf("cannot use WITH %s more than once", c.name)
+			return q2
+		}
+	}
+	q2.ctes = append(q.ctes[:len(q.ctes):len(q.ctes)], c)
+	return q2
+}
+
+// the WITH clause of the query (if any)
+func (q *Query) withExpr() string {
+	if len(q.ctes) == 0 {
+		return ""
+	}
+	s := "WITH "
+	for _, c := range q.ctes {
+		if c.recursive {
+			s = "WITH RECURSIVE "
+		}
+	}
+	offset := 0
+	defs := make([]string, len(q.ctes))
+	for i, c := range q.ctes {
+		defs[i] = fmt.Sprintf("%s AS (%s)", c.name, renumber(c.sql, offset))
+		offset += len(c.args)
+	}
+	return s + strings.Join(defs, ", ") + " "
+}
+
+// the params of the WITH clause
+func (q *Query) withArgs() []interface{} {
+	var args []interface{}
+	for _, c := range q.ctes {
+		args = append(args, c.args...)
+	}
+	return args
+}
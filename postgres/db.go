@@ -1,11 +1,14 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -34,6 +37,9 @@ const (
 			a.atttypid as toid,
 			a.attnotnull as notnull,
 			COALESCE(i.indisprimary,false) as pk,
+			-- attgenerated/attidentity only exist on newer servers
+			COALESCE(to_jsonb(a)->>'attgenerated', '') NOT IN ('', ' ')
+				OR COALESCE(to_jsonb(a)->>'attidentity', '') = 'a' as generated,
 			COALESCE(fks.fktable, ''),
 			COALESCE(fks.fkfield, ''),
 			COALESCE(regexp_replace(
@@ -44,9 +50,17 @@ const (
 				),
 				E'\\).*',
 				''
-			),'') as args
+			),'') as args,
+			COALESCE(substring(
+				col_description(a.attrelid, a.attnum)
+				FROM E'alias:\\s*([A-Za-z_][A-Za-z0-9_]*)'
+			), '') as alias,
+			CASE WHEN COALESCE(to_jsonb(a)->>'attgenerated', '') IN ('', ' ')
+				THEN COALESCE(pg_get_expr(ad.adbin, ad.adrelid), '')
+				ELSE '' END as def
 		FROM pg_attribute a JOIN pg_class pgc ON pgc.oid = a.attrelid
-		LEFT JOIN pg_index i ON pgc.oid = i.indrelid AND i.indkey[0] = a.attnum
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		LEFT JOIN pg_index i ON pgc.oid = i.indrelid AND i.indisprimary AND a.attnum = ANY(i.indkey)
 		LEFT JOIN (
 			select
 				att2.attname as name,
@@ -92,12 +106,36 @@ const (
 			typnotnull,
 			typbasetype,
 			typtypmod,
-			typndims
+			typndims,
+			COALESCE(regexp_replace(
+				regexp_replace(
+					format_type(typbasetype, NULLIF(typtypmod, -1)),
+					E'^(.*?\\(|[^\\(]+$)',
+					''
+				),
+				E'\\).*',
+				''
+			),'') as baseargs
 		FROM pg_type
 		WHERE oid = $1
 		AND typisdefined = true
 	`
 
+	// SQL to list the columns of each unique index on a relation
+	selectUniquesSql = `
+		SELECT string_agg(a.attname, ',' ORDER BY a.attnum)
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = $1
+		AND i.indisunique
+		AND i.indpred IS NULL
+		AND i.indexprs IS NULL
+		GROUP BY i.indexrelid
+	`
+
+	// SQL to resolve a type name to its pg_type oid
+	selectTypeOidSql = `SELECT COALESCE(to_regtype($1)::oid, 0)`
+
 	// SQL to fetch list of enum labels
 	selectEnumSql = `
 		SELECT enumlabel
@@ -110,21 +148,57 @@ const (
 // wrapper type around sql.DB
 type DB struct {
 	*sql.DB
-	rels      map[string]*Relation
-	getRels   *sql.Stmt
-	getCols   *sql.Stmt
-	getType   *sql.Stmt
-	getLabels *sql.Stmt
+	rels       map[string]*Relation
+	getRels    *sql.Stmt
+	getCols    *sql.Stmt
+	getUniques *sql.Stmt
+	getType    *sql.Stmt
+	getLabels  *sql.Stmt
+	patterns   *queryPatterns // recorded WHERE filters (if tracking)
+	watchdog   *txWatchdog    // reports long running transactions (if watching)
+	version    serverVersion
+	maxRows    int                  // cap on rows returned by Fetch (0 = none)
+	queries    map[string]*namedSQL // queries loaded by LoadQueries
+	loc        *time.Location       // location timestamptz Values are converted to
+	nameMatch  NameMatch            // how records resolve inexact column names
+	shadow     *shadowReader        // DB reads are compared with (if shadowing)
+	tracker    *rowsTracker         // reports unclosed Rows (if tracking)
+	inflight   inflight             // queries and transactions in progress
+	mu         sync.RWMutex         // guards watchdog, shadow and tracker
+}
+
+const (
+	timestamptzOid    = 1184
+	tstzrangeOid      = 3910
+	tstzmultirangeOid = 4534
+)
+
+// Convert timestamptz columns to loc rather than keeping the session's
+// offset. Must be called before any Relations are loaded
+func (db *DB) SetLocation(loc *time.Location) {
+	db.loc = loc
 }
 
 // Analog of sql.Open that returns a *DB
-// requires a "postgres" driver (lib/pq) is registered
-func Open(dataSourceName string) (*DB, error) {
+// requires a "postgres" driver (lib/pq) is registered.
+// The DB is closed if any of the opts fail
+func Open(dataSourceName string, opts ...OpenOption) (*DB, error) {
 	rawdb, err := sql.Open("postgres", dataSourceName)
 	if err != nil {
 		return nil, err
 	}
-	return newDB(rawdb)
+	db, err := newDB(rawdb)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		err = opt(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
 }
 
 // init *DB by preparing any stmts we might need
@@ -139,6 +213,10 @@ func newDB(rawdb *sql.DB) (db *DB, err error) {
 	if err != nil {
 		return
 	}
+	db.getUniques, err = db.DB.Prepare(selectUniquesSql)
+	if err != nil {
+		return
+	}
 	db.getType, err = db.DB.Prepare(selectTypeSql)
 	if err != nil {
 		return
@@ -185,6 +263,33 @@ func (db *DB) From(name string) *Query {
 	return q
 }
 
+// regexp to match the typmod args of a type name ie "numeric(15,3)"
+var typeArgsPat = regexp.MustCompile(`\(([^)]*)\)`)
+
+// Return a ToValue for the named type. Composite, enum and domain
+// types are introspected on demand so Values can be built for them
+// without going via a Relation that uses them, ie:
+//
+//	thing, err := db.Type("thing")
+//	v, err := thing([]interface{}{[]int{1}, nil, nil})
+func (db *DB) Type(name string) (ToValue, error) {
+	var oid uint32
+	err := db.scanRow([]interface{}{&oid}, selectTypeOidSql, name)
+	if err != nil {
+		return nil, err
+	}
+	if oid == 0 {
+		return nil, fmt.Errorf("No type found: %s", name)
+	}
+	var args []string
+	if m := typeArgsPat.FindStringSubmatch(name); m != nil {
+		for _, a := range strings.Split(m[1], ",") {
+			args = append(args, strings.TrimSpace(a))
+		}
+	}
+	return db.kind(oid, args...)
+}
+
 // Get Relation info by name
 func (db *DB) Relation(name string) (*Relation, error) {
 	// TODO: stop loading ALL relations just to get one
@@ -199,30 +304,123 @@ func (db *DB) Relation(name string) (*Relation, error) {
 	return rel, nil
 }
 
+// like sql.DB.Query only returns a *Rows rather than *sql.Rows.
+// RecordValue params are cast to their composite type
 func (db *DB) Query(q string, vals ...interface{}) (*Rows, error) {
-	rows, err := db.DB.Query(q, vals...)
+	return db.QueryContext(context.Background(), q, vals...)
+}
+
+// like Query but the query is cancelled when ctx is done
+func (db *DB) QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error) {
+	if !db.inflight.add() {
+		return nil, ErrShutdown
+	}
+	rows, err := db.DB.QueryContext(ctx, castComposites(q, vals), vals...)
 	if err != nil {
+		db.inflight.done()
 		return nil, err
 	}
-	rs := new(Rows)
-	rs.Rows = rows
+	rs := db.newRows(q, rows)
+	rs.release = db.inflight.done
 	return rs, nil
 }
 
+// like sql.DB.Exec but RecordValue params are cast to their composite type
+func (db *DB) Exec(q string, vals ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), q, vals...)
+}
+
+// like Exec but the statement is cancelled when ctx is done
+func (db *DB) ExecContext(ctx context.Context, q string, vals ...interface{}) (sql.Result, error) {
+	if !db.inflight.add() {
+		return nil, ErrShutdown
+	}
+	defer db.inflight.done()
+	return db.DB.ExecContext(ctx, castComposites(q, vals), vals...)
+}
+
+// run q which returns a single row and scan it into dest. Counted
+// as in progress like Query so Shutdown waits for it
+func (db *DB) scanRow(dest []interface{}, q string, vals ...interface{}) error {
+	if !db.inflight.add() {
+		return ErrShutdown
+	}
+	defer db.inflight.done()
+	return db.DB.QueryRow(q, vals...).Scan(dest...)
+}
+
 func (db *DB) Begin() (*Tx, error) {
-	rawtx, err := db.DB.Begin()
+	return db.BeginTx(context.Background(), nil)
+}
+
+// like sql.DB.BeginTx only returns a *Tx. The transaction is
+// rolled back if ctx is done before it is committed
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if !db.inflight.add() {
+		return nil, ErrShutdown
+	}
+	rawtx, err := db.DB.BeginTx(ctx, opts)
 	if err != nil {
+		db.inflight.done()
 		return nil, err
 	}
-	return &Tx{rawtx, db}, nil
+	tx := db.newTx(rawtx)
+	tx.active = 1
+	return tx, nil
 }
 
-func (db *DB) Insert(vs ...RecordValue) error {
+// wrap rawtx and start tracking it if the watchdog is running
+func (db *DB) newTx(rawtx *sql.Tx) *Tx {
+	tx := &Tx{Tx: rawtx, db: db}
+	if w := db.txWatchdog(); w != nil {
+		w.track(tx)
+	}
+	return tx
+}
+
+// Run fn inside a transaction. The transaction is committed if fn
+// returns nil and rolled back if fn returns an error or panics (in which
+// case the panic is re-raised after the Rollback). fn may Commit or
+// Rollback the Tx itself, in which case it is left alone
+func (db *DB) Transaction(fn func(tx *Tx) error) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	err = tx.Insert(vs...)
+	return runTx(tx, fn)
+}
+
+func runTx(tx *Tx, fn func(tx *Tx) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if !tx.Done() {
+				tx.Rollback()
+			}
+			panic(p)
+		}
+	}()
+	err = fn(tx)
+	if tx.Done() {
+		return err
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) Insert(vs ...RecordValue) error {
+	return db.InsertContext(context.Background(), vs...)
+}
+
+// Like Tx.InsertContext in a new transaction
+func (db *DB) InsertContext(ctx context.Context, vs ...RecordValue) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.InsertContext(ctx, vs...)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -231,11 +429,30 @@ func (db *DB) Insert(vs ...RecordValue) error {
 }
 
 func (db *DB) Update(vs ...RecordValue) error {
+	return db.UpdateContext(context.Background(), vs...)
+}
+
+// Like Tx.UpdateContext in a new transaction
+func (db *DB) UpdateContext(ctx context.Context, vs ...RecordValue) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.UpdateContext(ctx, vs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Like Tx.InsertReturning in a new transaction
+func (db *DB) InsertReturning(v RecordValue, names ...string) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	err = tx.Update(vs...)
+	err = tx.InsertReturning(v, names...)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -243,12 +460,31 @@ func (db *DB) Update(vs ...RecordValue) error {
 	return tx.Commit()
 }
 
-func (db *DB) Upsert(vs ...RecordValue) error {
+// Like Tx.UpdateReturning in a new transaction
+func (db *DB) UpdateReturning(v RecordValue, names ...string) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	err = tx.Upsert(vs...)
+	err = tx.UpdateReturning(v, names...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) Upsert(vs ...RecordValue) error {
+	return db.UpsertContext(context.Background(), vs...)
+}
+
+// Like Tx.UpsertContext in a new transaction
+func (db *DB) UpsertContext(ctx context.Context, vs ...RecordValue) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.UpsertContext(ctx, vs...)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -257,11 +493,16 @@ func (db *DB) Upsert(vs ...RecordValue) error {
 }
 
 func (db *DB) Delete(vs ...RecordValue) error {
-	tx, err := db.Begin()
+	return db.DeleteContext(context.Background(), vs...)
+}
+
+// Like Tx.DeleteContext in a new transaction
+func (db *DB) DeleteContext(ctx context.Context, vs ...RecordValue) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	err = tx.Delete(vs...)
+	err = tx.DeleteContext(ctx, vs...)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -328,10 +569,10 @@ func (db *DB) cols(reloid uint32) ([]*col, error) {
 	cols := make([]*col, 0)
 	for rows.Next() {
 		c := new(col)
-		var argstr string
+		var argstr, def string
 		var num int
 		err = rows.Scan(&num, &c.name, &c.typ, &c.oid, &c.notNull,
-			&c.pk, &c.refT, &c.refF, &argstr)
+			&c.pk, &c.generated, &c.refT, &c.refF, &argstr, &c.alias, &def)
 		if err != nil {
 			return nil, err
 		}
@@ -343,6 +584,7 @@ func (db *DB) cols(reloid uint32) ([]*col, error) {
 		if err != nil {
 			return nil, err
 		}
+		c.setDefault(def)
 		cols = append(cols, c)
 	}
 	err = rows.Err()
@@ -356,13 +598,48 @@ func (db *DB) cols(reloid uint32) ([]*col, error) {
 func (db *DB) relation(name string, oid uint32) (r *Relation, err error) {
 	r = new(Relation)
 	r.Name = name
+	r.db = db
+	r.oid = oid
 	r.cols, err = db.cols(oid)
+	if err != nil {
+		return r, err
+	}
 	r.k = Record(r.cols...)
+	r.uniques, err = db.uniques(oid)
 	return r, err
 }
 
+// return the column names of each unique index for a pg_class oid
+func (db *DB) uniques(reloid uint32) ([][]string, error) {
+	rows, err := db.getUniques.Query(reloid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uniques := make([][]string, 0)
+	for rows.Next() {
+		var names string
+		err = rows.Scan(&names)
+		if err != nil {
+			return nil, err
+		}
+		uniques = append(uniques, strings.Split(names, ","))
+	}
+	return uniques, rows.Err()
+}
+
 func (db *DB) kind(oid uint32, args ...string) (ToValue, error) {
-	if f, ok := typs[oid]; ok {
+	if db.loc != nil {
+		switch oid {
+		case timestamptzOid:
+			return TimestampTZIn(db.loc), nil
+		case tstzrangeOid:
+			return Range(TimestampTZIn(db.loc)), nil
+		case tstzmultirangeOid:
+			return Multirange(TimestampTZIn(db.loc)), nil
+		}
+	}
+	if f, ok := typeFor(oid); ok {
 		return f(args...)
 	}
 	return db.complexKind(oid, args...)
@@ -373,8 +650,13 @@ func (db *DB) complexKind(oid uint32, args ...string) (ToValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	if !rows.Next() {
-		return nil, fmt.Errorf("No pg_type with oid %d", oid)
+		err = rows.Err()
+		if err == nil {
+			err = fmt.Errorf("No pg_type with oid %d", oid)
+		}
+		return nil, err
 	}
 	var (
 		name     string // the string representation
@@ -387,10 +669,11 @@ func (db *DB) complexKind(oid uint32, args ...string) (ToValue, error) {
 		basetype uint32 // pg_type oid of base type when typ=d
 		typmod   int32  // type-specific data supplied at table creation time
 		ndims    int32  // num of array dimension when typ=d
+		baseargs string // typmod args of the base type when typ=d
 	)
 	err = rows.Scan(
 		&name, &typ, &delim, &relid, &elem, &array,
-		&notnull, &basetype, &typmod, &ndims,
+		&notnull, &basetype, &typmod, &ndims, &baseargs,
 	)
 	if err != nil {
 		return nil, err
@@ -403,6 +686,9 @@ func (db *DB) complexKind(oid uint32, args ...string) (ToValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	if f, ok := typeForName(name); ok {
+		return f(args...)
+	}
 	switch typ {
 	// base types
 	case "b":
@@ -419,10 +705,16 @@ func (db *DB) complexKind(oid uint32, args ...string) (ToValue, error) {
 			switch name {
 			// auto-register hstore oid
 			case "hstore":
-				typs[oid] = func(args ...string) (ToValue, error) {
+				RegisterType(oid, func(args ...string) (ToValue, error) {
 					return HStore, nil
-				}
+				})
 				return HStore, nil
+			// auto-register ltree oid
+			case "ltree":
+				RegisterType(oid, func(args ...string) (ToValue, error) {
+					return LTree, nil
+				})
+				return LTree, nil
 			// other (unknown) base types
 			default:
 				return nil, fmt.Errorf("base type %s with oid %d is not implimented", name, oid)
@@ -434,10 +726,22 @@ func (db *DB) complexKind(oid uint32, args ...string) (ToValue, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Record(cols...), nil
+		return compositeRecord(name, cols...), nil
 	// domain types
 	case "d":
-		return nil, errors.New("domain types not implimented yet")
+		// domains take their typmod from the definition not the column
+		args = nil
+		if baseargs != "" {
+			args = strings.Split(baseargs, ",")
+		}
+		k, err := db.kind(basetype, args...)
+		if err != nil {
+			return nil, fmt.Errorf("domain %s: %v", name, err)
+		}
+		if notnull {
+			return Domain(name, k), nil
+		}
+		return k, nil
 	// enum types
 	case "e":
 		labels, err := db.enumLabelsFor(oid)
@@ -1,11 +1,18 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // create a shell like this:
@@ -16,6 +23,7 @@ import (
  * dropdb $DBARGS || echo "ignored"
  * createdb $DBARGS
  * echo "CREATE EXTENSION hstore;" | psql $DBARGS
+ * echo "CREATE EXTENSION ltree;" | psql $DBARGS
  *
  * go test
  */
@@ -47,11 +55,30 @@ var testcols = [...]*tc{
 	&tc{`bytea`, []byte("xyz"), "xyz"},
 	&tc{`timestamp`, "2011-01-01 23:01", "2011-01-01T23:01:00Z"},
 	&tc{`timestamptz`, "2011-01-01 23:02:00", "2011-01-01T23:02:00Z"},
+	&tc{`date`, "2011-01-03 10:00", "2011-01-03"},
+	&tc{`interval`, "1 day 02:03:04", "1 day 02:03:04"},
+	&tc{`inet`, "192.168.0.1", "192.168.0.1"},
+	&tc{`cidr`, "10.1.0.0/16", "10.1.0.0/16"},
+	&tc{`macaddr`, "08-00-2B-01-02-03", "08:00:2b:01:02:03"},
+	&tc{`macaddr8`, "08:00:2b:01:02:03", "08:00:2b:ff:fe:01:02:03"},
+	&tc{`tsvector`, "a cat fat", "'a' 'cat' 'fat'"},
+	&tc{`tsquery`, "'fat' & 'cat'", "'fat' & 'cat'"},
+	&tc{`xml`, "<a>x</a>", "<a>x</a>"},
+	&tc{`json`, `{"a": [1, "x"]}`, `{"a": [1, "x"]}`},
+	&tc{`jsonb`, `{"a": [1, "x"]}`, `{"a": [1, "x"]}`},
+	&tc{`int4range`, "[1,10)", "[1,10)"},
+	&tc{`daterange`, "[2011-01-01,2011-02-01)", "[2011-01-01,2011-02-01)"},
 	&tc{`boolean`, true, "t"},
 	&tc{`gender`, "male", "male"},
 	&tc{`hstore`,
 		[]byte(`"k1" => "v1", "k2" => "v2"`),
 		`"k1"=>"v1","k2"=>"v2"`},
+	&tc{`ltree`, "Top.Science.Astronomy", "Top.Science.Astronomy"},
+	&tc{`pg_lsn`, "16/B374D848", "16/B374D848"},
+	&tc{`xid`, 1234, "1234"},
+	&tc{`txid_snapshot`, "10:20:10,14,15", "10:20:10,14,15"},
+	&tc{`email`, "bob@example.com", "bob@example.com"},
+	&tc{`positive_int`, 7, "7"},
 	&tc{`char(1)[]`,
 		[]interface{}{"a", "b"},
 		`{"a","b"}`},
@@ -70,6 +97,12 @@ var testcols = [...]*tc{
 	&tc{`bigint[]`,
 		[]interface{}{1000, 2000},
 		`{1000,2000}`},
+	&tc{`integer[][]`,
+		[]interface{}{[]interface{}{1, 2}, []interface{}{3, 4}},
+		`{{1,2},{3,4}}`},
+	&tc{`integer[]`,
+		"[0:1]={5,6}",
+		`[0:1]={5,6}`},
 	&tc{`real[]`,
 		[]interface{}{1.1, 2.2},
 		`{1.1,2.2}`},
@@ -88,6 +121,15 @@ var testcols = [...]*tc{
 	&tc{`timestamptz[]`,
 		[]interface{}{"2011-01-01", "2012-01-01"},
 		`{2011-01-01T00:00:00Z,2012-01-01T00:00:00Z}`},
+	&tc{`date[]`,
+		[]interface{}{"2009-01-01", "2010-01-01"},
+		`{2009-01-01,2010-01-01}`},
+	&tc{`inet[]`,
+		[]interface{}{"::1", "10.0.0.1/8"},
+		`{"::1","10.0.0.1/8"}`},
+	&tc{`macaddr[]`,
+		[]interface{}{"08002b010203", "08002b:010204"},
+		`{"08:00:2b:01:02:03","08:00:2b:01:02:04"}`},
 	&tc{`boolean[]`,
 		[]interface{}{true, false},
 		`{t,f}`},
@@ -97,6 +139,12 @@ var testcols = [...]*tc{
 	&tc{`hstore[]`,
 		[]interface{}{[]byte(`"k1" => "v1"`), []byte(`"kx" => "vx"`)},
 		`{"\"k1\" => \"v1\"","\"kx\" => \"vx\""}`},
+	&tc{`uuid`,
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+	&tc{`uuid[]`,
+		[]interface{}{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+		`{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"}`},
 	&tc{`thing`,
 		[]interface{}{
 			[]interface{}{8, 8, 8},
@@ -112,10 +160,14 @@ var setup = []string{
 	`DROP SCHEMA public CASCADE`,
 	`CREATE SCHEMA public`,
 	`CREATE EXTENSION hstore`,
+	`CREATE EXTENSION ltree`,
 	// create an ENUM
 	`CREATE TYPE gender AS ENUM (
 		'male', 'female'
 	)`,
+	// create some domains
+	`CREATE DOMAIN email AS varchar(20) NOT NULL`,
+	`CREATE DOMAIN positive_int AS integer CHECK (VALUE > 0)`,
 	// create a composite type
 	`CREATE TYPE thing AS (
 		t0 integer[],
@@ -132,6 +184,22 @@ var setup = []string{
 		age integer,
 		location_id integer REFERENCES location
 	)`,
+	`CREATE TABLE token (
+		id uuid primary key DEFAULT md5(random()::text)::uuid,
+		name text DEFAULT 'unnamed'
+	)`,
+	`CREATE TABLE membership (
+		person_id integer REFERENCES person,
+		location_id integer REFERENCES location,
+		role text,
+		label text GENERATED ALWAYS AS (upper(role)) STORED,
+		PRIMARY KEY (person_id, location_id)
+	)`,
+	`CREATE TABLE log_entry (
+		msg text,
+		level integer
+	)`,
+	`COMMENT ON COLUMN log_entry.msg IS 'what happened. alias: message'`,
 	`INSERT INTO location VALUES (100,'g1')`,
 	`INSERT INTO location VALUES (200,'g2')`,
 	`INSERT INTO person VALUES (1,'bob',19, 100)`,
@@ -284,14 +352,39 @@ func TestRelations(t *testing.T) {
 	cnt := 0
 	for _, rel := range rels {
 		switch rel.Name {
-		case "test", "thing", "person", "location":
+		case "test", "thing", "person", "location", "token", "membership", "log_entry":
 			cnt++
 		default:
 			t.Fatalf("unexpected relation %s", rel.Name)
 		}
 	}
-	if cnt != 4 {
-		t.Errorf("expected to find 2 relations got: %d", cnt)
+	if cnt != 7 {
+		t.Errorf("expected to find 7 relations got: %d", cnt)
+	}
+}
+
+func TestUUIDPrimaryKey(t *testing.T) {
+	db := open(t)
+	v, err := db.New("token", []interface{}{nil, "tok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := v.ValueBy("id")
+	if id.IsNull() {
+		t.Fatal("expected uuid pk to be set by INSERT")
+	}
+	v2, err := db.From("token").Get(id.String())
+	if err != nil {
+		t.Fatal(err)
+	} else if v2 == nil {
+		t.Fatalf("could not Get(%s) record", id.String())
+	}
+	if v2.Get("name").(string) != "tok" {
+		t.Errorf("expected name to be tok got: %v", v2.Get("name"))
 	}
 }
 
@@ -482,3 +575,1629 @@ func TestQuerySum(t *testing.T) {
 		t.Fatalf("expected sum age to be 57 got: %v", v.Val())
 	}
 }
+
+func TestConnSessionState(t *testing.T) {
+	db := open(t)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), `SET application_name = 'conn_test'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := conn.Query(`SHOW application_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	v, _ := Text(nil)
+	for rs.Next() {
+		err = rs.Scan(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v.String() != "conn_test" {
+		t.Errorf("expected application_name to be conn_test got: %v", v.String())
+	}
+	// queries built from the conn should also work
+	n, err := conn.From("person").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Errorf("expected to count some person records")
+	}
+}
+
+func TestRelationCache(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel.SetCache(NewLRUCache(10))
+	defer rel.SetCache(nil)
+	v, err := db.From("location").Get(200)
+	if err != nil {
+		t.Fatal(err)
+	} else if v == nil {
+		t.Fatal("no record found")
+	}
+	// change the row behind the cache's back
+	_, err = db.DB.Exec(`UPDATE location SET name = 'changed' WHERE id = 200`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = db.From("location").Get(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name").(string) != "g2" {
+		t.Errorf("expected cached name g2 got: %v", v.Get("name"))
+	}
+	// writes through the package should invalidate
+	err = v.Set("name", "g2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.DB.Exec(`UPDATE location SET name = 'g2b' WHERE id = 200`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = db.From("location").Get("200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name").(string) != "g2b" {
+		t.Errorf("expected fresh name g2b got: %v", v.Get("name"))
+	}
+	_, err = db.DB.Exec(`UPDATE location SET name = 'g2' WHERE id = 200`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	db := open(t)
+	store := NewMemoryStore()
+	q := db.From("person").Where("age > $1", 0).Cache(store, time.Minute)
+	vs, err := q.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get(q.CacheKey()); !ok {
+		t.Fatal("expected results to be cached")
+	}
+	cached, err := q.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != len(vs) {
+		t.Fatalf("expected %d cached records got: %d", len(vs), len(cached))
+	}
+	for i, v := range vs {
+		if cached[i].String() != v.String() {
+			t.Errorf("expected cached record %s got: %s", v.String(), cached[i].String())
+		}
+	}
+}
+
+func TestRelationStats(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rel.Vacuum(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := rel.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Tuples < 1 {
+		t.Errorf("expected reltuples estimate after VACUUM ANALYZE got: %v", st.Tuples)
+	}
+}
+
+func TestIndexAdvice(t *testing.T) {
+	db := open(t)
+	db.TrackQueryPatterns()
+	defer func() { db.patterns = nil }()
+	for i := 0; i < 3; i++ {
+		_, err := db.From("person").Where("name = $1", "bob").Fetch()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := db.patterns.filters("person")
+	if len(fs) != 1 || fs[0].Count != 3 {
+		t.Errorf("expected 1 filter used 3 times got: %v", fs)
+	}
+	_, err := db.IndexAdvice()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlocking(t *testing.T) {
+	db := open(t)
+	tx1, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	_, err = tx1.Exec(`LOCK TABLE location IN ACCESS EXCLUSIVE MODE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		tx2, err := db.Begin()
+		if err != nil {
+			done <- err
+			return
+		}
+		_, err = tx2.Exec(`SELECT * FROM location`)
+		tx2.Rollback()
+		done <- err
+	}()
+	var vs []RecordValue
+	for i := 0; i < 50 && len(vs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		vs, err = db.Blocking()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(vs) == 0 {
+		t.Fatal("expected to find a blocked session")
+	}
+	if s := vs[0].Get("blocked_query").(string); !strings.Contains(s, "location") {
+		t.Errorf("unexpected blocked query: %s", s)
+	}
+	tx1.Rollback()
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchTransactions(t *testing.T) {
+	db := open(t)
+	late := make(chan *Tx, 1)
+	db.WatchTransactions(20*time.Millisecond, func(tx *Tx, age time.Duration) {
+		late <- tx
+		tx.Rollback()
+	})
+	defer db.StopWatchingTransactions()
+	// a committed tx should never be reported
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a leaked one should
+	leaked, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case tx := <-late:
+		if tx != leaked {
+			t.Errorf("expected the leaked transaction to be reported")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected leaked transaction to be reported")
+	}
+	err = leaked.Commit()
+	if err == nil {
+		t.Errorf("expected Commit to fail after watchdog Rollback")
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	db := open(t)
+	var tx *Tx
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected panic to be re-raised got: %v", p)
+			}
+		}()
+		db.Transaction(func(x *Tx) error {
+			tx = x
+			_, err := x.Exec(`UPDATE location SET name = 'panicked' WHERE id = 100`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			panic("boom")
+		})
+	}()
+	if !tx.Done() {
+		t.Errorf("expected Tx to be done after panic")
+	}
+	v, err := db.From("location").Get(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name").(string) != "g1" {
+		t.Errorf("expected UPDATE to be rolled back got name: %v", v.Get("name"))
+	}
+	err = db.Transaction(func(x *Tx) error {
+		tx = x
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Done() {
+		t.Errorf("expected Tx to be done after Transaction returns")
+	}
+}
+
+func TestGetErrNotFound(t *testing.T) {
+	db := open(t)
+	_, err := db.From("person").GetErr(-1)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got: %v", err)
+	}
+	_, err = db.From("person").Where("name = $1", "nobody").FetchOneErr()
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got: %v", err)
+	}
+	v := db.From("person").MustGet(1)
+	if v.Get("name").(string) != "bob" {
+		t.Errorf("expected name to be bob got: %v", v.Get("name"))
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected MustGet to panic with ErrNotFound got: %v", err)
+		}
+	}()
+	db.From("person").MustGet(-1)
+}
+
+func TestRepo(t *testing.T) {
+	db := open(t)
+	locations, err := NewRepo[struct {
+		ID   int
+		Name string
+	}](db, "location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := locations.Get(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Name != "g1" {
+		t.Errorf("expected name to be g1 got: %v", loc.Name)
+	}
+	loc.ID = 0
+	loc.Name = "g3"
+	err = locations.Insert(&loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.ID == 0 {
+		t.Errorf("expected Insert to set the primary key")
+	}
+	found, err := locations.Find(locations.Query().Where("name = $1", "g3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != loc.ID {
+		t.Errorf("expected to find the inserted location got: %v", found)
+	}
+	err = locations.Delete(&loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := rel.New([]interface{}{200, "g2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rel.New([]interface{}{300, "g4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.MergeInto("location").Using(a, b).On("id").WhenMatchedUpdate().WhenNotMatchedInsert().Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows to be merged got: %d", n)
+	}
+	v, err := db.From("location").GetErr(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Delete(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	db := open(t)
+	n, err := db.ServerVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 90000 {
+		t.Errorf("unexpected server version: %d", n)
+	}
+}
+
+func TestQueryUpdateDelete(t *testing.T) {
+	db := open(t)
+	_, err := db.DB.Exec(`INSERT INTO location VALUES (400,'g5'),(401,'g5')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.From("location").Where("name = $1", "g5")
+	n, err := q.Update(map[string]interface{}{"name": "g6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows to be updated got: %d", n)
+	}
+	n, err = db.From("location").Where("name = $1", "g6").Delete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows to be deleted got: %d", n)
+	}
+	_, err = db.From("location").Delete()
+	if !errors.Is(err, ErrFullTableWrite) {
+		t.Errorf("expected ErrFullTableWrite got: %v", err)
+	}
+}
+
+func TestMaxRows(t *testing.T) {
+	db := open(t)
+	db.SetMaxRows(1)
+	defer db.SetMaxRows(0)
+	_, err := db.From("person").Fetch()
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("expected ErrTooManyRows got: %v", err)
+	}
+	_, err = db.From("person").Limit(1).Fetch()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMultirangeQuery(t *testing.T) {
+	db := open(t)
+	ok, err := db.Supports(FeatureMultirange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Skip("multirange types require Postgres 14+")
+	}
+	v, _ := Multirange(Integer)(nil)
+	err = db.DB.QueryRow(`SELECT '{[1,3),[5,9)}'::int4multirange WHERE $1::int4multirange IS NOT NULL`,
+		Must(Multirange(Integer)("{[1,2]}"))).Scan(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "{[1,3),[5,9)}" {
+		t.Errorf("unexpected multirange: %v", v.String())
+	}
+}
+
+func TestNamedSQL(t *testing.T) {
+	db := open(t)
+	vs, err := db.NamedSQL(`SELECT id, name, age, location_id FROM person WHERE id IN (:ids) ORDER BY id`,
+		Params{"ids": []int{1, 3}}).Records("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[1].Get("name").(string) != "alice" {
+		t.Errorf("unexpected records: %v", vs)
+	}
+}
+
+func TestLoadQueries(t *testing.T) {
+	db := open(t)
+	err := db.LoadQueriesFS(fstest.MapFS{
+		"person.sql": {Data: []byte("-- :name people_by_age\n-- :relation person\nSELECT * FROM person WHERE age > :age ORDER BY id\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := db.Named("people_by_age").QueryRecords(Params{"age": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) == 0 {
+		t.Errorf("expected records")
+	}
+	if _, err = db.Named("missing").QueryRecords(nil); err == nil {
+		t.Errorf("expected missing query to return an error")
+	}
+	err = db.LoadQueriesFS(fstest.MapFS{
+		"bad.sql": {Data: []byte("-- :name bad\nSELECT * FROM person WHERE nope = :x\n")},
+	})
+	if err == nil {
+		t.Errorf("expected unknown column to fail at load time")
+	}
+}
+
+func TestPlanGuard(t *testing.T) {
+	db := open(t)
+	q := db.From("person").Where("name = $1", "bob")
+	if err := db.PlanGuard(0).Add("by name", q).Check(); err == nil {
+		t.Errorf("expected a seq scan of person to be reported")
+	}
+	if err := db.PlanGuard(1<<40).Add("by name", q).Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDomainNotNull(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c *col
+	for i, tc := range testcols {
+		if tc.typ == "email" {
+			c = rel.col(fmt.Sprintf("c%d", i))
+		}
+	}
+	v, err := c.k(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Value(); err == nil {
+		t.Errorf("expected NULL email to be rejected")
+	}
+	if err = v.Scan(strings.Repeat("x", 21)); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.String()) != 20 {
+		t.Errorf("expected email to be truncated to varchar(20) got: %s", v)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db := open(t)
+	ro := db.ReadOnly()
+	vs, err := ro.From("person").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) == 0 {
+		t.Fatal("expected to read some people")
+	}
+	if err = ro.Update(vs[0]); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly got: %v", err)
+	}
+	if _, err = ro.From("person").Where("id = $1", 1).Delete(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly got: %v", err)
+	}
+	err = ro.Transaction(func(tx *Tx) error {
+		_, err := tx.Tx.Exec(`DELETE FROM person`)
+		return err
+	})
+	if err == nil {
+		t.Errorf("expected READ ONLY transaction to reject DELETE")
+	}
+}
+
+func TestType(t *testing.T) {
+	db := open(t)
+	thing, err := db.Type("thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := thing([]interface{}{[]int{1, 2}, nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(RecordValue); !ok {
+		t.Errorf("expected composite type to be a RecordValue got %T", v)
+	}
+	gender, err := db.Type("gender")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = gender("other"); err == nil {
+		t.Errorf("expected invalid enum label to return an error")
+	}
+	num, err := db.Type("numeric(15,3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err = num(0.12); err != nil || v.String() != "0.120" {
+		t.Errorf("unexpected numeric: %v %v", v, err)
+	}
+	if _, err = db.Type("no_such_type"); err == nil {
+		t.Errorf("expected unknown type to return an error")
+	}
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	db := open(t)
+	v, err := db.New("membership", []interface{}{1, 100, "owner", nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getEq(t, v, "label", "OWNER", "after INSERT")
+	err = v.Set("role", "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getEq(t, v, "label", "MEMBER", "after UPDATE")
+	err = db.Delete(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.From("membership").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected membership to be deleted")
+	}
+}
+
+func TestIdentityWithoutPrimaryKey(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("log_entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rel.SetIdentity(IdentityPrimaryKey)
+	for _, msg := range []string{"a", "a", "b"} {
+		v, err := rel.New([]interface{}{msg, 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = rel.SetIdentity(IdentityAllColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := db.From("log_entry").Where("msg = $1", "a").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(vs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.From("log_entry").Where("msg = $1", "a").Count(); n != 1 {
+		t.Errorf("expected only one duplicate row to be deleted got %d left", n)
+	}
+	err = rel.SetIdentity(IdentityCtid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Transaction(func(tx *Tx) error {
+		vs, err := tx.From("log_entry").Where("msg = $1", "b").Fetch()
+		if err != nil {
+			return err
+		}
+		if err = vs[0].Set("level", 2); err != nil {
+			return err
+		}
+		return tx.Update(vs[0])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.From("log_entry").Where("level = $1", 2).Count(); n != 1 {
+		t.Errorf("expected row to be updated by ctid")
+	}
+	v, err := rel.New([]interface{}{"c", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Update(v); err == nil {
+		t.Errorf("expected Update of a row not read in the Tx to return an error")
+	}
+}
+
+func TestScanLSN(t *testing.T) {
+	db := open(t)
+	v, _ := LSN(nil)
+	err := db.QueryRow(`SELECT pg_current_wal_lsn()`).Scan(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.IsNull() || v.(LSNValue).LSN() == 0 {
+		t.Errorf("expected a WAL location got: %v", v)
+	}
+}
+
+func TestGetBy(t *testing.T) {
+	db := open(t)
+	v, err := db.New("membership", []interface{}{2, 200, "guest", nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Insert(v); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(v)
+	v, err = db.From("membership").GetBy(map[string]interface{}{
+		"person_id":   "2",
+		"location_id": 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	getEq(t, v, "role", "guest", "after GetBy")
+	_, err = db.From("membership").GetBy(map[string]interface{}{"person_id": 2})
+	if err == nil {
+		t.Errorf("expected GetBy on part of a composite key to return an error")
+	}
+	_, err = db.From("membership").GetBy(map[string]interface{}{"person_id": 3, "location_id": 200})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got: %v", err)
+	}
+}
+
+func TestResolveReg(t *testing.T) {
+	db := open(t)
+	v, _ := RegClass(nil)
+	err := db.QueryRow(`SELECT 'person'::regclass`).Scan(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := v.(RegValue)
+	if err = db.Resolve(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name() != "person" || r.Oid() == 0 {
+		t.Errorf("expected both name and oid got: %s %d", r.Name(), r.Oid())
+	}
+}
+
+func TestRelationIsEmptyApproxCount(t *testing.T) {
+	db := open(t)
+	if _, err := db.DB.Exec(`ANALYZE person`); err != nil {
+		t.Fatal(err)
+	}
+	rel, err := db.Relation("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := db.From("person").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := rel.IsEmpty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty != (count == 0) {
+		t.Errorf("expected IsEmpty to be %v", count == 0)
+	}
+	n, err := rel.ApproxCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != count {
+		t.Errorf("expected approx count of %d got: %d", count, n)
+	}
+}
+
+func TestFetchMap(t *testing.T) {
+	db := open(t)
+	m, err := db.From("person").Where("id <= $1", 3).FetchMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m[int64(3)].Get("name").(string) != "alice" {
+		t.Errorf("unexpected map: %v", m)
+	}
+	m, err = db.From("person").Where("id <= $1", 3).FetchMapBy("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["bob"] == nil {
+		t.Errorf("expected bob to be keyed by name: %v", m)
+	}
+	if _, err = db.From("person").Where("id <= $1", 3).FetchMapBy("location_id"); err == nil {
+		t.Errorf("expected duplicate keys to return an error")
+	}
+}
+
+func TestFetchGrouped(t *testing.T) {
+	db := open(t)
+	m, err := db.From("person").Where("id <= $1", 3).FetchGrouped("location_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m[int64(100)]) != 2 || len(m[int64(200)]) != 1 {
+		t.Errorf("unexpected groups: %v", m)
+	}
+	if _, err = db.From("person").FetchGrouped("nope"); err == nil {
+		t.Errorf("expected unknown column to return an error")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	db := open(t)
+	rs, err := db.Parallel(
+		db.From("person").Where("id = $1", 1),
+		db.From("location"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || len(rs[0]) != 1 || len(rs[1]) == 0 {
+		t.Errorf("unexpected results: %v", rs)
+	}
+	_, err = db.Parallel(
+		db.From("person").Where("pg_sleep(5) IS NULL"),
+		db.From("person").Where("nope = $1", 1),
+	)
+	if err == nil {
+		t.Errorf("expected failing query to return an error")
+	}
+}
+
+func TestStream(t *testing.T) {
+	db := open(t)
+	var b strings.Builder
+	err := db.From("person").Where("id <= $1", 3).Stream(context.Background(), &b, CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 4 {
+		t.Errorf("expected a header and 3 rows got:\n%s", b.String())
+	}
+	b.Reset()
+	err = db.From("person").Where("id = $1", 1).
+		Select("name").
+		SelectExpr("upper(name) AS shout").
+		Stream(context.Background(), &b, CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 2 || !strings.Contains(b.String(), "bob") {
+		t.Errorf("expected a header and bob got:\n%s", b.String())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = db.From("person").Stream(ctx, &b, NDJSON)
+	if err == nil {
+		t.Errorf("expected cancelled context to return an error")
+	}
+}
+
+func TestResultHash(t *testing.T) {
+	db := open(t)
+	h1, err := db.From("person").Where("id <= $1", 3).ResultHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := db.From("person").Where("id IN (3,2,1)").ResultHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == "" || h1 != h2 {
+		t.Errorf("expected the same rows to hash the same got %s and %s", h1, h2)
+	}
+	h3, err := db.From("person").Where("id = $1", 1).ResultHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h3 == h1 {
+		t.Errorf("expected different rows to hash differently")
+	}
+}
+
+func TestColumnAlias(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("log_entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := rel.New([]interface{}{"hi", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"message":"hi","level":1}` {
+		t.Errorf("expected alias from column comment got: %s", b)
+	}
+}
+
+func TestRecordParam(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").Where("id = $1", 1).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 {
+		t.Fatalf("expected 1 person got %d", len(vs))
+	}
+	vs[0].Set("location_id", nil)
+	rs, err := db.Query(`SELECT ($1).name, ($1).location_id IS NULL`, vs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	var name string
+	var null bool
+	for rs.Next() {
+		err = rs.Scan(&name, &null)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if name != "bob" || !null {
+		t.Errorf("expected record param to be cast to person got: %s %v", name, null)
+	}
+}
+
+func TestJoined(t *testing.T) {
+	db := open(t)
+	_, err := db.DB.Exec(`INSERT INTO person (id, name) VALUES (50, 'homeless')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB.Exec(`DELETE FROM person WHERE id = 50`)
+	rows, err := db.NamedSQL(`SELECT p, l FROM person p LEFT JOIN location l ON l.id = p.location_id
+		WHERE p.id IN (:ids) ORDER BY p.id`, Params{"ids": []int{1, 50}}).Joined("person", "location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows got %d", len(rows))
+	}
+	if rows[0][0].Get("name") != "bob" || rows[0][1].Get("name") != "g1" {
+		t.Errorf("expected bob in g1 got: %v %v", rows[0][0].Val(), rows[0][1].Val())
+	}
+	if rows[1][0].Get("name") != "homeless" || !rows[1][1].IsNull() {
+		t.Errorf("expected a NULL location for the outer join miss got: %v", rows[1][1].Val())
+	}
+	if rows[0][1].Relation().Name != "location" {
+		t.Errorf("expected records to know their relation")
+	}
+}
+
+func TestFetchStructs(t *testing.T) {
+	db := open(t)
+	var ps []testPerson
+	err := db.From("person").Where("id <= $1", 3).FetchStructs(&ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 || ps[0].Name == "" || ps[0].LocationID == 0 {
+		t.Errorf("expected 3 people got: %+v", ps)
+	}
+	var pps []*testPerson
+	err = db.From("person").Where("id = $1", 1).FetchStructs(&pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pps) != 1 || pps[0].Name != "bob" || *pps[0].Age != 19 {
+		t.Errorf("expected bob got: %+v", pps)
+	}
+	rs, err := db.Query(`SELECT id, name, 'x' AS unknown FROM person WHERE id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	var p testPerson
+	for rs.Next() {
+		err = rs.ScanStruct(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.ID != 1 || p.Name != "bob" {
+		t.Errorf("expected raw rows to scan into struct got: %+v", p)
+	}
+}
+
+func TestInsertFromStruct(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	age := 44
+	v, err := rel.FromStruct(testPerson{ID: 60, Name: "structed", Age: &age, LocationID: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Insert(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(v)
+	got, err := db.From("person").Get(60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("name") != "structed" || got.Get("age") != int64(44) {
+		t.Errorf("expected inserted struct got: %s", got)
+	}
+}
+
+func TestForUpdateOfInTx(t *testing.T) {
+	db := open(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	vs, err := tx.From("person").
+		Where("location_id IN (SELECT id FROM location WHERE name = $1)", "g1").
+		ForUpdateOf("person").
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) == 0 {
+		t.Errorf("expected locked rows to be returned")
+	}
+}
+
+func TestForUpdateSkipLocked(t *testing.T) {
+	db := open(t)
+	tx1, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	tx2, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx2.Rollback()
+	claimed, err := tx1.From("person").Where("id <= 3").OrderBy("id").Limit(1).ForUpdate(SkipLocked).FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := tx2.From("person").Where("id <= 3").OrderBy("id").Limit(1).ForUpdate(SkipLocked).FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || next == nil || claimed.Get("id") == next.Get("id") {
+		t.Errorf("expected each transaction to claim a different row got: %v %v", claimed, next)
+	}
+	_, err = tx2.From("person").Where("id = $1", claimed.Get("id")).ForUpdate(NoWait).Fetch()
+	if err == nil {
+		t.Errorf("expected NoWait on a locked row to fail")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	db := open(t)
+	l, err := db.Loader("person", 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := l.Load(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name") != "jeff" {
+		t.Errorf("expected jeff got: %v", v.Get("name"))
+	}
+	if _, err = db.Loader("log_entry", time.Millisecond); err == nil {
+		t.Errorf("expected a relation without a primary key to fail")
+	}
+}
+
+func TestFieldsPreload(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").
+		Where("id IN (1,3)").
+		Fields("name", "location.name").
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 {
+		t.Fatalf("expected 2 people got: %d", len(vs))
+	}
+	for _, v := range vs {
+		if !v.ValueBy("age").IsNull() {
+			t.Errorf("expected unselected age to be NULL")
+		}
+		locs := v.Related("location")
+		if len(locs) != 1 || locs[0].Get("name") == nil {
+			t.Errorf("expected a preloaded location got: %v", locs)
+		}
+	}
+	ls, err := db.From("location").Where("id = 100").Preload("person").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || len(ls[0].Related("person")) != 2 {
+		t.Errorf("expected location 100 to have 2 people preloaded")
+	}
+}
+
+func TestRegisterTypeByName(t *testing.T) {
+	RegisterTypeByName("positive_int", func(args ...string) (ToValue, error) {
+		return Text, nil
+	})
+	defer func() {
+		typsMu.Lock()
+		delete(typsByName, "positive_int")
+		typsMu.Unlock()
+	}()
+	db := open(t)
+	k, err := db.Type("positive_int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := k(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(*pgText); !ok {
+		t.Errorf("expected registered Text got: %T", v)
+	}
+}
+
+func TestColumnDefaults(t *testing.T) {
+	db := open(t)
+	v, err := db.New("token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name") != "unnamed" {
+		t.Errorf("expected literal default to be filled in got: %v", v.Get("name"))
+	}
+	if !v.ValueBy("id").IsNull() {
+		t.Errorf("expected expression default to be left NULL")
+	}
+	if err = db.Insert(v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ValueBy("id").IsNull() {
+		t.Errorf("expected id to be set by its default")
+	}
+}
+
+func TestChecksumRange(t *testing.T) {
+	db := open(t)
+	rel, err := db.Relation("person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := rel.ChecksumRange(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Rows != 3 || a.Sum == "" {
+		t.Errorf("unexpected checksum: %+v", a)
+	}
+	b, err := rel.ChecksumRange(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Sum == a.Sum {
+		t.Errorf("expected different ranges to have different checksums")
+	}
+	ok, err := rel.VerifyRange(db, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("expected a relation to match itself")
+	}
+}
+
+func TestDualWriter(t *testing.T) {
+	db := open(t)
+	// mirroring to the same db makes every secondary insert a duplicate
+	dw := NewDualWriter(db, db)
+	var failed int
+	dw.OnError(func(target *DB, err error) { failed++ })
+	v, err := db.New("location", []interface{}{900, "dual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dw.Insert(v); err != nil {
+		t.Fatal(err)
+	}
+	st := dw.Stats()
+	if st.Writes != 1 || st.SecondaryErrors != 1 || failed != 1 {
+		t.Errorf("expected the secondary error to be counted got: %+v", st)
+	}
+	if err = v.Set("name", "dual2"); err != nil {
+		t.Fatal(err)
+	}
+	dw.SetPolicy(MustWrite, MustWrite)
+	if err = dw.Update(v); err != nil {
+		t.Fatal(err)
+	}
+	if st = dw.Stats(); st.Mirrored != 1 {
+		t.Errorf("expected the update to be mirrored got: %+v", st)
+	}
+	v2, err := db.New("location", []interface{}{901, "dual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dw.Insert(v2); err == nil {
+		t.Errorf("expected secondary error to be returned with MustWrite")
+	}
+}
+
+func TestShadowReads(t *testing.T) {
+	db := open(t)
+	var diffs []*ShadowDiff
+	var mu sync.Mutex
+	db.ShadowReads(db, func(d *ShadowDiff) {
+		mu.Lock()
+		defer mu.Unlock()
+		diffs = append(diffs, d)
+	})
+	if _, err := db.From("person").Get(1); err != nil {
+		t.Fatal(err)
+	}
+	db.StopShadowReads()
+	if len(diffs) != 0 {
+		t.Errorf("expected a DB to match itself got: %+v", diffs[0])
+	}
+}
+
+func TestOrderByFetch(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").Where("id IN (1,2,3)").OrderBy("age", Desc).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 3 || vs[0].Get("name") != "jeff" || vs[2].Get("name") != "alice" {
+		t.Errorf("expected people oldest first got: %v", vs)
+	}
+	n, err := db.From("person").OrderBy("age").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Errorf("expected count to ignore the order")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	db := open(t)
+	q := db.From("person").Where("id IN (1,2,3)")
+	p, err := q.Paginate(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 3 || p.Pages != 2 || !p.HasNext || p.HasPrev || len(p.Records) != 2 {
+		t.Errorf("unexpected first page: %+v", p)
+	}
+	next, err := q.After(p.Next).Limit(2).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].Get("id") != int64(3) {
+		t.Errorf("expected the cursor to fetch the last person got: %v", next)
+	}
+	p, err = q.Paginate(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := q.Before(p.Prev).Limit(2).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prev) != 2 || prev[0].Get("id") != int64(1) {
+		t.Errorf("expected the cursor to fetch the first page got: %v", prev)
+	}
+	p, err = q.Paginate(5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 3 || len(p.Records) != 0 || p.HasNext {
+		t.Errorf("unexpected page past the end: %+v", p)
+	}
+}
+
+func TestSelectPartialUpdate(t *testing.T) {
+	db := open(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	v, err := tx.From("person").Select("name").Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsPartial() || !v.ValueBy("age").IsNull() {
+		t.Fatalf("expected a partial record")
+	}
+	if err = v.Set("name", "jeffrey"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Update(v); err != nil {
+		t.Fatal(err)
+	}
+	full, err := tx.From("person").Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Get("name") != "jeffrey" || full.ValueBy("age").IsNull() {
+		t.Errorf("expected only the name to be updated got: %v", full)
+	}
+}
+
+func TestSampleWeighted(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").Where("id IN (1,2,3)").SampleWeighted("age", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 {
+		t.Errorf("expected 2 sampled people got: %d", len(vs))
+	}
+}
+
+func TestMergeExecActions(t *testing.T) {
+	db := open(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	a, err := db.New("location", []interface{}{100, "g1-renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.New("location", []interface{}{950, "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions, err := tx.MergeInto("location").Using(a, b).On("id").
+		WhenMatchedUpdate().WhenNotMatchedInsert().ExecActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0] != MergeUpdated || actions[1] != MergeInserted {
+		t.Errorf("expected updated then inserted got: %v", actions)
+	}
+}
+
+func TestJoinRef(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").JoinRef("location").Where("location.name = $1", "g2").Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Get("name") != "alice" {
+		t.Errorf("expected alice to be the only person in g2 got: %v", vs)
+	}
+}
+
+func TestWhereCondOr(t *testing.T) {
+	db := open(t)
+	n, err := db.From("person").
+		WhereCond(Or(Cond("name = $1", "bob"), Cond("name = $1", "alice"))).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected bob or alice to match 2 people got: %d", n)
+	}
+}
+
+func TestWhereInFetch(t *testing.T) {
+	db := open(t)
+	n, err := db.From("person").WhereIn("id", []int{1, 3}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 people got: %d", n)
+	}
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	db := open(t)
+	fp, err := db.SchemaFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2, err := Open("dbname=pql_test sslmode=disable", ExpectSchema(fp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2.Close()
+	_, err = Open("dbname=pql_test sslmode=disable", ExpectSchema("stale"))
+	if !errors.Is(err, ErrSchemaDrift) {
+		t.Errorf("expected a different fingerprint to fail with ErrSchemaDrift got: %v", err)
+	}
+	db3, err := Open("dbname=pql_test sslmode=disable", WarnSchemaDrift("stale"))
+	if err != nil {
+		t.Errorf("expected WarnSchemaDrift not to fail got: %v", err)
+	} else {
+		db3.Close()
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	db := open(t)
+	q := db.From("person").Where("id <= 3").OrderBy("age")
+	first, err := q.First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := q.Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == nil || last == nil || first.Get("name") != "bob" || last.Get("name") != "alice" {
+		t.Errorf("unexpected first and last: %v %v", first, last)
+	}
+	none, err := db.From("person").Where("id < 0").First()
+	if err != nil || none != nil {
+		t.Errorf("expected no record got: %v %v", none, err)
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	db := open(t)
+	v, err := db.New("token", []interface{}{nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertReturning(v, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ValueBy("id").IsNull() {
+		t.Fatal("expected id to be returned")
+	}
+	if !v.ValueBy("name").IsNull() {
+		t.Errorf("expected name not to be returned got: %v", v.Get("name"))
+	}
+	v.Set("name", "renamed")
+	err = db.UpdateReturning(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.InsertReturning(v, "nope"); err == nil {
+		t.Errorf("expected returning an unknown column to fail")
+	}
+}
+
+func TestSelectExprFetch(t *testing.T) {
+	db := open(t)
+	v, err := db.From("person").
+		SelectExpr("upper(name) AS name", "age * 2 AS double_age").
+		Raw("id = $1", 1).
+		FetchOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v == nil {
+		t.Fatal("expected a record")
+	}
+	if v.Get("name") != "BOB" {
+		t.Errorf("expected name to be fetched from the expression got: %v", v.Get("name"))
+	}
+	if v.Extra("double_age") != int64(38) {
+		t.Errorf("expected double_age to be 38 got: %#v", v.Extra("double_age"))
+	}
+}
+
+func TestSubqueryFetch(t *testing.T) {
+	db := open(t)
+	n, err := db.From("person").
+		Where("location_id IN $1", db.From("location").Select("id").Where("id = $1", 100)).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 2 {
+		t.Errorf("expected at least 2 people at location 100 got: %d", n)
+	}
+}
+
+func TestWhereQuestionFetch(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").
+		Where("age > ? AND location_id IN ?", 18, db.From("location").Select("id").Where("name = ?", "g1")).
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Get("name") != "jeff" {
+		t.Errorf("expected jeff got: %v", vs)
+	}
+}
+
+func TestWithFetch(t *testing.T) {
+	db := open(t)
+	vs, err := db.From("person").
+		With("g1", db.From("location").Select("id").Where("name = $1", "g1")).
+		Where("location_id IN (SELECT id FROM g1)").
+		OrderBy("id").
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[0].Get("name") != "bob" || vs[1].Get("name") != "jeff" {
+		t.Errorf("expected bob and jeff got: %v", vs)
+	}
+	vs, err = db.From("person").
+		WithRecursive("older", db.From("person").Where("id = $1", 3), "person.age = older.age + 2 AND person.id <= 3").
+		Where("id IN (SELECT id FROM older)").
+		OrderBy("id").
+		Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[0].Get("name") != "bob" || vs[1].Get("name") != "alice" {
+		t.Errorf("expected bob and alice got: %v", vs)
+	}
+}
+
+func TestUnionFetch(t *testing.T) {
+	db := open(t)
+	q := db.From("person").Where("id = $1", 1).
+		Union(db.From("person").Where("id = $1 OR id = $2", 1, 3)).
+		OrderBy("id", Desc)
+	vs, err := q.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[0].Get("name") != "alice" || vs[1].Get("name") != "bob" {
+		t.Errorf("expected alice and bob got: %v", vs)
+	}
+	n, err := q.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the union to count 2 got: %d", n)
+	}
+}
+
+func TestEstimatedCount(t *testing.T) {
+	db := open(t)
+	_, err := db.DB.Exec(`ANALYZE person`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.From("person").EstimatedCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1 {
+		t.Errorf("expected a positive estimate got: %d", n)
+	}
+	n, err = db.From("person").Where("age > $1", 18).EstimatedCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1 {
+		t.Errorf("expected a positive estimate got: %d", n)
+	}
+}
+
+func TestIter(t *testing.T) {
+	db := open(t)
+	it, err := db.From("person").Where("id <= 3").OrderBy("id").Iter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var names []string
+	for it.Next() {
+		names = append(names, it.Record().Get("name").(string))
+	}
+	if err = it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "bob,jeff,alice" {
+		t.Errorf("unexpected records: %v", names)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	db := open(t)
+	p, err := db.From("person").Where("age > $1", 17).Explain(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NodeType == "" || p.ActualLoops == 0 {
+		t.Errorf("expected an analyzed plan got: %+v", p)
+	}
+	found := false
+	p.Walk(func(n *Plan) {
+		if n.Relation == "person" {
+			found = true
+		}
+	})
+	if !found {
+		t.Errorf("expected the plan to read person got:\n%s", p)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	db := open(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := db.From("person").Where("pg_sleep(5) IS NULL").FetchContext(ctx)
+	if err == nil {
+		t.Errorf("expected the deadline to cancel the query")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("expected the query to stop at the deadline took %v", time.Since(start))
+	}
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	v, err := db.From("person").Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.UpdateContext(context.Background(), v); err == nil {
+		t.Errorf("expected an update in a READ ONLY transaction to fail")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db := open(t)
+	start := time.Now()
+	_, err := db.From("person").Where("pg_sleep(5) IS NULL").Timeout(50 * time.Millisecond).Fetch()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the query to time out got: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("expected the query to stop at the timeout took %v", time.Since(start))
+	}
+	n, err := db.From("person").Timeout(time.Minute).Count()
+	if err != nil || n != 3 {
+		t.Errorf("expected 3 people got: %d %v", n, err)
+	}
+}
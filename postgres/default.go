@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+)
+
+// regexp to match the trailing casts of a default ie "::character varying"
+var castsPat = regexp.MustCompile(`^(?:::[\w ]+(?:\(\d+(?:,\d+)?\))?(?:\[\])*)*$`)
+
+// regexp to match a (possibly negative) numeric default ie "(-1)" or "2.5"
+var numberPat = regexp.MustCompile(`^\(?(-?\d+(?:\.\d+)?)\)?`)
+
+// parse the pg_attrdef expression of a column default into its literal
+// value. Returns false for defaults that are expressions (ie now() or
+// nextval(...)) so are only known once the row is written
+func parseDefault(expr string) (string, bool) {
+	expr = strings.TrimSpace(expr)
+	var lit, rest string
+	switch {
+	case strings.HasPrefix(expr, "'"):
+		var b strings.Builder
+		i := 1
+		for ; i < len(expr); i++ {
+			if expr[i] == '\'' {
+				if i+1 < len(expr) && expr[i+1] == '\'' {
+					i++
+				} else {
+					break
+				}
+			}
+			b.WriteByte(expr[i])
+		}
+		if i >= len(expr) {
+			return "", false
+		}
+		lit, rest = b.String(), expr[i+1:]
+	case strings.HasPrefix(expr, "true"), strings.HasPrefix(expr, "false"):
+		lit = strings.SplitN(expr, ":", 2)[0]
+		rest = expr[len(lit):]
+	default:
+		m := numberPat.FindStringSubmatch(expr)
+		if m == nil {
+			return "", false
+		}
+		lit, rest = m[1], expr[len(m[0]):]
+	}
+	if !castsPat.MatchString(rest) {
+		return "", false
+	}
+	return lit, true
+}
+
+// set the Value of the column default (if it is a literal)
+func (c *col) setDefault(expr string) {
+	c.def = expr
+	c.defv = nil
+	if lit, ok := parseDefault(expr); ok {
+		if v, err := c.k(lit); err == nil {
+			c.defv = v
+		}
+	}
+}
+
+// fill the NULL columns of v with their literal defaults and mark
+// the columns with a default expression to be left to the server
+func (r *Relation) setDefaults(v RecordValue) {
+	k, ok := v.(*pgRecord)
+	if !ok {
+		return
+	}
+	for i, c := range k.cs {
+		if c.def == "" || !k.vs[i].IsNull() {
+			continue
+		}
+		if c.defv != nil {
+			k.vs[i] = c.defv.Clone()
+			continue
+		}
+		if k.defaulted == nil {
+			k.defaulted = make(map[string]bool)
+		}
+		k.defaulted[c.name] = true
+	}
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// SQL to list non-unique indexes that have never been scanned
+	selectUnusedIndexesSql = `
+		SELECT
+			s.relname,
+			s.indexrelname,
+			pg_relation_size(s.indexrelid)
+		FROM pg_stat_user_indexes s
+		JOIN pg_index i ON i.indexrelid = s.indexrelid
+		WHERE s.idx_scan = 0
+		AND NOT i.indisunique
+		AND NOT i.indisprimary
+		AND s.schemaname = 'public'
+		ORDER BY 3 DESC
+	`
+	// SQL to list tables read more often by sequential scan than by index
+	selectSeqScannedSql = `
+		SELECT
+			relname,
+			seq_scan,
+			COALESCE(idx_scan, 0),
+			n_live_tup
+		FROM pg_stat_user_tables
+		WHERE schemaname = 'public'
+		AND seq_scan > COALESCE(idx_scan, 0)
+		ORDER BY seq_tup_read DESC
+	`
+	// SQL to list sessions waiting on locks held by other sessions
+	selectBlockingSql = `
+		SELECT
+			a.pid,
+			a.usename,
+			a.query,
+			EXTRACT(EPOCH FROM now() - a.query_start)::float8,
+			b.pid,
+			b.usename,
+			b.query,
+			b.state,
+			EXTRACT(EPOCH FROM now() - b.query_start)::float8
+		FROM pg_stat_activity a
+		JOIN pg_stat_activity b ON b.pid = ANY(pg_blocking_pids(a.pid))
+		ORDER BY 4 DESC
+	`
+)
+
+// the shape of the records returned by DB.Blocking
+// durations are in seconds
+var blockingRecord = Record(
+	Col("blocked_pid", Integer),
+	Col("blocked_user", Text),
+	Col("blocked_query", Text),
+	Col("blocked_duration", Double),
+	Col("blocking_pid", Integer),
+	Col("blocking_user", Text),
+	Col("blocking_query", Text),
+	Col("blocking_state", Text),
+	Col("blocking_duration", Double),
+)
+
+// keeps a count of the WHERE filters used by Queries per relation
+type queryPatterns struct {
+	mu sync.Mutex
+	m  map[string]map[string]int64 // relation -> filter -> count
+}
+
+func (p *queryPatterns) record(q *Query) {
+	if len(q.where) == 0 {
+		return
+	}
+	filter := strings.Join(q.where, " AND ")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fs, ok := p.m[q.from.Name]
+	if !ok {
+		fs = make(map[string]int64)
+		p.m[q.from.Name] = fs
+	}
+	fs[filter]++
+}
+
+func (p *queryPatterns) filters(rel string) []Filter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fs := make([]Filter, 0, len(p.m[rel]))
+	for expr, n := range p.m[rel] {
+		fs = append(fs, Filter{expr, n})
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].Count > fs[j].Count
+	})
+	return fs
+}
+
+// Start recording the WHERE filters of Queries built from this DB
+// so they can be included in IndexAdvice. Intended as a development aid
+func (db *DB) TrackQueryPatterns() {
+	if db.patterns == nil {
+		db.patterns = &queryPatterns{m: make(map[string]map[string]int64)}
+	}
+}
+
+// A WHERE filter and the number of times it was used
+type Filter struct {
+	Expr  string
+	Count int64
+}
+
+// An index that has never been used by the planner
+type UnusedIndex struct {
+	Relation string
+	Index    string
+	Size     int64 // bytes on disk
+}
+
+// A relation read mostly by sequential scans
+type SeqScanned struct {
+	Relation   string
+	SeqScans   int64
+	IdxScans   int64
+	LiveTuples int64
+	Filters    []Filter // recorded filters for this relation (most used first)
+}
+
+// IndexReport is the result of DB.IndexAdvice
+type IndexReport struct {
+	Unused     []UnusedIndex
+	SeqScanned []SeqScanned
+}
+
+// Report indexes that are never used and relations that are mostly
+// sequentially scanned, along with the filters the application used on
+// them (see TrackQueryPatterns). Stats are cumulative since the last
+// stats reset so results are only meaningful after a representative workload
+func (db *DB) IndexAdvice() (*IndexReport, error) {
+	report := &IndexReport{
+		Unused:     make([]UnusedIndex, 0),
+		SeqScanned: make([]SeqScanned, 0),
+	}
+	rows, err := db.Query(selectUnusedIndexesSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ix UnusedIndex
+		err = rows.Scan(&ix.Relation, &ix.Index, &ix.Size)
+		if err != nil {
+			return nil, err
+		}
+		report.Unused = append(report.Unused, ix)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+	rows, err = db.Query(selectSeqScannedSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ss SeqScanned
+		err = rows.Scan(&ss.Relation, &ss.SeqScans, &ss.IdxScans, &ss.LiveTuples)
+		if err != nil {
+			return nil, err
+		}
+		if db.patterns != nil {
+			ss.Filters = db.patterns.filters(ss.Relation)
+		}
+		report.SeqScanned = append(report.SeqScanned, ss)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return report, rows.Close()
+}
+
+// Return a record for each session that is waiting on a lock along with
+// the session blocking it (one record per blocker). Records have the columns:
+// blocked_pid, blocked_user, blocked_query, blocked_duration, blocking_pid,
+// blocking_user, blocking_query, blocking_state and blocking_duration
+// where durations are seconds since the query started
+func (db *DB) Blocking() ([]RecordValue, error) {
+	rs, err := db.Query(selectBlockingSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	all := make([]RecordValue, 0)
+	for rs.Next() {
+		v, err := blockingRecord(nil)
+		if err != nil {
+			return nil, err
+		}
+		rv := v.(RecordValue)
+		err = rs.ScanRecord(rv)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, rv)
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	return all, rs.Close()
+}
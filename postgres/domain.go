@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Domain wraps the ToValue of a domain's base type so that NULLs
+// are rejected when the Value is written like a NOT NULL domain.
+// Any typmod (ie varchar(n)) is enforced by the base type's Value
+func Domain(name string, base ToValue) ToValue {
+	return func(data interface{}) (Value, error) {
+		v, err := base(data)
+		if err != nil {
+			return nil, err
+		}
+		return &pgDomain{v: v, name: name}, nil
+	}
+}
+
+type pgDomain struct {
+	v    Value
+	name string
+}
+
+func (k *pgDomain) Scan(src interface{}) error {
+	return k.v.Scan(src)
+}
+
+func (k *pgDomain) IsNull() bool {
+	return k.v.IsNull()
+}
+
+func (k *pgDomain) Value() (driver.Value, error) {
+	if k.v.IsNull() {
+		return nil, fmt.Errorf("domain %s does not allow NULL values", k.name)
+	}
+	return k.v.Value()
+}
+
+func (k *pgDomain) bytes() ([]byte, error) {
+	if k.v.IsNull() {
+		return nil, fmt.Errorf("domain %s does not allow NULL values", k.name)
+	}
+	return k.v.bytes()
+}
+
+func (k *pgDomain) String() string {
+	return k.v.String()
+}
+
+func (k *pgDomain) Val() interface{} {
+	return k.v.Val()
+}
+
+func (k *pgDomain) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// return the underlying Value of the base type
+func (k *pgDomain) Base() Value {
+	return k.v
+}
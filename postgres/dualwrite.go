@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WritePolicy controls what a DualWriter does when a write to one
+// of its targets fails
+type WritePolicy int
+
+const (
+	// errors writing to the target are returned
+	MustWrite WritePolicy = iota
+	// errors writing to the target are counted (and passed to the
+	// OnError handler) but not returned
+	TryWrite
+)
+
+// DualWriteStats counts the writes made by a DualWriter
+type DualWriteStats struct {
+	Writes          int64         // Insert/Update/Delete calls
+	Mirrored        int64         // calls successfully written to the secondary
+	PrimaryErrors   int64         // failed writes to the primary
+	SecondaryErrors int64         // failed writes to the secondary
+	LastLag         time.Duration // delay between the primary and secondary writes completing
+	MaxLag          time.Duration
+}
+
+// DualWriter mirrors Insert, Update and Delete to two databases, ie while
+// migrating from one database to another. Reads should stay on Primary.
+// Records are written to the primary first then copied (by column name)
+// into the relation of the same name on the secondary, so keys filled in
+// by the primary (ie serial ids) are written to both
+type DualWriter struct {
+	primary   *DB
+	secondary *DB
+	policies  [2]WritePolicy
+	onError   func(db *DB, err error)
+	mu        sync.Mutex
+	stats     DualWriteStats
+}
+
+// Return a DualWriter that returns errors from the primary
+// and only counts errors from the secondary
+func NewDualWriter(primary, secondary *DB) *DualWriter {
+	return &DualWriter{
+		primary:   primary,
+		secondary: secondary,
+		policies:  [2]WritePolicy{MustWrite, TryWrite},
+	}
+}
+
+// Set the error policy of each target. If the primary write fails
+// with MustWrite the write is not mirrored to the secondary
+func (dw *DualWriter) SetPolicy(primary, secondary WritePolicy) {
+	dw.policies = [2]WritePolicy{primary, secondary}
+}
+
+// Call fn with the target and error of each failed write
+func (dw *DualWriter) OnError(fn func(db *DB, err error)) {
+	dw.onError = fn
+}
+
+// The primary DB (to read from)
+func (dw *DualWriter) Primary() *DB {
+	return dw.primary
+}
+
+// Return a snapshot of the write counts
+func (dw *DualWriter) Stats() DualWriteStats {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.stats
+}
+
+func (dw *DualWriter) Insert(vs ...RecordValue) error {
+	return dw.write(vs, (*DB).Insert)
+}
+
+func (dw *DualWriter) Update(vs ...RecordValue) error {
+	return dw.write(vs, (*DB).Update)
+}
+
+func (dw *DualWriter) Delete(vs ...RecordValue) error {
+	return dw.write(vs, (*DB).Delete)
+}
+
+func (dw *DualWriter) write(vs []RecordValue, fn func(*DB, ...RecordValue) error) error {
+	dw.count(func(st *DualWriteStats) { st.Writes++ })
+	err := fn(dw.primary, vs...)
+	if err != nil {
+		dw.count(func(st *DualWriteStats) { st.PrimaryErrors++ })
+		dw.failed(dw.primary, err)
+		if dw.policies[0] == MustWrite {
+			return err
+		}
+	}
+	done := time.Now()
+	mvs, err := dw.mirror(vs)
+	if err == nil {
+		err = fn(dw.secondary, mvs...)
+	}
+	lag := time.Since(done)
+	if err != nil {
+		dw.count(func(st *DualWriteStats) { st.SecondaryErrors++ })
+		dw.failed(dw.secondary, err)
+		if dw.policies[1] == MustWrite {
+			return fmt.Errorf("secondary write failed: %w", err)
+		}
+		return nil
+	}
+	dw.count(func(st *DualWriteStats) {
+		st.Mirrored++
+		st.LastLag = lag
+		if lag > st.MaxLag {
+			st.MaxLag = lag
+		}
+	})
+	return nil
+}
+
+func (dw *DualWriter) count(fn func(st *DualWriteStats)) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	fn(&dw.stats)
+}
+
+func (dw *DualWriter) failed(db *DB, err error) {
+	if dw.onError != nil {
+		dw.onError(db, err)
+	}
+}
+
+// copy the records into the matching relations of the secondary.
+// Columns missing from the primary record are left NULL
+func (dw *DualWriter) mirror(vs []RecordValue) ([]RecordValue, error) {
+	mvs := make([]RecordValue, len(vs))
+	for i, v := range vs {
+		if v.Relation() == nil {
+			return nil, errors.New("RecordValue does not have a relation set")
+		}
+		rel, err := dw.secondary.Relation(v.Relation().Name)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, len(rel.cols))
+		for j, c := range rel.cols {
+			pv := v.ValueBy(c.name)
+			if pv == nil {
+				continue
+			}
+			vals[j], err = pv.Value()
+			if err != nil {
+				return nil, err
+			}
+		}
+		mvs[i], err = rel.New(vals)
+		if err != nil {
+			return nil, fmt.Errorf("cannot copy %s record to secondary: %v", rel.Name, err)
+		}
+	}
+	return mvs, nil
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestDualWriterMirror(t *testing.T) {
+	src := testRelation()
+	// the secondary has the columns in a different order and an extra one
+	cols := []*col{
+		Col("name", Text),
+		Col("id", BigInt),
+		Col("email", Text),
+		Col("age", Integer),
+		Col("tags", Array(Text)),
+	}
+	cols[1].pk = true
+	dst := &Relation{Name: "person", k: Record(cols...), cols: cols}
+	dw := NewDualWriter(nil, &DB{rels: map[string]*Relation{"person": dst}})
+	v, err := src.New([]interface{}{7, "bob", 20, []interface{}{"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mvs, err := dw.mirror([]RecordValue{v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mvs[0]
+	if m.Relation() != dst {
+		t.Errorf("expected mirrored record to belong to the secondary relation")
+	}
+	if m.Get("id") != int64(7) || m.Get("name") != "bob" || m.ValueBy("tags").String() != `{"x"}` {
+		t.Errorf("unexpected mirrored record: %v", m)
+	}
+	if !m.ValueBy("email").IsNull() {
+		t.Errorf("expected a column missing from the primary to be NULL")
+	}
+	if _, err = dw.mirror([]RecordValue{Must(Record(cols...)(nil)).(RecordValue)}); err == nil {
+		t.Errorf("expected a record without a relation to fail")
+	}
+}
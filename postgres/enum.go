@@ -80,3 +80,10 @@ func (k *pgEnum) Val() interface{} {
 	}
 	return k.s
 }
+
+func (k *pgEnum) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
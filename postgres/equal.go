@@ -0,0 +1,578 @@
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// A Value with a natural order
+type OrderedValue interface {
+	Value
+	// Compare returns -1, 0 or +1 if the Value is less than, equal to
+	// or greater than other. NULL sorts after everything (as it does
+	// in postgres). Comparing different kinds is an error
+	Compare(other Value) (int, error)
+}
+
+// check NULLs: done is true if either is NULL and eq says if both are
+func nullEqual(a, b Value) (done bool, eq bool) {
+	if a.IsNull() || b.IsNull() {
+		return true, a.IsNull() && b.IsNull()
+	}
+	return false, false
+}
+
+func equalValues(a, b []Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// order NULLs last then compare using cmp
+func compareNull(a, b Value, cmp func() int) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return 1
+	case b.IsNull():
+		return -1
+	}
+	return cmp()
+}
+
+// -1 if less, +1 if greater else 0
+func compareOrder(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func cmpErr(a, b Value) error {
+	return fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+func (k *pgArray) Equal(other Value) bool {
+	o, ok := other.(*pgArray)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	for dim := 1; dim <= len(k.lower) || dim <= len(o.lower); dim++ {
+		if k.Lower(dim) != o.Lower(dim) {
+			return false
+		}
+	}
+	return equalValues(k.vs, o.vs)
+}
+
+func (k *pgBool) Equal(other Value) bool {
+	o, ok := other.(*pgBool)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.b == o.b
+}
+
+// false sorts before true
+func (k *pgBool) Compare(other Value) (int, error) {
+	o, ok := other.(*pgBool)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		switch {
+		case k.b == o.b:
+			return 0
+		case k.b:
+			return 1
+		}
+		return -1
+	}), nil
+}
+
+func (k *pgBytea) Equal(other Value) bool {
+	o, ok := other.(*pgBytea)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return bytes.Equal(k.b, o.b)
+}
+
+func (k *pgDomain) Equal(other Value) bool {
+	o, ok := other.(*pgDomain)
+	return ok && k.name == o.name && k.v.Equal(o.v)
+}
+
+func (k *pgEnum) Equal(other Value) bool {
+	o, ok := other.(*pgEnum)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.s == o.s
+}
+
+func (k *pgFloat) Equal(other Value) bool {
+	o, ok := other.(*pgFloat)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	// postgres treats NaN as equal to itself
+	return k.n == o.n || k.n != k.n && o.n != o.n
+}
+
+// NaN sorts after all other numbers (as it does in postgres)
+func (k *pgFloat) Compare(other Value) (int, error) {
+	o, ok := other.(*pgFloat)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		kn, on := k.n != k.n, o.n != o.n
+		if kn || on {
+			return compareOrder(on && !kn, kn && !on)
+		}
+		return compareOrder(k.n < o.n, k.n > o.n)
+	}), nil
+}
+
+func (k *pgHStore) Equal(other Value) bool {
+	o, ok := other.(*pgHStore)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	if len(k.m) != len(o.m) {
+		return false
+	}
+	for key, v := range k.m {
+		ov, ok := o.m[key]
+		if !ok || !v.Equal(ov) {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *pgInteger) Equal(other Value) bool {
+	o, ok := other.(*pgInteger)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.n == o.n
+}
+
+func (k *pgInteger) Compare(other Value) (int, error) {
+	o, ok := other.(*pgInteger)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.n < o.n, k.n > o.n)
+	}), nil
+}
+
+// intervals are compared as postgres does (a month is 30 days and
+// a day is 24 hours) so '1 day' equals '24 hours'
+func (k *pgInterval) total() *big.Int {
+	n := big.NewInt(k.months)
+	n.Mul(n, big.NewInt(30))
+	n.Add(n, big.NewInt(k.days))
+	n.Mul(n, big.NewInt(int64(intervalDay/1000)))
+	return n.Add(n, big.NewInt(k.usecs))
+}
+
+func (k *pgInterval) Equal(other Value) bool {
+	c, err := k.Compare(other)
+	return err == nil && c == 0
+}
+
+func (k *pgInterval) Compare(other Value) (int, error) {
+	o, ok := other.(*pgInterval)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return k.total().Cmp(o.total())
+	}), nil
+}
+
+// documents are equal if they decode to the same values
+func (k *pgJSON) Equal(other Value) bool {
+	o, ok := other.(*pgJSON)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	a, err := k.decoded()
+	if err != nil {
+		return false
+	}
+	b, err := o.decoded()
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (k *pgLTree) Equal(other Value) bool {
+	o, ok := other.(*pgLTree)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return reflect.DeepEqual(k.labels, o.labels)
+}
+
+func (k *pgMacAddr) Equal(other Value) bool {
+	o, ok := other.(*pgMacAddr)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return bytes.Equal(k.addr, o.addr)
+}
+
+func (k *pgMultirange) Equal(other Value) bool {
+	o, ok := other.(*pgMultirange)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return equalValues(k.vs, o.vs)
+}
+
+func (k *pgInet) Equal(other Value) bool {
+	o, ok := other.(*pgInet)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.cidr == o.cidr && k.ip.Equal(o.ip) && bytes.Equal(k.mask, o.mask)
+}
+
+// numerics are equal regardless of scale, ie 1.0 = 1.00
+func (k *pgNumeric) Equal(other Value) bool {
+	c, err := k.Compare(other)
+	return err == nil && c == 0
+}
+
+// NaN sorts after all other numbers (as it does in postgres)
+func (k *pgNumeric) Compare(other Value) (int, error) {
+	o, ok := other.(*pgNumeric)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		a, aok := new(big.Rat).SetString(k.s)
+		b, bok := new(big.Rat).SetString(o.s)
+		switch {
+		case aok && bok:
+			return a.Cmp(b)
+		case aok:
+			return -1
+		case bok:
+			return 1
+		}
+		return strings.Compare(k.s, o.s)
+	}), nil
+}
+
+func (k *pgRange) Equal(other Value) bool {
+	o, ok := other.(*pgRange)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	if k.empty || o.empty {
+		return k.empty == o.empty
+	}
+	return k.lowerInc == o.lowerInc && k.upperInc == o.upperInc &&
+		equalBound(k.lower, o.lower) && equalBound(k.upper, o.upper)
+}
+
+// range bounds are nil when unbounded
+func equalBound(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(b)
+}
+
+// records are equal if they have the same columns and values
+// (the Relation they belong to is ignored)
+func (k *pgRecord) Equal(other Value) bool {
+	o, ok := other.(*pgRecord)
+	if !ok || len(k.cs) != len(o.cs) {
+		return false
+	}
+	for i, c := range k.cs {
+		if c.name != o.cs[i].name {
+			return false
+		}
+	}
+	return equalValues(k.vs, o.vs)
+}
+
+func (k *pgReg) Equal(other Value) bool {
+	o, ok := other.(*pgReg)
+	if !ok || k.typ != o.typ {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	if k.oid != 0 && o.oid != 0 {
+		return k.oid == o.oid
+	}
+	return k.name == o.name
+}
+
+func (k *pgRow) Equal(other Value) bool {
+	o, ok := other.(*pgRow)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return equalValues(k.vs, o.vs)
+}
+
+func (k *pgText) Equal(other Value) bool {
+	o, ok := other.(*pgText)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.s == o.s
+}
+
+// text is compared byte-wise (like the "C" collation)
+func (k *pgText) Compare(other Value) (int, error) {
+	o, ok := other.(*pgText)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return strings.Compare(k.s, o.s)
+	}), nil
+}
+
+func (k *pgTimestamp) Equal(other Value) bool {
+	o, ok := other.(*pgTimestamp)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.t.Equal(o.t)
+}
+
+func (k *pgTimestamp) Compare(other Value) (int, error) {
+	o, ok := other.(*pgTimestamp)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.t.Before(o.t), k.t.After(o.t))
+	}), nil
+}
+
+// timestamptz values are equal if they are the same instant
+func (k *pgTimestampTZ) Equal(other Value) bool {
+	o, ok := other.(*pgTimestampTZ)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.t.Equal(o.t)
+}
+
+func (k *pgTimestampTZ) Compare(other Value) (int, error) {
+	o, ok := other.(*pgTimestampTZ)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.t.Before(o.t), k.t.After(o.t))
+	}), nil
+}
+
+func (k *pgDate) Equal(other Value) bool {
+	o, ok := other.(*pgDate)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.t.Equal(o.t)
+}
+
+func (k *pgDate) Compare(other Value) (int, error) {
+	o, ok := other.(*pgDate)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.t.Before(o.t), k.t.After(o.t))
+	}), nil
+}
+
+func (k *pgTSVector) Equal(other Value) bool {
+	o, ok := other.(*pgTSVector)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return reflect.DeepEqual(k.ls, o.ls)
+}
+
+func (k *pgTSQuery) Equal(other Value) bool {
+	o, ok := other.(*pgTSQuery)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.s == o.s
+}
+
+func (k *pgLSN) Equal(other Value) bool {
+	o, ok := other.(*pgLSN)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.n == o.n
+}
+
+func (k *pgLSN) Compare(other Value) (int, error) {
+	o, ok := other.(*pgLSN)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.n < o.n, k.n > o.n)
+	}), nil
+}
+
+func (k *pgXID) Equal(other Value) bool {
+	o, ok := other.(*pgXID)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.n == o.n
+}
+
+func (k *pgSnapshot) Equal(other Value) bool {
+	o, ok := other.(*pgSnapshot)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.xmin == o.xmin && k.xmax == o.xmax && reflect.DeepEqual(k.xip, o.xip)
+}
+
+func (k *pgUint) Equal(other Value) bool {
+	o, ok := other.(*pgUint)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.n == o.n
+}
+
+func (k *pgUint) Compare(other Value) (int, error) {
+	o, ok := other.(*pgUint)
+	if !ok {
+		return 0, cmpErr(k, other)
+	}
+	return compareNull(k, o, func() int {
+		return compareOrder(k.n < o.n, k.n > o.n)
+	}), nil
+}
+
+func (k *pgUUID) Equal(other Value) bool {
+	o, ok := other.(*pgUUID)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return k.u == o.u
+}
+
+func (k *pgXML) Equal(other Value) bool {
+	o, ok := other.(*pgXML)
+	if !ok {
+		return false
+	}
+	if done, eq := nullEqual(k, o); done {
+		return eq
+	}
+	return bytes.Equal(k.b, o.b)
+}
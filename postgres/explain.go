@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Plan is a node of the plan tree from EXPLAIN (FORMAT JSON). The
+// Actual fields are only set when the plan was explained with analyze
+type Plan struct {
+	NodeType      string  `json:"Node Type"`
+	Relation      string  `json:"Relation Name"`
+	Schema        string  `json:"Schema"`
+	Alias         string  `json:"Alias"`
+	Index         string  `json:"Index Name"`
+	JoinType      string  `json:"Join Type"`
+	Filter        string  `json:"Filter"`
+	IndexCond     string  `json:"Index Cond"`
+	StartupCost   float64 `json:"Startup Cost"`
+	TotalCost     float64 `json:"Total Cost"`
+	PlanRows      float64 `json:"Plan Rows"`
+	PlanWidth     int     `json:"Plan Width"`
+	ActualTime    float64 `json:"Actual Total Time"` // ms per loop
+	ActualRows    float64 `json:"Actual Rows"`       // per loop
+	ActualLoops   float64 `json:"Actual Loops"`
+	RowsRemoved   float64 `json:"Rows Removed by Filter"`
+	Plans         []*Plan `json:"Plans"`
+	PlanningTime  float64 `json:"-"` // ms (root node only)
+	ExecutionTime float64 `json:"-"` // ms (root node with analyze only)
+}
+
+// Call fn with p and each of the nodes below it (depth first)
+func (p *Plan) Walk(fn func(n *Plan)) {
+	fn(p)
+	for _, c := range p.Plans {
+		c.Walk(fn)
+	}
+}
+
+// Return the nodes of the tree that sequentially scan a relation
+// (the usual sign of a missing index on a large table)
+func (p *Plan) SeqScans() []*Plan {
+	var scans []*Plan
+	p.Walk(func(n *Plan) {
+		if n.NodeType == "Seq Scan" {
+			scans = append(scans, n)
+		}
+	})
+	return scans
+}
+
+// an indented outline of the plan tree
+func (p *Plan) String() string {
+	b := new(strings.Builder)
+	var write func(n *Plan, depth int)
+	write = func(n *Plan, depth int) {
+		fmt.Fprintf(b, "%s%s", strings.Repeat("  ", depth), n.NodeType)
+		if n.Relation != "" {
+			fmt.Fprintf(b, " on %s", n.Relation)
+		}
+		if n.Index != "" {
+			fmt.Fprintf(b, " using %s", n.Index)
+		}
+		fmt.Fprintf(b, " (cost=%.2f..%.2f rows=%.0f)", n.StartupCost, n.TotalCost, n.PlanRows)
+		if n.ActualLoops > 0 {
+			fmt.Fprintf(b, " (actual time=%.3f rows=%.0f loops=%.0f)", n.ActualTime, n.ActualRows, n.ActualLoops)
+		}
+		b.WriteString("\n")
+		for _, c := range n.Plans {
+			write(c, depth+1)
+		}
+	}
+	write(p, 0)
+	return b.String()
+}
+
+// parse the output of EXPLAIN (FORMAT JSON)
+func parsePlan(b []byte) (*Plan, error) {
+	var explain []struct {
+		Plan          *Plan   `json:"Plan"`
+		PlanningTime  float64 `json:"Planning Time"`
+		ExecutionTime float64 `json:"Execution Time"`
+	}
+	err := json.Unmarshal(b, &explain)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read EXPLAIN output: %v", err)
+	}
+	if len(explain) == 0 || explain[0].Plan == nil {
+		return nil, errors.New("EXPLAIN returned no plan")
+	}
+	p := explain[0].Plan
+	p.PlanningTime = explain[0].PlanningTime
+	p.ExecutionTime = explain[0].ExecutionTime
+	return p, nil
+}
+
+// EXPLAIN the SELECT that Fetch would run and return the plan tree,
+// ie to find queries that need an index. With analyze the query is
+// actually run (and the Actual fields of the plan set)
+func (q *Query) Explain(analyze bool) (*Plan, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	opts := "FORMAT JSON"
+	if analyze {
+		opts = "ANALYZE, " + opts
+	}
+	return q.explain(opts)
+}
+
+// run EXPLAIN (opts) for the query
+func (q *Query) explain(opts string) (*Plan, error) {
+	s, args, err := q.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := q.rows(fmt.Sprintf("EXPLAIN (%s) %s", opts, s), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	var b []byte
+	for rs.Next() {
+		err = rs.Scan(&b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	return parsePlan(b)
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// operators allowed in `where:"op"` struct tags
+var filterOps = map[string]string{
+	"=":     "=",
+	"!=":    "<>",
+	"<>":    "<>",
+	"<":     "<",
+	"<=":    "<=",
+	">":     ">",
+	">=":    ">=",
+	"like":  "LIKE",
+	"ilike": "ILIKE",
+	"@>":    "@>",
+	"<@":    "<@",
+	"&&":    "&&",
+	"in":    "IN",
+}
+
+// Add a WHERE condition for each set field of the struct filter, ie:
+//
+//	type PersonFilter struct {
+//		Name   *string  `db:"name"`
+//		MinAge int      `db:"age" where:">="`
+//		IDs    []int64  `db:"id" where:"in"`
+//	}
+//
+// Fields are matched to columns like Repo does. The `where` tag sets the
+// operator (one of = != < <= > >= like ilike @> <@ && in) and defaults to =.
+// Nil pointers and zero values are ignored (use a pointer to filter on a
+// zero value). "in" takes a slice and matches any of its elements
+func (q *Query) WhereStruct(filter interface{}) *Query {
+	if q.err != nil {
+		return q
+	}
+	rv := reflect.ValueOf(filter)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("WhereStruct expected a struct got: %T", filter)
+		return q2
+	}
+	q2 := q
+	err := walkFilter(rv, func(name, op string, f reflect.Value) error {
+		c := q.from.col(name)
+		if c == nil {
+			return fmt.Errorf("WhereStruct: No column %s", name)
+		}
+		data, err := fieldData(f)
+		if err != nil {
+			return err
+		}
+		if op == "IN" {
+			v, err := Array(c.k)(data)
+			if err != nil {
+				return fmt.Errorf("WhereStruct: cannot use %v for column %s: %v", data, name, err)
+			}
+			q2 = q2.Where(fmt.Sprintf("%s = ANY($1)", name), v)
+		} else {
+			q2 = q2.Where(fmt.Sprintf("%s %s $1", name, op), data)
+		}
+		return q2.err
+	})
+	if err != nil {
+		q3 := q.cp()
+		q3.err = err
+		return q3
+	}
+	return q2
+}
+
+// call fn for each field of rv that should be filtered on
+func walkFilter(rv reflect.Value, fn func(name, op string, f reflect.Value) error) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("db")
+		if tag == "-" || sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		f := rv.Field(i)
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			err := walkFilter(f, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		op := "="
+		if w := sf.Tag.Get("where"); w != "" {
+			var ok bool
+			op, ok = filterOps[strings.ToLower(w)]
+			if !ok {
+				return fmt.Errorf("WhereStruct: unknown operator %q for field %s", w, sf.Name)
+			}
+		}
+		switch f.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if f.IsNil() {
+				continue
+			}
+		case reflect.Slice, reflect.Map:
+			if f.Len() == 0 {
+				continue
+			}
+		default:
+			if f.IsZero() {
+				continue
+			}
+		}
+		if op == "IN" && f.Kind() != reflect.Slice {
+			return fmt.Errorf("WhereStruct: field %s must be a slice to use in", sf.Name)
+		}
+		name := tag
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		err := fn(name, op, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// ErrSchemaDrift is returned (wrapped) by Open when the live schema does
+// not match the fingerprint given with ExpectSchema
+var ErrSchemaDrift = errors.New("schema does not match expected fingerprint")
+
+// OpenOption configures a DB as it is opened
+type OpenOption func(db *DB) error
+
+// Return a hex sha256 of every relation's Fingerprint (see
+// Relation.Fingerprint) so it changes when any relation, column or
+// column type is added, dropped or changed
+func (db *DB) SchemaFingerprint() (string, error) {
+	rels, err := db.Relations()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(rels))
+	for name := range rels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\n", rels[name].Fingerprint())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Fail Open with ErrSchemaDrift if the SchemaFingerprint of the database
+// is not fingerprint, ie one recorded when the binary was built
+func ExpectSchema(fingerprint string) OpenOption {
+	return func(db *DB) error {
+		got, err := db.SchemaFingerprint()
+		if err != nil {
+			return err
+		}
+		if got != fingerprint {
+			return fmt.Errorf("%w: expected %s got %s", ErrSchemaDrift, fingerprint, got)
+		}
+		return nil
+	}
+}
+
+// Like ExpectSchema but only logs a warning if the schema has drifted
+func WarnSchemaDrift(fingerprint string) OpenOption {
+	return func(db *DB) error {
+		err := ExpectSchema(fingerprint)(db)
+		if errors.Is(err, ErrSchemaDrift) {
+			log.Printf("postgres: %v", err)
+			return nil
+		}
+		return err
+	}
+}
@@ -87,3 +87,10 @@ func (k *pgFloat) Val() interface{} {
 	}
 	return k.n
 }
+
+func (k *pgFloat) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrFullTableWrite is returned when a Query without any WHERE
+	// filters is used to Update or Delete. See AllowFullTableWrite
+	ErrFullTableWrite = errors.New("refusing to write to every row without a WHERE clause")
+	// ErrTooManyRows is returned (wrapped) by Fetch when a query
+	// returns more rows than allowed by DB.SetMaxRows
+	ErrTooManyRows = errors.New("too many rows")
+)
+
+// Cap the number of rows Fetch will return for Queries from this DB.
+// Fetching more returns an error wrapping ErrTooManyRows. Zero (the default)
+// means no limit. Should be set before the DB is shared between goroutines
+func (db *DB) SetMaxRows(n int) {
+	db.maxRows = n
+}
+
+// the row cap for this query (or 0)
+func (q *Query) maxRows() int {
+	if q.from == nil || q.from.db == nil {
+		return 0
+	}
+	return q.from.db.maxRows
+}
+
+// Return a new Query that may Update or Delete even if it has no
+// WHERE filters, ie to intentionally clear a table
+func (q *Query) AllowFullTableWrite() *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.fullWrite = true
+	return q2
+}
+
+// refuse a write built from the Query (see bulk.go) that
+// could touch more rows than intended
+func (q *Query) checkWrite() error {
+	if q.err != nil {
+		return q.err
+	}
+	if isReadOnly(q.tx) {
+		return ErrReadOnly
+	}
+	if len(q.where) == 0 && !q.fullWrite {
+		return fmt.Errorf("%w: %s", ErrFullTableWrite, q.from.Name)
+	}
+	if len(q.joins) > 0 {
+		return fmt.Errorf("cannot Update or Delete %s with joined relations", q.from.Name)
+	}
+	if len(q.ctes) > 0 {
+		return fmt.Errorf("cannot Update or Delete %s with WITH clauses", q.from.Name)
+	}
+	if q.union != nil {
+		return fmt.Errorf("cannot Update or Delete %s with combined queries", q.from.Name)
+	}
+	// UPDATE and DELETE have no LIMIT, OFFSET or ORDER BY so
+	// they would silently write every matching row
+	if q.limit > 0 || q.offset > 0 || q.order != "" {
+		return fmt.Errorf("cannot Update or Delete %s with Limit, Offset or OrderBy", q.from.Name)
+	}
+	if q.lock != "" {
+		return fmt.Errorf("cannot Update or Delete %s with ForUpdate or ForShare", q.from.Name)
+	}
+	return nil
+}
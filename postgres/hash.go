@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// Return a hex sha256 of the record's column names and values. The hash
+// does not depend on the order of the columns and NULL hashes differently
+// to an empty value so it is suitable for change detection and ETags
+func (k *pgRecord) Hash() string {
+	idx := make([]int, len(k.cs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		return k.cs[idx[a]].name < k.cs[idx[b]].name
+	})
+	h := sha256.New()
+	// length prefix each part so "ab","c" != "a","bc"
+	write := func(b []byte) {
+		var n [binary.MaxVarintLen64]byte
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+		h.Write(b)
+	}
+	for _, i := range idx {
+		write([]byte(k.cs[i].name))
+		v := k.vs[i]
+		if v.IsNull() {
+			h.Write([]byte{0})
+			continue
+		}
+		h.Write([]byte{1})
+		write([]byte(v.String()))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Return an md5 of every row matching the query computed by the server
+// so results can be compared (ie for an ETag) without fetching them.
+// The hash does not depend on the order rows are returned in
+func (q *Query) ResultHash() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	s := fmt.Sprintf(`SELECT md5(COALESCE(string_agg(md5(t::text), '' ORDER BY md5(t::text)), '')) FROM (%s) t`,
+		q.selectSql())
+	rs, err := q.rows(s, q.selectArgs()...)
+	if err != nil {
+		return "", err
+	}
+	defer rs.Close()
+	var hash string
+	for rs.Next() {
+		err = rs.Scan(&hash)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hash, rs.Err()
+}
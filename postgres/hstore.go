@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql/driver"
 	"fmt"
+	"sort"
 )
 
 func HStore(data interface{}) (Value, error) {
@@ -26,7 +27,7 @@ func (k *pgHStore) Scan(src interface{}) (err error) {
 	}
 	k.valid = true
 	// get src into a valid type
-	var keyvals map[string]string
+	var keyvals map[string]*string
 	switch s := src.(type) {
 	case []byte:
 		// do the parsing
@@ -34,13 +35,29 @@ func (k *pgHStore) Scan(src interface{}) (err error) {
 		if err != nil {
 			return err
 		}
+	case string:
+		keyvals, err = parseHStore([]byte(s))
+		if err != nil {
+			return err
+		}
 	case map[string]string:
+		keyvals = make(map[string]*string, len(s))
+		for key, val := range s {
+			val := val
+			keyvals[key] = &val
+		}
+	case map[string]*string:
 		keyvals = s
 	default:
 		return fmt.Errorf("cannot set HSTORE value with %T -> %v", src, src)
 	}
 	for key, val := range keyvals {
-		vx, err := Text(val)
+		var vx Value
+		if val == nil {
+			vx, err = Text(nil)
+		} else {
+			vx, err = Text(*val)
+		}
 		if err != nil {
 			return err
 		}
@@ -55,7 +72,7 @@ func (k *pgHStore) IsNull() bool {
 
 func (k *pgHStore) Value() (driver.Value, error) {
 	if !k.valid {
-		return nullBytes, nil
+		return nil, nil
 	}
 	return k.bytes()
 }
@@ -68,7 +85,7 @@ func (k *pgHStore) String() string {
 	return string(s)
 }
 
-// return all hstore values
+// return all hstore values. Keys with NULL values are NULL Values
 func (k *pgHStore) Map() map[string]Value {
 	return k.m
 }
@@ -81,92 +98,159 @@ func (k *pgHStore) ValueBy(name string) Value {
 }
 
 func (k *pgHStore) Get(name string) interface{} {
-	return k.ValueBy(name).Val()
+	v := k.ValueBy(name)
+	if v == nil {
+		return nil
+	}
+	return v.Val()
+}
+
+// like Get but returns fallback if name is missing or NULL
+func (k *pgHStore) GetOr(name string, fallback interface{}) interface{} {
+	v := k.ValueBy(name)
+	if v == nil {
+		return fallback
+	}
+	return v.ValOr(fallback)
 }
 
+// set the value for key name (adding it if missing)
 func (k *pgHStore) Set(name string, src interface{}) error {
-	return k.ValueBy(name).Scan(src)
+	v := k.ValueBy(name)
+	if v == nil {
+		v, _ = Text(nil)
+		if k.m == nil {
+			k.m = make(map[string]Value)
+		}
+		k.m[name] = v
+		k.valid = true
+	}
+	return v.Scan(src)
 }
 
+// returns a map[string]string, keys with NULL values are left out
+// (use Map to see them)
 func (k *pgHStore) Val() interface{} {
 	if !k.valid {
 		return nil
 	}
 	vals := make(map[string]string)
 	for key, v := range k.m {
-		vals[key] = v.Val().(string)
+		if v.IsNull() {
+			continue
+		}
+		vals[key] = v.String()
 	}
 	return vals
 }
 
-// TODO: this was just a quick test.. does not quote fields!
+func (k *pgHStore) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// quote s for use as an hstore key or value
+func quoteHStore(s string) []byte {
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	b = append(b, escape([]byte(s), 1)...)
+	return append(b, '"')
+}
+
+// encode as "key"=>"value" pairs sorted by key
 func (k *pgHStore) bytes() ([]byte, error) {
-	buf := make([][]byte, len(k.m))
-	i := 0
-	for key, val := range k.m {
-		buf[i] = []byte(fmt.Sprintf(`"%s" => "%s"`, key, val))
-		i++
-	}
-	return bytes.Join(buf, []byte(`,`)), nil
-}
-
-func parseHStore(s []byte) (map[string]string, error) {
-	m := make(map[string]string)
-	st := 0 // 0=waiting-for-key, 1=inkey 2=waiting-for-val 3=inval
-	ka := -1
-	kz := -1
-	va := -1
-	vz := -1
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		switch {
-		case b == '\\':
+	if !k.valid {
+		return nullBytes, nil
+	}
+	keys := make([]string, 0, len(k.m))
+	for key := range k.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.Write(quoteHStore(key))
+		buf.WriteString("=>")
+		if v := k.m[key]; v.IsNull() {
+			buf.WriteString("NULL")
+		} else {
+			buf.Write(quoteHStore(v.String()))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// read a quoted or unquoted hstore token from s starting at i returning
+// the token, whether it was quoted and the index after it
+func hstoreToken(s []byte, i int) ([]byte, bool, int, error) {
+	if s[i] != '"' {
+		a := i
+		for i < len(s) && s[i] != ',' && s[i] != '=' && s[i] != ' ' {
 			i++
-		case st == 0:
-			switch {
-			case b == '"':
-				ka = i + 1
-				st++
-			}
-		case st == 1:
-			switch {
-			case b == '"':
-				kz = i - 1
-				st++
-			}
-		case st == 2:
-			switch {
-			case b == 'N' && s[i+1] == 'U' && s[i+2] == 'L' && s[i+3] == 'L':
-				va = i
-				vz = i + 3
-				st = 0
-			case b == '"':
-				va = i + 1
-				st++
-			}
-		case st == 3:
-			switch {
-			case b == '"':
-				vz = i - 1
-				st = 0
+		}
+		return s[a:i], false, i, nil
+	}
+	tok := make([]byte, 0)
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return nil, false, i, fmt.Errorf("invalid HSTORE %s: trailing escape", s)
 			}
+			tok = append(tok, s[i])
+		case '"':
+			return tok, true, i + 1, nil
+		default:
+			tok = append(tok, s[i])
+		}
+	}
+	return nil, false, i, fmt.Errorf("invalid HSTORE %s: unterminated quote", s)
+}
+
+func parseHStore(s []byte) (map[string]*string, error) {
+	m := make(map[string]*string)
+	skip := func(i int) int {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		return i
+	}
+	i := skip(0)
+	for i < len(s) {
+		key, _, next, err := hstoreToken(s, i)
+		if err != nil {
+			return nil, err
+		}
+		i = skip(next)
+		if i+1 >= len(s) || s[i] != '=' || s[i+1] != '>' {
+			return nil, fmt.Errorf("invalid HSTORE %s: expected => after key", s)
+		}
+		i = skip(i + 2)
+		if i == len(s) {
+			return nil, fmt.Errorf("invalid HSTORE %s: missing value", s)
+		}
+		val, quoted, next, err := hstoreToken(s, i)
+		if err != nil {
+			return nil, err
+		}
+		if !quoted && string(bytes.ToUpper(val)) == "NULL" {
+			m[string(key)] = nil
+		} else {
+			v := string(val)
+			m[string(key)] = &v
 		}
-		if kz != -1 && vz != -1 {
-			k := s[ka : kz+1]
-			v := s[va : vz+1]
-			if string(v) == "NULL" {
-				// do something? .. for now just ignore NULL value
-			} else {
-				k = bytes.Replace(k, []byte(`\\`), []byte(`\`), -1)
-				k = bytes.Replace(k, []byte(`\"`), []byte(`"`), -1)
-				v = bytes.Replace(v, []byte(`\\`), []byte(`\`), -1)
-				v = bytes.Replace(v, []byte(`\"`), []byte(`"`), -1)
-				m[string(k)] = string(v)
+		i = skip(next)
+		if i < len(s) {
+			if s[i] != ',' {
+				return nil, fmt.Errorf("invalid HSTORE %s: expected , between pairs", s)
 			}
-			ka = -1
-			kz = -1
-			va = -1
-			vz = -1
+			i = skip(i + 1)
 		}
 	}
 	return m, nil
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+type identityKind uint
+
+const (
+	identityPK identityKind = iota
+	identityCols
+	identityAll
+	identityCtid
+)
+
+// Identity is how Update and Delete find the row a RecordValue was
+// read from. See Relation.SetIdentity
+type Identity struct {
+	kind identityKind
+	cols []string
+}
+
+// match rows by primary key. This is the default
+var IdentityPrimaryKey = Identity{kind: identityPK}
+
+// match rows on every column (NULLs match NULLs). For tables with no
+// key at all, ie logs. Only a single row of any duplicates is affected.
+// Rows can only be Deleted as once a RecordValue is changed it no longer
+// matches the row it was read from
+var IdentityAllColumns = Identity{kind: identityAll}
+
+// match rows on the ctid of the row. Only works for RecordValues
+// fetched or inserted by the same Tx as the ctid of a row can
+// change once the transaction ends
+var IdentityCtid = Identity{kind: identityCtid}
+
+// match rows on a set of columns that are unique
+// but not declared as the primary key
+func IdentityColumns(names ...string) Identity {
+	return Identity{kind: identityCols, cols: names}
+}
+
+// Set how Update and Delete identify rows of this relation so
+// relations without a primary key (join tables, logs) can be written.
+// Should be called before the Relation is shared between goroutines
+func (r *Relation) SetIdentity(id Identity) error {
+	if id.kind == identityCols && len(id.cols) == 0 {
+		return fmt.Errorf("IdentityColumns for %s requires at least one column", r.Name)
+	}
+	for _, name := range id.cols {
+		if r.col(name) == nil {
+			return fmt.Errorf("cannot identify %s by unknown column %s", r.Name, name)
+		}
+	}
+	r.identity = id
+	return nil
+}
+
+// remember the ctid of a row read or written by the Tx
+func (tx *Tx) setCtid(v RecordValue, ctid string) {
+	if tx.ctids == nil {
+		tx.ctids = make(map[RecordValue]string)
+	}
+	tx.ctids[v] = ctid
+}
+
+// the ctid of a row read or written by the Tx
+func (tx *Tx) ctid(v RecordValue) (string, error) {
+	ctid, ok := tx.ctids[v]
+	if !ok {
+		return "", fmt.Errorf("%s rows are identified by ctid so must be fetched in the same Tx before Update or Delete", v.Relation().Name)
+	}
+	return ctid, nil
+}
+
+// scan a row with a trailing ctid column
+// (after any extra columns scanned into dest)
+func (tx *Tx) scanCtid(rs *Rows, v RecordValue, dest ...interface{}) error {
+	vals := make([]interface{}, 0, len(v.Values())+len(dest)+1)
+	for _, x := range v.Values() {
+		vals = append(vals, x)
+	}
+	vals = append(vals, dest...)
+	var ctid string
+	err := rs.Scan(append(vals, &ctid)...)
+	if err != nil {
+		return err
+	}
+	setNotNull(v)
+	tx.setCtid(v, ctid)
+	return nil
+}
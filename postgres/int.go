@@ -99,3 +99,10 @@ func (k *pgInteger) Val() interface{} {
 	}
 	return k.n
 }
+
+func (k *pgInteger) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
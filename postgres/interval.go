@@ -0,0 +1,289 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durations used when converting months/days into a time.Duration
+// these match the values postgres uses for EXTRACT(EPOCH FROM interval)
+const (
+	intervalDay   = 24 * time.Hour
+	intervalMonth = 30 * intervalDay
+)
+
+func Interval(data interface{}) (Value, error) {
+	k := new(pgInterval)
+	return k, k.Scan(data)
+}
+
+// an interval is kept as separate months, days and microseconds (like postgres)
+// so that values like "1 mon" survive a round trip
+type pgInterval struct {
+	months int64
+	days   int64
+	usecs  int64
+	valid  bool
+}
+
+func (k *pgInterval) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	k.months, k.days, k.usecs = 0, 0, 0
+	switch x := src.(type) {
+	case time.Duration:
+		k.usecs = int64(x / time.Microsecond)
+	case *time.Duration:
+		if x == nil {
+			k.valid = false
+			return nil
+		}
+		k.usecs = int64(*x / time.Microsecond)
+	case *pgInterval:
+		if !x.valid {
+			k.valid = false
+			return nil
+		}
+		k.months, k.days, k.usecs = x.months, x.days, x.usecs
+	case string:
+		return k.parse(x)
+	case []byte:
+		return k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set INTERVAL value with %T -> %v", src, src)
+	}
+	return nil
+}
+
+func (k *pgInterval) parse(s string) (err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "P") {
+		err = k.parseISO(s)
+	} else {
+		err = k.parsePostgres(s)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse interval string %s: %v", s, err)
+	}
+	return nil
+}
+
+// parse the postgres (and postgres_verbose) output styles
+// ie "1 year 2 mons -3 days +04:05:06.7" or "@ 1 day 2 hours ago"
+func (k *pgInterval) parsePostgres(s string) error {
+	fields := strings.Fields(s)
+	ago := false
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "@":
+		case f == "ago":
+			ago = true
+		case strings.Contains(f, ":"):
+			us, err := parseClock(f)
+			if err != nil {
+				return err
+			}
+			k.usecs += us
+		default:
+			if i+1 >= len(fields) {
+				return fmt.Errorf("missing unit for %s", f)
+			}
+			i++
+			err := k.add(f, fields[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if ago {
+		k.months, k.days, k.usecs = -k.months, -k.days, -k.usecs
+	}
+	return nil
+}
+
+// add n units to the interval
+func (k *pgInterval) add(n string, unit string) error {
+	x, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return err
+	}
+	switch strings.TrimSuffix(strings.ToLower(unit), "s") {
+	case "year":
+		k.months += int64(x * 12)
+	case "mon", "month":
+		k.months += int64(x)
+	case "week":
+		k.days += int64(x * 7)
+	case "day":
+		k.days += int64(x)
+	case "hour":
+		k.usecs += int64(x * float64(time.Hour/time.Microsecond))
+	case "min", "minute":
+		k.usecs += int64(x * float64(time.Minute/time.Microsecond))
+	case "sec", "second":
+		k.usecs += int64(x * float64(time.Second/time.Microsecond))
+	default:
+		return fmt.Errorf("unknown interval unit %s", unit)
+	}
+	return nil
+}
+
+// parse [+-]HH:MM:SS[.ffffff] into microseconds
+func parseClock(s string) (int64, error) {
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %s", s)
+	}
+	var us int64
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, p := range parts {
+		x, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, err
+		}
+		us += int64(x * float64(units[i]/time.Microsecond))
+	}
+	if neg {
+		us = -us
+	}
+	return us, nil
+}
+
+// parse the iso_8601 output style ie P1Y2M3DT4H5M6.5S
+func (k *pgInterval) parseISO(s string) error {
+	inTime := false
+	num := ""
+	for _, r := range s[1:] {
+		switch {
+		case r == 'T':
+			inTime = true
+		case r == '-' || r == '.' || (r >= '0' && r <= '9'):
+			num += string(r)
+		default:
+			unit := ""
+			switch {
+			case r == 'Y':
+				unit = "year"
+			case r == 'M' && !inTime:
+				unit = "mon"
+			case r == 'W':
+				unit = "week"
+			case r == 'D':
+				unit = "day"
+			case r == 'H':
+				unit = "hour"
+			case r == 'M':
+				unit = "min"
+			case r == 'S':
+				unit = "sec"
+			default:
+				return fmt.Errorf("unexpected %c", r)
+			}
+			err := k.add(num, unit)
+			if err != nil {
+				return err
+			}
+			num = ""
+		}
+	}
+	if num != "" {
+		return fmt.Errorf("missing unit for %s", num)
+	}
+	return nil
+}
+
+// Returns the interval as a time.Duration where a month is
+// 30 days and a day is 24 hours
+func (k *pgInterval) Duration() time.Duration {
+	return time.Duration(k.months)*intervalMonth +
+		time.Duration(k.days)*intervalDay +
+		time.Duration(k.usecs)*time.Microsecond
+}
+
+func (k *pgInterval) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgInterval) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgInterval) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func plural(n int64, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// formats the interval in the postgres output style
+func (k *pgInterval) String() string {
+	if !k.valid {
+		return ""
+	}
+	parts := make([]string, 0, 4)
+	if y := k.months / 12; y != 0 {
+		parts = append(parts, plural(y, "year"))
+	}
+	if m := k.months % 12; m != 0 {
+		parts = append(parts, plural(m, "mon"))
+	}
+	if k.days != 0 {
+		parts = append(parts, plural(k.days, "day"))
+	}
+	if k.usecs != 0 || len(parts) == 0 {
+		us := k.usecs
+		sign := ""
+		if us < 0 {
+			sign = "-"
+			us = -us
+		} else if k.months < 0 || k.days < 0 {
+			sign = "+"
+		}
+		secs := us / 1e6
+		clock := fmt.Sprintf("%s%02d:%02d:%02d", sign, secs/3600, secs/60%60, secs%60)
+		if frac := us % 1e6; frac != 0 {
+			clock += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+		}
+		parts = append(parts, clock)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (k *pgInterval) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.Duration()
+}
+
+func (k *pgInterval) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
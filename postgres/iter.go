@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// RecordIter scans the records of a Query one row at a time.
+// See Query.Iter
+type RecordIter struct {
+	q      *Query
+	rs     *Rows
+	extras []selectExpr
+	v      RecordValue
+	err    error
+}
+
+// Run the query returning an iterator that scans each row into a
+// RecordValue as Next is called rather than holding every record in
+// memory, ie to export a large relation:
+//
+//	it, err := db.From("person").Iter()
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		v := it.Record()
+//	}
+//	return it.Err()
+//
+// The iterator must be closed. Queries with Preload or Before (which
+// need every record before any are returned) cannot be iterated and
+// the DB's MaxRows limit does not apply
+func (q *Query) Iter() (*RecordIter, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if len(q.preloads) > 0 || q.reverse {
+		return nil, fmt.Errorf("cannot iterate %s: queries with Preload or Before must use Fetch", q.from.Name)
+	}
+	q, _ = q.withCtid()
+	rs, err := q.rows(q.fetchSql(), q.selectArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordIter{q: q, rs: rs, extras: q.extraExprs()}, nil
+}
+
+// Advance to the next record returning false when there are
+// no more or on error (see Err)
+func (it *RecordIter) Next() bool {
+	if it.err != nil || !it.rs.Next() {
+		it.v = nil
+		return false
+	}
+	it.v, it.err = it.q.scanRow(it.rs, it.extras)
+	return it.err == nil
+}
+
+// The current record
+func (it *RecordIter) Record() RecordValue {
+	return it.v
+}
+
+// The error (if any) that stopped the iteration
+func (it *RecordIter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rs.Err()
+}
+
+// Close the underlying Rows. Safe to call more than once
+func (it *RecordIter) Close() error {
+	return it.rs.Close()
+}
+
+// Call fn with each record matching the query, scanning one row at a
+// time (see Iter). Stops at (and returns) the first error from fn
+func (q *Query) Each(fn func(v RecordValue) error) error {
+	it, err := q.Iter()
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		err = fn(it.Record())
+		if err != nil {
+			return err
+		}
+	}
+	err = it.Err()
+	if err != nil {
+		return err
+	}
+	return it.Close()
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// Return a new Query joined (INNER JOIN) to the named reference of the
+// relation using the discovered foreign key, ie:
+//
+//	db.From("person").JoinRef("location").Where("location.name = $1", "g1")
+//
+// The joined relation is aliased as the reference name. Records of the
+// query's relation are still returned (once per joined row for has-many
+// references) so columns in Where and OrderBy that appear in both
+// relations must be qualified
+func (q *Query) JoinRef(name string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	var r *ref
+	for _, ref := range q.from.refs {
+		if ref.name == name {
+			r = ref
+			break
+		}
+	}
+	if r == nil {
+		q2.err = fmt.Errorf("cannot join %s: no such reference on %s", name, q.from.Name)
+		return q2
+	}
+	if r.name == q.from.Name {
+		q2.err = fmt.Errorf("cannot join %s to itself", name)
+		return q2
+	}
+	for _, j := range q.joins {
+		if j.name == name {
+			return q2
+		}
+	}
+	// the referencing column is on q.from (has one) or the
+	// joined relation (has many)
+	on := fmt.Sprintf("%s.%s = %s.%s", r.name, r.col.refF, q.from.Name, r.col.name)
+	if r.kind == ref_hasMany {
+		on = fmt.Sprintf("%s.%s = %s.%s", r.name, r.col.name, q.from.Name, r.col.refF)
+	}
+	j := join{name, fmt.Sprintf("JOIN %s %s ON %s", r.rel.Name, r.name, on)}
+	q2.joins = append(q.joins[:len(q.joins):len(q.joins)], j)
+	return q2
+}
+
+type join struct {
+	name string // alias of the joined relation
+	sql  string
+}
+
+// the JOIN clauses of the query
+func (q *Query) joinExpr() string {
+	s := ""
+	for i, j := range q.joins {
+		if i > 0 {
+			s += " "
+		}
+		s += j.sql
+	}
+	return s
+}
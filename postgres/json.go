@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Value holding a json document. Nested fields can be read with
+// a simple path syntax of dot separated keys and [n] array indexes,
+// ie: "a.b[0].c"
+type JSONValue interface {
+	Value
+	Unmarshal(v interface{}) error
+	// the child at path as a JSON Value (NULL for json null)
+	Path(path string) (Value, error)
+	// the string at path
+	GetString(path string) (string, error)
+	// true if path names a field or element in the document
+	Exists(path string) bool
+}
+
+// Values can be set from a string or []byte of json text or anything
+// encoding/json can Marshal
+func JSON(data interface{}) (Value, error) {
+	k := new(pgJSON)
+	return k, k.Scan(data)
+}
+
+// JSONB is identical to JSON on the client side
+func JSONB(data interface{}) (Value, error) {
+	k := new(pgJSON)
+	return k, k.Scan(data)
+}
+
+type pgJSON struct {
+	b     []byte
+	doc   interface{} // decoded b (lazily)
+	ok    bool        // doc has been decoded
+	valid bool
+}
+
+func (k *pgJSON) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	var b []byte
+	switch x := src.(type) {
+	case string:
+		b = []byte(x)
+	case []byte:
+		b = append([]byte(nil), x...)
+	default:
+		var err error
+		b, err = json.Marshal(src)
+		if err != nil {
+			return fmt.Errorf("cannot set JSON value with %T -> %v: %v", src, src, err)
+		}
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("cannot set JSON value with %T -> %v: invalid json", src, src)
+	}
+	k.b = b
+	k.doc, k.ok = nil, false
+	k.valid = true
+	return nil
+}
+
+// decode the document into v using encoding/json
+func (k *pgJSON) Unmarshal(v interface{}) error {
+	if !k.valid {
+		return fmt.Errorf("cannot Unmarshal NULL JSON value")
+	}
+	return json.Unmarshal(k.b, v)
+}
+
+// decode the document once, keeping numbers as json.Number
+// so they are not rounded through float64
+func (k *pgJSON) decoded() (interface{}, error) {
+	if !k.valid {
+		return nil, fmt.Errorf("cannot read path of NULL JSON value")
+	}
+	if !k.ok {
+		d := json.NewDecoder(bytes.NewReader(k.b))
+		d.UseNumber()
+		err := d.Decode(&k.doc)
+		if err != nil {
+			return nil, err
+		}
+		k.ok = true
+	}
+	return k.doc, nil
+}
+
+// walk path returning the child it names
+func (k *pgJSON) find(path string) (interface{}, error) {
+	doc, err := k.decoded()
+	if err != nil {
+		return nil, err
+	}
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segs {
+		switch x := doc.(type) {
+		case map[string]interface{}:
+			if seg[0] == '[' {
+				return nil, fmt.Errorf("cannot index object with %s in JSON path %s", seg, path)
+			}
+			child, ok := x[seg]
+			if !ok {
+				return nil, fmt.Errorf("no field %q in JSON path %s", seg, path)
+			}
+			doc = child
+		case []interface{}:
+			if seg[0] != '[' {
+				return nil, fmt.Errorf("cannot read field %q of array in JSON path %s", seg, path)
+			}
+			i, _ := strconv.Atoi(seg[1 : len(seg)-1])
+			if i >= len(x) {
+				return nil, fmt.Errorf("index %s out of range in JSON path %s", seg, path)
+			}
+			doc = x[i]
+		default:
+			return nil, fmt.Errorf("cannot read %s of %T in JSON path %s", seg, doc, path)
+		}
+	}
+	return doc, nil
+}
+
+// split "a.b[0]" into "a", "b", "[0]". Array segments keep
+// their brackets so they are not confused with numeric keys
+func parseJSONPath(path string) ([]string, error) {
+	var segs []string
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			if path == "" {
+				break
+			}
+			return nil, fmt.Errorf("empty key in JSON path %s", path)
+		}
+		if i := strings.IndexByte(part, '['); i != 0 {
+			if i < 0 {
+				segs = append(segs, part)
+				continue
+			}
+			segs = append(segs, part[:i])
+			part = part[i:]
+		}
+		for part != "" {
+			end := strings.IndexByte(part, ']')
+			if part[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid index in JSON path %s", path)
+			}
+			n, err := strconv.Atoi(part[1:end])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index in JSON path %s", path)
+			}
+			segs = append(segs, part[:end+1])
+			part = part[end+1:]
+		}
+	}
+	return segs, nil
+}
+
+func (k *pgJSON) Path(path string) (Value, error) {
+	doc, err := k.find(path)
+	if err != nil {
+		return nil, err
+	}
+	child := new(pgJSON)
+	if doc == nil {
+		return child, nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	child.b = bytes.TrimRight(b.Bytes(), "\n")
+	child.doc, child.ok = doc, true
+	child.valid = true
+	return child, nil
+}
+
+func (k *pgJSON) GetString(path string) (string, error) {
+	doc, err := k.find(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := doc.(string)
+	if !ok {
+		return "", fmt.Errorf("JSON path %s is %T not a string", path, doc)
+	}
+	return s, nil
+}
+
+func (k *pgJSON) Exists(path string) bool {
+	_, err := k.find(path)
+	return err == nil
+}
+
+// the document as is (so it is not re-encoded as a string)
+func (k *pgJSON) MarshalJSON() ([]byte, error) {
+	if !k.valid {
+		return []byte("null"), nil
+	}
+	return k.b, nil
+}
+
+func (k *pgJSON) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgJSON) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return string(k.b), nil
+}
+
+func (k *pgJSON) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return k.b, nil
+}
+
+func (k *pgJSON) String() string {
+	if !k.valid {
+		return ""
+	}
+	return string(k.b)
+}
+
+func (k *pgJSON) Val() interface{} {
+	doc, err := k.decoded()
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+func (k *pgJSON) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"database/sql"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RowsLeak describes a Rows that has not been closed
+type RowsLeak struct {
+	Query  string
+	Opened time.Time
+	Stack  string // stack trace of the call that opened the Rows
+}
+
+// keeps track of the Rows opened from a DB that are not closed
+type rowsTracker struct {
+	mu     sync.Mutex
+	next   uint64
+	open   map[uint64]*RowsLeak
+	report func(leak *RowsLeak)
+}
+
+// Track the Rows returned by Query on this DB (and its Tx and Conn) and
+// call report for each one that is garbage collected without being
+// closed or read to the end (the Rows are then closed). If report is
+// nil the leak is logged.
+// Capturing stacks is slow so this is intended for tests and debugging.
+// Should be called before the DB is shared between goroutines
+func (db *DB) TrackRows(report func(leak *RowsLeak)) {
+	if report == nil {
+		report = logRowsLeak
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.tracker = &rowsTracker{open: make(map[uint64]*RowsLeak), report: report}
+}
+
+// Stop tracking Rows started by TrackRows (if any)
+func (db *DB) StopTrackingRows() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.tracker = nil
+}
+
+// the running rows tracker (if any)
+func (db *DB) rowsTracker() *rowsTracker {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.tracker
+}
+
+// Return the tracked Rows that are still open (oldest first),
+// ie to check a test has closed everything it opened
+func (db *DB) OpenRows() []*RowsLeak {
+	t := db.rowsTracker()
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaks := make([]*RowsLeak, 0, len(t.open))
+	for _, leak := range t.open {
+		leaks = append(leaks, leak)
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		return leaks[i].Opened.Before(leaks[j].Opened)
+	})
+	return leaks
+}
+
+func logRowsLeak(leak *RowsLeak) {
+	log.Printf("postgres: Rows for %q were never closed. Opened at:\n%s", leak.Query, leak.Stack)
+}
+
+// wrap rows returned for query q (tracking them if enabled)
+func (db *DB) newRows(q string, rows *sql.Rows) *Rows {
+	rs := &Rows{Rows: rows}
+	if db == nil {
+		return rs
+	}
+	t := db.rowsTracker()
+	if t == nil {
+		return rs
+	}
+	t.mu.Lock()
+	t.next++
+	rs.leakID = t.next
+	t.open[rs.leakID] = &RowsLeak{Query: q, Opened: time.Now(), Stack: string(debug.Stack())}
+	t.mu.Unlock()
+	rs.tracker = t
+	runtime.SetFinalizer(rs, func(rs *Rows) {
+		if leak := t.untrack(rs.leakID); leak != nil {
+			t.report(leak)
+			// release the connection held by the rows
+			rs.Close()
+		}
+	})
+	return rs
+}
+
+// stop tracking the Rows with id returning its
+// details if it was still being tracked
+func (t *rowsTracker) untrack(id uint64) *RowsLeak {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leak := t.open[id]
+	delete(t.open, id)
+	return leak
+}
+
+// like sql.Rows#Next
+func (rs *Rows) Next() bool {
+	if rs.Rows.Next() {
+		return true
+	}
+	// sql.Rows closes itself once all rows are read
+	rs.closed()
+	return false
+}
+
+// like sql.Rows#Close
+func (rs *Rows) Close() error {
+	rs.closed()
+	return rs.Rows.Close()
+}
+
+func (rs *Rows) closed() {
+	if rs.tracker != nil {
+		rs.tracker.untrack(rs.leakID)
+	}
+	if rs.release != nil {
+		rs.release()
+		rs.release = nil
+	}
+}
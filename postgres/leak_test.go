@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"database/sql"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTrackRows(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	leaked := make(chan *RowsLeak, 1)
+	db.TrackRows(func(leak *RowsLeak) { leaked <- leak })
+	rs, err := db.Query("SELECT closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open := db.OpenRows(); len(open) != 1 || open[0].Query != "SELECT closed" || open[0].Stack == "" {
+		t.Fatalf("expected the rows to be tracked got: %v", open)
+	}
+	rs.Close()
+	rs, err = db.Query("SELECT read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rs.Next() {
+	}
+	if open := db.OpenRows(); len(open) != 0 {
+		t.Errorf("expected closed and fully read rows not to be open got: %v", open)
+	}
+	func() {
+		rs, err := db.Query("SELECT leaked")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Rows.Next()
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case leak := <-leaked:
+			if leak.Query != "SELECT leaked" {
+				t.Errorf("unexpected leak reported: %v", leak.Query)
+			}
+			return
+		case <-deadline:
+			t.Fatal("expected the unclosed rows to be reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
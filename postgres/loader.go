@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// the most keys fetched by one Loader query
+const loaderMaxBatch = 1000
+
+// Loader coalesces Get-by-primary-key calls made from many goroutines
+// within a short window into a single "pk = ANY($1)" query (dataloader
+// style) for ie GraphQL resolvers. See DB.Loader
+type Loader struct {
+	rel   *Relation
+	pk    *col
+	wait  time.Duration
+	fetch func(keys Value) ([]RecordValue, error)
+	mu    sync.Mutex
+	batch *loaderBatch // batch collecting keys (if any)
+}
+
+// the keys requested within one window and their results
+type loaderBatch struct {
+	keys    []Value
+	seen    map[string]bool
+	once    sync.Once
+	done    chan struct{} // closed when results/err are set
+	results map[string]RecordValue
+	err     error
+}
+
+// Create a Loader for the named relation which must have a single
+// column primary key. Keys requested within wait of the first are
+// fetched together
+func (db *DB) Loader(name string, wait time.Duration) (*Loader, error) {
+	rel, err := db.Relation(name)
+	if err != nil {
+		return nil, err
+	}
+	pks := rel.pks()
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("No primary key found for relation %s", rel.Name)
+	}
+	if len(pks) > 1 {
+		return nil, fmt.Errorf("cannot load %s: it has a composite primary key", rel.Name)
+	}
+	l := &Loader{rel: rel, pk: pks[0], wait: wait}
+	l.fetch = l.query
+	return l, nil
+}
+
+func (l *Loader) query(keys Value) ([]RecordValue, error) {
+	q := &Query{tx: l.rel.db, from: l.rel}
+	return q.Where(fmt.Sprintf("%s = ANY($1)", l.pk.name), keys).Fetch()
+}
+
+// Return the record with primary key pk, waiting for the batch it is
+// part of to be fetched. Returns ErrNotFound (wrapped) if there is no
+// such record. Each caller gets its own copy of the record
+func (l *Loader) Load(pk interface{}) (RecordValue, error) {
+	v, err := l.pk.k(pk)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use %v as primary key of %s: %v", pk, l.rel.Name, err)
+	}
+	key := v.String()
+	l.mu.Lock()
+	b := l.batch
+	if b == nil {
+		b = &loaderBatch{seen: make(map[string]bool), done: make(chan struct{})}
+		l.batch = b
+		time.AfterFunc(l.wait, func() { l.dispatch(b) })
+	}
+	if !b.seen[key] {
+		b.seen[key] = true
+		b.keys = append(b.keys, v)
+	}
+	full := len(b.keys) >= loaderMaxBatch
+	l.mu.Unlock()
+	if full {
+		l.dispatch(b)
+	}
+	<-b.done
+	if b.err != nil {
+		return nil, b.err
+	}
+	r, ok := b.results[key]
+	if !ok {
+		return nil, fmt.Errorf("%w in %s with primary key %v", ErrNotFound, l.rel.Name, pk)
+	}
+	return r.Clone().(RecordValue), nil
+}
+
+// fetch the batch's keys (once) and wake its callers
+func (l *Loader) dispatch(b *loaderBatch) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.batch == b {
+			l.batch = nil
+		}
+		l.mu.Unlock()
+		defer close(b.done)
+		keys, err := Array(l.pk.k)(nil)
+		if err != nil {
+			b.err = err
+			return
+		}
+		for _, k := range b.keys {
+			keys.(IteratorValue).Append(k)
+		}
+		vs, err := l.fetch(keys)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.results = make(map[string]RecordValue, len(vs))
+		for _, v := range vs {
+			b.results[v.ValueBy(l.pk.name).String()] = v
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoaderCoalesces(t *testing.T) {
+	rel := testRelation()
+	var mu sync.Mutex
+	var calls []string
+	l := &Loader{rel: rel, pk: rel.pk(), wait: 20 * time.Millisecond}
+	l.fetch = func(keys Value) ([]RecordValue, error) {
+		mu.Lock()
+		calls = append(calls, keys.String())
+		mu.Unlock()
+		var vs []RecordValue
+		for _, k := range keys.(IteratorValue).Values() {
+			if k.Val() == int64(404) {
+				continue
+			}
+			v, err := rel.New([]interface{}{k.Val(), "p", nil, nil})
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+		return vs, nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	got := make([]RecordValue, 5)
+	for i, pk := range []interface{}{1, "2", 3, 1, 404} {
+		wg.Add(1)
+		go func(i int, pk interface{}) {
+			defer wg.Done()
+			got[i], errs[i] = l.Load(pk)
+		}(i, pk)
+	}
+	wg.Wait()
+	if len(calls) != 1 {
+		t.Fatalf("expected one query got: %v", calls)
+	}
+	for i, want := range []int64{1, 2, 3, 1} {
+		if errs[i] != nil || got[i].Get("id") != want {
+			t.Errorf("#%d expected record %d got: %v %v", i, want, got[i], errs[i])
+		}
+	}
+	if got[0] == got[3] {
+		t.Errorf("expected callers of the same key to get their own copy")
+	}
+	if !errors.Is(errs[4], ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing key got: %v", errs[4])
+	}
+	// a later call starts a new batch
+	if _, err := l.Load(1); err != nil || len(calls) != 2 {
+		t.Errorf("expected a second query got: %v %v", calls, err)
+	}
+}
+
+func TestLoaderCompositeKey(t *testing.T) {
+	rel := NewRelation("pair", Col("a", BigInt, PrimaryKey()), Col("b", BigInt, PrimaryKey()))
+	db := &DB{rels: map[string]*Relation{"pair": rel}}
+	if _, err := db.Loader("pair", time.Millisecond); err == nil {
+		t.Errorf("expected a composite primary key to be rejected")
+	}
+}
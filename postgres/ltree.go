@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// LTreeValue is a Value holding a label path ie "Top.Science.Astronomy"
+type LTreeValue interface {
+	Value
+	Labels() []string
+	Label(i int) string
+	Depth() int
+	Parent() LTreeValue
+	IsAncestorOf(other LTreeValue) bool
+}
+
+// Values can be set from a dot separated string, []byte or []string of labels
+func LTree(data interface{}) (Value, error) {
+	k := new(pgLTree)
+	return k, k.Scan(data)
+}
+
+type pgLTree struct {
+	labels []string
+	valid  bool
+}
+
+// labels may only contain letters, digits, underscores and hyphens
+func validLabel(l string) bool {
+	if l == "" {
+		return false
+	}
+	for _, r := range l {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (k *pgLTree) setLabels(labels []string) error {
+	for _, l := range labels {
+		if !validLabel(l) {
+			return fmt.Errorf("invalid LTREE label %q", l)
+		}
+	}
+	k.labels = labels
+	return nil
+}
+
+func (k *pgLTree) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case string:
+		return k.setString(x)
+	case []byte:
+		return k.setString(string(x))
+	case []string:
+		return k.setLabels(append([]string{}, x...))
+	case LTreeValue:
+		if x.IsNull() {
+			k.valid = false
+			return nil
+		}
+		return k.setLabels(x.Labels())
+	default:
+		return fmt.Errorf("cannot set LTREE value with %T -> %v", src, src)
+	}
+}
+
+func (k *pgLTree) setString(s string) error {
+	if s == "" {
+		k.labels = []string{}
+		return nil
+	}
+	return k.setLabels(strings.Split(s, "."))
+}
+
+func (k *pgLTree) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgLTree) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgLTree) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgLTree) String() string {
+	return strings.Join(k.labels, ".")
+}
+
+func (k *pgLTree) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgLTree) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// return a copy of the path labels
+func (k *pgLTree) Labels() []string {
+	return append([]string{}, k.labels...)
+}
+
+// return the label at i (negative i counts from the end) or "" if out of range
+func (k *pgLTree) Label(i int) string {
+	if i < 0 {
+		i += len(k.labels)
+	}
+	if i < 0 || i >= len(k.labels) {
+		return ""
+	}
+	return k.labels[i]
+}
+
+// number of labels in the path
+func (k *pgLTree) Depth() int {
+	return len(k.labels)
+}
+
+// return the path without its last label. The parent of an empty
+// or NULL path is NULL
+func (k *pgLTree) Parent() LTreeValue {
+	p := new(pgLTree)
+	if k.valid && len(k.labels) > 0 {
+		p.valid = true
+		p.labels = k.Labels()[:len(k.labels)-1]
+	}
+	return p
+}
+
+// like the ltree @> operator, a path is an ancestor of itself
+func (k *pgLTree) IsAncestorOf(other LTreeValue) bool {
+	if !k.valid || other == nil || other.IsNull() || other.Depth() < len(k.labels) {
+		return false
+	}
+	for i, l := range k.labels {
+		if other.Label(i) != l {
+			return false
+		}
+	}
+	return true
+}
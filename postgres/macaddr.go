@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 6 byte (EUI-48) hardware address
+func MacAddr(data interface{}) (Value, error) {
+	k := &pgMacAddr{n: 6}
+	return k, k.Scan(data)
+}
+
+// 8 byte (EUI-64) hardware address. 6 byte addresses are
+// converted the same way postgres does by inserting FF:FE
+func MacAddr8(data interface{}) (Value, error) {
+	k := &pgMacAddr{n: 8}
+	return k, k.Scan(data)
+}
+
+type pgMacAddr struct {
+	addr  net.HardwareAddr
+	n     int // size in bytes
+	valid bool
+}
+
+func parseMAC(s string) (net.HardwareAddr, error) {
+	addr, err := net.ParseMAC(s)
+	if err == nil {
+		return addr, nil
+	}
+	// postgres also accepts forms like 08002b:010203 and 08002b010203
+	h := strings.NewReplacer(":", "", "-", "", ".", "").Replace(s)
+	if len(h) == 12 || len(h) == 16 {
+		b, herr := hex.DecodeString(h)
+		if herr == nil {
+			return net.HardwareAddr(b), nil
+		}
+	}
+	return nil, err
+}
+
+func (k *pgMacAddr) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	var addr net.HardwareAddr
+	switch x := src.(type) {
+	case net.HardwareAddr:
+		addr = x
+	case string:
+		addr, err = parseMAC(x)
+	case []byte:
+		addr, err = parseMAC(string(x))
+	default:
+		return fmt.Errorf("cannot set MACADDR value with %T -> %v", src, src)
+	}
+	if err != nil {
+		return err
+	}
+	if k.n == 8 && len(addr) == 6 {
+		addr = net.HardwareAddr{addr[0], addr[1], addr[2], 0xff, 0xfe, addr[3], addr[4], addr[5]}
+	}
+	if len(addr) != k.n {
+		return fmt.Errorf("cannot fit %d byte address %s into MACADDR Value", len(addr), addr)
+	}
+	k.addr = addr
+	return nil
+}
+
+func (k *pgMacAddr) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgMacAddr) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgMacAddr) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgMacAddr) String() string {
+	if !k.valid {
+		return ""
+	}
+	return k.addr.String()
+}
+
+func (k *pgMacAddr) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.addr
+}
+
+func (k *pgMacAddr) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
@@ -0,0 +1,574 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type execer interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}
+
+// Merge synchronizes a set of RecordValues into a relation in a single
+// statement. On Postgres 15+ a MERGE is used, older servers fall back to
+// INSERT .. ON CONFLICT (which requires a unique index on the On columns)
+// or UPDATE .. FROM when only WhenMatchedUpdate is used.
+// Like Query each method returns a new Merge and errors are defered until Exec
+type Merge struct {
+	db       *DB
+	ex       execer
+	rel      *Relation
+	using    []RecordValue
+	on       []string
+	update   []string // cols to set when matched
+	matched  bool     // WHEN MATCHED THEN UPDATE
+	inserted bool     // WHEN NOT MATCHED THEN INSERT
+	err      error
+}
+
+// Start a Merge into the named relation
+func (db *DB) MergeInto(name string) *Merge {
+	return newMerge(db, db, name)
+}
+
+// Start a Merge into the named relation that runs inside the transaction
+func (tx *Tx) MergeInto(name string) *Merge {
+	return newMerge(tx.db, tx, name)
+}
+
+func newMerge(db *DB, ex execer, name string) *Merge {
+	m := &Merge{db: db, ex: ex}
+	m.rel, m.err = db.Relation(name)
+	return m
+}
+
+func (m *Merge) cp() *Merge {
+	m2 := *m
+	return &m2
+}
+
+// Set the records to merge. They must belong to the target relation
+func (m *Merge) Using(vs ...RecordValue) *Merge {
+	if m.err != nil {
+		return m
+	}
+	m2 := m.cp()
+	for _, v := range vs {
+		if v.Relation() != m.rel {
+			m2.err = fmt.Errorf("RecordValue given to Using() does not belong to %s", m.rel.Name)
+			return m2
+		}
+	}
+	m2.using = append(append([]RecordValue{}, m.using...), vs...)
+	return m2
+}
+
+// Set the columns used to match records against existing rows
+func (m *Merge) On(cols ...string) *Merge {
+	if m.err != nil {
+		return m
+	}
+	m2 := m.cp()
+	for _, name := range cols {
+		if m.rel.col(name) == nil {
+			m2.err = fmt.Errorf("could not use %s in On() unknown column name", name)
+			return m2
+		}
+	}
+	m2.on = cols
+	return m2
+}
+
+// Update matched rows. If no cols are given all columns except
+// the primary key and the On columns are updated
+func (m *Merge) WhenMatchedUpdate(cols ...string) *Merge {
+	if m.err != nil {
+		return m
+	}
+	m2 := m.cp()
+	for _, name := range cols {
+		if m.rel.col(name) == nil {
+			m2.err = fmt.Errorf("could not use %s in WhenMatchedUpdate() unknown column name", name)
+			return m2
+		}
+	}
+	m2.matched = true
+	m2.update = cols
+	return m2
+}
+
+// Insert records that do not match an existing row
+func (m *Merge) WhenNotMatchedInsert() *Merge {
+	if m.err != nil {
+		return m
+	}
+	m2 := m.cp()
+	m2.inserted = true
+	return m2
+}
+
+func (m *Merge) isOn(name string) bool {
+	for _, on := range m.on {
+		if on == name {
+			return true
+		}
+	}
+	return false
+}
+
+// columns to set when matched
+func (m *Merge) updateCols() []string {
+	if len(m.update) > 0 {
+		return m.update
+	}
+	cols := make([]string, 0, len(m.rel.cols))
+	for _, c := range m.rel.cols {
+		if !c.pk && !c.generated && !m.isOn(c.name) {
+			cols = append(cols, c.name)
+		}
+	}
+	return cols
+}
+
+// columns to insert. The primary key is left to its default
+// unless it is being matched on
+func (m *Merge) insertCols() []*col {
+	cols := make([]*col, 0, len(m.rel.cols))
+	for _, c := range m.rel.cols {
+		if !c.generated && (!c.pk || m.isOn(c.name)) {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// build a VALUES list for cols and the params to bind to it
+func (m *Merge) values(cols []*col) (string, []interface{}) {
+	rows := make([]string, len(m.using))
+	params := make([]interface{}, 0, len(m.using)*len(cols))
+	for i, v := range m.using {
+		bnds := make([]string, len(cols))
+		for j, c := range cols {
+			params = append(params, v.ValueBy(c.name))
+			bnds[j] = fmt.Sprintf("$%d", len(params))
+			if c.typ != "" {
+				bnds[j] = fmt.Sprintf("cast(%s as %s)", bnds[j], c.typ)
+			}
+		}
+		rows[i] = fmt.Sprintf("(%s)", strings.Join(bnds, ","))
+	}
+	return strings.Join(rows, ","), params
+}
+
+func colNames(cols []*col) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (m *Merge) onExpr() string {
+	conds := make([]string, len(m.on))
+	for i, name := range m.on {
+		conds[i] = fmt.Sprintf("t.%s = s.%s", name, name)
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (m *Merge) setExpr(src string) string {
+	cols := m.updateCols()
+	sets := make([]string, len(cols))
+	for i, name := range cols {
+		sets[i] = fmt.Sprintf("%s = %s.%s", name, src, name)
+	}
+	return strings.Join(sets, ",")
+}
+
+// generate a MERGE statement
+func (m *Merge) mergeSql() (string, []interface{}) {
+	vals, params := m.values(m.rel.cols)
+	s := fmt.Sprintf(`MERGE INTO %s t USING (VALUES %s) AS s(%s) ON %s`,
+		m.rel.Name,
+		vals,
+		strings.Join(colNames(m.rel.cols), ","),
+		m.onExpr())
+	if m.matched {
+		s += fmt.Sprintf(` WHEN MATCHED THEN UPDATE SET %s`, m.setExpr("s"))
+	}
+	if m.inserted {
+		names := colNames(m.insertCols())
+		for i, name := range names {
+			names[i] = "s." + name
+		}
+		s += fmt.Sprintf(` WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)`,
+			strings.Join(colNames(m.insertCols()), ","),
+			strings.Join(names, ","))
+	}
+	return s, params
+}
+
+// generate an INSERT .. ON CONFLICT statement
+func (m *Merge) upsertSql() (string, []interface{}) {
+	cols := m.insertCols()
+	vals, params := m.values(cols)
+	action := "NOTHING"
+	if m.matched {
+		action = fmt.Sprintf("UPDATE SET %s", m.setExpr("EXCLUDED"))
+	}
+	s := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO %s`,
+		m.rel.Name,
+		strings.Join(colNames(cols), ","),
+		vals,
+		strings.Join(m.on, ","),
+		action)
+	return s, params
+}
+
+// generate an UPDATE .. FROM statement
+func (m *Merge) updateSql() (string, []interface{}) {
+	vals, params := m.values(m.rel.cols)
+	s := fmt.Sprintf(`UPDATE %s t SET %s FROM (VALUES %s) AS s(%s) WHERE %s`,
+		m.rel.Name,
+		m.setExpr("s"),
+		vals,
+		strings.Join(colNames(m.rel.cols), ","),
+		m.onExpr())
+	return s, params
+}
+
+// return the SQL (and params) the Merge will execute
+func (m *Merge) sql() (string, []interface{}, error) {
+	if m.err != nil {
+		return "", nil, m.err
+	}
+	if len(m.on) == 0 {
+		return "", nil, errors.New("Merge requires On() columns")
+	}
+	if !m.matched && !m.inserted {
+		return "", nil, errors.New("Merge requires WhenMatchedUpdate() and/or WhenNotMatchedInsert()")
+	}
+	if m.matched && len(m.updateCols()) == 0 {
+		return "", nil, errors.New("Merge has no columns to update")
+	}
+	merge, err := m.db.Supports(FeatureMerge)
+	if err != nil {
+		return "", nil, err
+	}
+	if merge {
+		s, params := m.mergeSql()
+		return s, params, nil
+	}
+	if !m.inserted {
+		s, params := m.updateSql()
+		return s, params, nil
+	}
+	err = m.db.require(FeatureOnConflict)
+	if err != nil {
+		return "", nil, err
+	}
+	s, params := m.upsertSql()
+	return s, params, nil
+}
+
+// Execute the merge. Returns the number of rows inserted or updated.
+// If the relation is cached and the Merge is not On the primary key
+// the keys of the rows updated are read back to invalidate them
+func (m *Merge) Exec() (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	if len(m.using) == 0 {
+		return 0, nil
+	}
+	s, params, err := m.sql()
+	if err != nil {
+		return 0, err
+	}
+	if m.keyed() {
+		return m.execKeys()
+	}
+	res, err := m.ex.Exec(s, params...)
+	if err != nil {
+		return 0, err
+	}
+	err = m.invalidate(nil)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// reports whether the primary keys of the rows the Merge updates must be
+// read back to invalidate them as the Using records are not matched On
+// the primary key (and so often do not have one)
+func (m *Merge) keyed() bool {
+	pk := m.rel.pk()
+	return m.matched && m.rel.cache != nil && pk != nil && !m.isOn(pk.name)
+}
+
+// generate the statement for a keyed Exec which returns the primary key
+// of each row written. MERGE can only return rows from Postgres 17 so
+// on older servers pre selects the keys of the rows it will match
+func (m *Merge) keysSql() (s, pre string, params []interface{}, err error) {
+	s, params, err = m.sql()
+	if err != nil {
+		return "", "", nil, err
+	}
+	pk := m.rel.pk().name
+	switch {
+	case strings.HasPrefix(s, "MERGE"):
+		ret, err := m.db.Supports(FeatureMergeReturning)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if !ret {
+			vals, _ := m.values(m.rel.cols)
+			pre = fmt.Sprintf(`SELECT t.%s FROM %s t JOIN (VALUES %s) AS s(%s) ON %s`,
+				pk,
+				m.rel.Name,
+				vals,
+				strings.Join(colNames(m.rel.cols), ","),
+				m.onExpr())
+			return s, pre, params, nil
+		}
+		s += " RETURNING t." + pk
+	case strings.HasPrefix(s, "UPDATE"):
+		s += " RETURNING t." + pk
+	default:
+		s += fmt.Sprintf(" RETURNING %s.%s", m.rel.Name, pk)
+	}
+	return s, "", params, nil
+}
+
+// Exec reading back the primary keys of the rows written (see keyed)
+func (m *Merge) execKeys() (int64, error) {
+	qx, ok := m.ex.(queryer)
+	if !ok {
+		return 0, fmt.Errorf("cannot query with %T", m.ex)
+	}
+	s, pre, params, err := m.keysSql()
+	if err != nil {
+		return 0, err
+	}
+	if pre == "" {
+		keys, err := m.scanKeys(qx, s, params)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(keys)), m.invalidate(keys)
+	}
+	keys, err := m.scanKeys(qx, pre, params)
+	if err != nil {
+		return 0, err
+	}
+	res, err := m.ex.Exec(s, params...)
+	if err != nil {
+		return 0, err
+	}
+	err = m.invalidate(keys)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// run s and return the primary key read from each row
+func (m *Merge) scanKeys(qx queryer, s string, params []interface{}) ([]Value, error) {
+	rs, err := qx.Query(s, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	keys := []Value{}
+	for rs.Next() {
+		k, err := m.rel.pk().k(nil)
+		if err != nil {
+			return nil, err
+		}
+		err = rs.Scan(k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	return keys, rs.Close()
+}
+
+// remove records that may have been updated from the relation's cache.
+// keys are the primary keys of the rows written or nil to use those of
+// the Using records
+func (m *Merge) invalidate(keys []Value) error {
+	if !m.matched {
+		return nil
+	}
+	pk := m.rel.pk()
+	if pk == nil {
+		return nil
+	}
+	if keys == nil {
+		for _, v := range m.using {
+			keys = append(keys, v.ValueBy(pk.name))
+		}
+	}
+	for _, k := range keys {
+		err := invalidateWritten(m.ex, m.rel, k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeAction reports what Merge.ExecActions did with a record
+type MergeAction int
+
+const (
+	MergeSkipped  MergeAction = iota // no row was written (ie DO NOTHING)
+	MergeInserted                    // a new row was inserted
+	MergeUpdated                     // an existing row was updated
+)
+
+func (a MergeAction) String() string {
+	switch a {
+	case MergeInserted:
+		return "inserted"
+	case MergeUpdated:
+		return "updated"
+	}
+	return "skipped"
+}
+
+// generate the statement for ExecActions. Always uses INSERT .. ON
+// CONFLICT (or UPDATE .. FROM) as MERGE cannot report what it did
+// before Postgres 17. Inserted rows are told apart by xmax being 0
+func (m *Merge) actionsSql() (string, []interface{}, error) {
+	_, _, err := m.sql()
+	if err != nil {
+		return "", nil, err
+	}
+	on := make([]string, len(m.on))
+	for i, name := range m.on {
+		on[i] = m.rel.Name + "." + name
+	}
+	if !m.inserted {
+		s, params := m.updateSql()
+		for i, name := range m.on {
+			on[i] = "t." + name
+		}
+		s = fmt.Sprintf("%s RETURNING %s, false", s, strings.Join(on, ","))
+		if m.keyed() {
+			s += ", t." + m.rel.pk().name
+		}
+		return s, params, nil
+	}
+	err = m.db.require(FeatureOnConflict)
+	if err != nil {
+		return "", nil, err
+	}
+	if !m.rel.hasUniqueIndex(m.on) {
+		return "", nil, fmt.Errorf("ExecActions with WhenNotMatchedInsert requires a unique index on %s (%s)",
+			m.rel.Name, strings.Join(m.on, ","))
+	}
+	s, params := m.upsertSql()
+	s = fmt.Sprintf("%s RETURNING %s, (xmax = 0)", s, strings.Join(on, ","))
+	if m.keyed() {
+		s += fmt.Sprintf(", %s.%s", m.rel.Name, m.rel.pk().name)
+	}
+	return s, params, nil
+}
+
+// Execute the merge and return what was done with each of the Using
+// records (in order), ie for metrics or to emit created/updated events.
+// Unlike Exec this never uses MERGE so with WhenNotMatchedInsert the On
+// columns must be exactly the columns of a unique index (ON CONFLICT)
+func (m *Merge) ExecActions() ([]MergeAction, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(m.using) == 0 {
+		return nil, nil
+	}
+	qx, ok := m.ex.(interface {
+		Query(string, ...interface{}) (*Rows, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("cannot query with %T", m.ex)
+	}
+	s, params, err := m.actionsSql()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := qx.Query(s, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	done := make(map[string]MergeAction)
+	var written []Value
+	for rs.Next() {
+		vals := make([]interface{}, len(m.on)+1, len(m.on)+2)
+		keys := make([]Value, len(m.on))
+		for i, name := range m.on {
+			keys[i], err = m.rel.col(name).k(nil)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = keys[i]
+		}
+		var inserted bool
+		vals[len(m.on)] = &inserted
+		if m.keyed() {
+			k, err := m.rel.pk().k(nil)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, k)
+			written = append(written, k)
+		}
+		err = rs.Scan(vals...)
+		if err != nil {
+			return nil, err
+		}
+		done[mergeKey(keys)] = MergeUpdated
+		if inserted {
+			done[mergeKey(keys)] = MergeInserted
+		}
+	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	if m.keyed() && written == nil {
+		written = []Value{}
+	}
+	err = m.invalidate(written)
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]MergeAction, len(m.using))
+	for i, v := range m.using {
+		keys := make([]Value, len(m.on))
+		for j, name := range m.on {
+			keys[j] = v.ValueBy(name)
+		}
+		actions[i] = done[mergeKey(keys)]
+	}
+	return actions, rs.Close()
+}
+
+// identify a row by its On column values
+func mergeKey(keys []Value) string {
+	ss := make([]string, len(keys))
+	for i, k := range keys {
+		ss[i] = strconv.Quote(k.String())
+	}
+	return strings.Join(ss, ",")
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMergeSql(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Merge{rel: rel}
+	m = m.Using(v).On("id").WhenMatchedUpdate("name", "age").WhenNotMatchedInsert()
+	for n, expected := range map[int]string{
+		150000: `MERGE INTO person t USING (VALUES ($1,$2,$3,$4)) AS s(id,name,age,tags) ON t.id = s.id WHEN MATCHED THEN UPDATE SET name = s.name,age = s.age WHEN NOT MATCHED THEN INSERT (id,name,age,tags) VALUES (s.id,s.name,s.age,s.tags)`,
+		140000: `INSERT INTO person (id,name,age,tags) VALUES ($1,$2,$3,$4) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name,age = EXCLUDED.age`,
+	} {
+		m.db = versionDB(n)
+		s, params, err := m.sql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected {
+			t.Errorf("expected version %d to generate:\n%s\ngot:\n%s", n, expected, s)
+		}
+		if len(params) != 4 {
+			t.Errorf("expected 4 params got: %d", len(params))
+		}
+	}
+	m = (&Merge{rel: rel, db: versionDB(140000)}).Using(v).On("name").WhenMatchedUpdate()
+	s, _, err := m.sql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, `UPDATE person t SET age = s.age,tags = s.tags FROM`) {
+		t.Errorf("unexpected UPDATE fallback: %s", s)
+	}
+	if _, _, err = (&Merge{rel: rel}).Using(v).On("id").sql(); err == nil {
+		t.Errorf("expected Merge without a WHEN clause to return an error")
+	}
+	m = (&Merge{rel: rel, db: versionDB(90400)}).Using(v).On("id").WhenNotMatchedInsert()
+	if _, _, err = m.sql(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported on 9.4 got: %v", err)
+	}
+}
+
+func TestMergeKeysSql(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{nil, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := (&Merge{rel: rel}).Using(v).On("name").WhenMatchedUpdate("age")
+	if m.keyed() {
+		t.Errorf("expected an uncached relation not to read back keys")
+	}
+	rel.SetCache(NewLRUCache(4))
+	if !m.keyed() || m.On("id").keyed() {
+		t.Errorf("expected keys to be read back only when not On the primary key")
+	}
+	for n, expected := range map[int]string{
+		170000: `MERGE INTO person t USING (VALUES ($1,$2,$3,$4)) AS s(id,name,age,tags) ON t.name = s.name WHEN MATCHED THEN UPDATE SET age = s.age RETURNING t.id`,
+		140000: `UPDATE person t SET age = s.age FROM (VALUES ($1,$2,$3,$4)) AS s(id,name,age,tags) WHERE t.name = s.name RETURNING t.id`,
+	} {
+		m.db = versionDB(n)
+		s, pre, _, err := m.keysSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected || pre != "" {
+			t.Errorf("expected version %d to generate:\n%s\ngot:\n%s", n, expected, s)
+		}
+	}
+	m.db = versionDB(150000)
+	_, pre, _, err := m.keysSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT t.id FROM person t JOIN (VALUES ($1,$2,$3,$4)) AS s(id,name,age,tags) ON t.name = s.name`
+	if pre != expected {
+		t.Errorf("expected 15 to select the matched keys first got:\n%s", pre)
+	}
+	m.db = versionDB(140000)
+	s, _, _, err := m.WhenNotMatchedInsert().keysSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(s, "RETURNING person.id") {
+		t.Errorf("unexpected ON CONFLICT fallback: %s", s)
+	}
+
+	other, err := rel.New([]interface{}{7, "al", 30, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel.cacheRecord(other)
+	k, err := rel.pk().k(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.invalidate([]Value{k}); err != nil {
+		t.Fatal(err)
+	}
+	if rel.cached(7) != nil {
+		t.Errorf("expected the written key to be invalidated")
+	}
+}
+
+func TestMergeActionsSql(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := (&Merge{rel: rel, db: versionDB(150000)}).Using(v).On("id").WhenMatchedUpdate("name").WhenNotMatchedInsert()
+	s, _, err := m.actionsSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `INSERT INTO person (id,name,age,tags) VALUES ($1,$2,$3,$4) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name RETURNING person.id, (xmax = 0)`
+	if s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	m = (&Merge{rel: rel, db: versionDB(150000)}).Using(v).On("id").WhenMatchedUpdate("name")
+	if s, _, err = m.actionsSql(); err != nil || !strings.HasSuffix(s, "RETURNING t.id, false") {
+		t.Errorf("unexpected update only SQL: %s %v", s, err)
+	}
+	rel.uniques = [][]string{{"id"}, {"name", "age"}}
+	m = (&Merge{rel: rel, db: versionDB(150000)}).Using(v).WhenNotMatchedInsert()
+	if _, _, err = m.On("age", "name").actionsSql(); err != nil {
+		t.Errorf("expected a unique index on the On columns to be accepted got: %v", err)
+	}
+	for _, on := range [][]string{{"name"}, {"name", "age", "tags"}} {
+		if _, _, err = m.On(on...).actionsSql(); err == nil || !strings.Contains(err.Error(), "requires a unique index") {
+			t.Errorf("expected On%v without a unique index to return an error got: %v", on, err)
+		}
+	}
+	// Exec can MERGE on any columns
+	if _, _, err = m.On("name").sql(); err != nil {
+		t.Errorf("expected Exec to accept non unique On columns got: %v", err)
+	}
+	if MergeInserted.String() != "inserted" || MergeSkipped.String() != "skipped" {
+		t.Errorf("unexpected MergeAction names")
+	}
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+)
+
+// A multirange of el values ie Multirange(Integer) for int4multirange.
+// Each element is a Range(el) Value. Requires Postgres 14+
+func Multirange(el ToValue) ToValue {
+	return func(data interface{}) (Value, error) {
+		k := &pgMultirange{el: Range(el)}
+		return k, k.Scan(data)
+	}
+}
+
+type pgMultirange struct {
+	vs    []Value
+	el    ToValue // Range(el)
+	valid bool
+}
+
+func (k *pgMultirange) Scan(src interface{}) error {
+	k.vs = make([]Value, 0)
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case []interface{}:
+		for _, r := range x {
+			err := k.Append(r)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		b, err := srcToBytes(src)
+		if err != nil {
+			return err
+		}
+		parts, err := splitMultirange(b)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			err = k.Append(part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// split a multirange literal ie {[1,3),[5,9)} into its range literals
+func splitMultirange(b []byte) ([][]byte, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) < 2 || b[0] != '{' || b[len(b)-1] != '}' {
+		return nil, fmt.Errorf("invalid multirange literal %s", string(b))
+	}
+	parts := make([][]byte, 0)
+	a := -1
+	quoted := false
+	for i := 1; i < len(b)-1; i++ {
+		c := b[i]
+		switch {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case a == -1 && (c == '[' || c == '('):
+			a = i
+		case a != -1 && (c == ']' || c == ')'):
+			parts = append(parts, b[a:i+1])
+			a = -1
+		}
+	}
+	if a != -1 {
+		return nil, fmt.Errorf("invalid multirange literal %s", string(b))
+	}
+	return parts, nil
+}
+
+func (k *pgMultirange) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgMultirange) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.bytes()
+}
+
+func (k *pgMultirange) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	b := bytes.NewBufferString("")
+	b.WriteString("{")
+	for i, child := range k.vs {
+		cb, err := child.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.Write(cb)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+func (k *pgMultirange) String() string {
+	if !k.valid {
+		return ""
+	}
+	s, _ := k.bytes()
+	return string(s)
+}
+
+func (k *pgMultirange) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	vals := make([]interface{}, len(k.vs))
+	for i, v := range k.vs {
+		vals[i] = v.Val()
+	}
+	return vals
+}
+
+func (k *pgMultirange) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+func (k *pgMultirange) Values() []Value {
+	return k.vs
+}
+
+func (k *pgMultirange) ValueAt(idx int) Value {
+	return k.vs[idx]
+}
+
+func (k *pgMultirange) Append(src interface{}) error {
+	switch v := src.(type) {
+	case RangeValue:
+		k.vs = append(k.vs, v)
+	default:
+		vx, err := k.el(src)
+		if err != nil {
+			return err
+		}
+		k.vs = append(k.vs, vx)
+	}
+	k.valid = true
+	return nil
+}
@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Params maps names to values for :name placeholders
+type Params map[string]interface{}
+
+// NamedQuery is raw SQL using :name placeholders. See DB.NamedSQL
+type NamedQuery struct {
+	tx     queryer
+	s      string        // SQL with $N placeholders
+	params []interface{} // params for each $N
+	err    error
+}
+
+// Create a NamedQuery from SQL that uses :name placeholders which are bound
+// from params. Slices (other than []byte) are expanded into a list of
+// placeholders so they can be used with IN, ie:
+//
+//	db.NamedSQL(`SELECT * FROM person WHERE id IN (:ids) AND name = :name`,
+//		Params{"ids": []int{1, 2}, "name": "bob"})
+//
+// Values are bound as is. Errors are defered until the query is run
+func (db *DB) NamedSQL(s string, params Params) *NamedQuery {
+	return newNamedQuery(db, s, params)
+}
+
+// Like DB.NamedSQL but runs inside the transaction
+func (tx *Tx) NamedSQL(s string, params Params) *NamedQuery {
+	return newNamedQuery(tx, s, params)
+}
+
+// Like DB.NamedSQL but runs on this connection
+func (c *Conn) NamedSQL(s string, params Params) *NamedQuery {
+	return newNamedQuery(c, s, params)
+}
+
+func newNamedQuery(tx queryer, s string, params Params) *NamedQuery {
+	n := &NamedQuery{tx: tx}
+	n.s, n.params, n.err = bindNamed(s, params)
+	return n
+}
+
+// Return the generated SQL and the params to bind to it
+func (n *NamedQuery) SQL() (string, []interface{}, error) {
+	return n.s, n.params, n.err
+}
+
+// Run the query
+func (n *NamedQuery) Rows() (*Rows, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return n.tx.Query(n.s, n.params...)
+}
+
+// Run the query and scan each row into a RecordValue for the named
+// relation. The query must select the relation's columns in order
+func (n *NamedQuery) Records(relation string) ([]RecordValue, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	rels, err := n.tx.Relations()
+	if err != nil {
+		return nil, err
+	}
+	rel, ok := rels[relation]
+	if !ok {
+		return nil, fmt.Errorf("No relation found: %s", relation)
+	}
+	q := &Query{tx: n.tx, from: rel}
+	return q.query(n.s, n.params...)
+}
+
+// Run a query that selects whole-row composites of the named relations
+// in order, ie:
+//
+//	db.NamedSQL(`SELECT p, l FROM person p LEFT JOIN location l ON l.id = p.location_id`, nil).
+//		Joined("person", "location")
+//
+// and return a RecordValue of each relation for every row. Relations
+// missing from an outer join are NULL records
+func (n *NamedQuery) Joined(relations ...string) ([][]RecordValue, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	all, err := n.tx.Relations()
+	if err != nil {
+		return nil, err
+	}
+	rels := make([]*Relation, len(relations))
+	for i, name := range relations {
+		rel, ok := all[name]
+		if !ok {
+			return nil, fmt.Errorf("No relation found: %s", name)
+		}
+		rels[i] = rel
+	}
+	rs, err := n.tx.Query(n.s, n.params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	results := make([][]RecordValue, 0)
+	for rs.Next() {
+		row := make([]RecordValue, len(rels))
+		for i, rel := range rels {
+			row[i], err = rel.New(nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = rs.ScanRecords(row...)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, row)
+	}
+	return results, rs.Err()
+}
+
+func isNameByte(b byte, first bool) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') ||
+		(!first && b >= '0' && b <= '9')
+}
+
+// rewrite the :name placeholders in s as $N placeholders and return
+// the params to bind
+func bindNamed(s string, params Params) (string, []interface{}, error) {
+	args := make([]interface{}, 0, len(params))
+	bound := make(map[string]string) // name -> placeholder(s)
+	out, err := walkNamed(s, func(name string) (string, error) {
+		if ph, ok := bound[name]; ok {
+			return ph, nil
+		}
+		v, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("no param given for :%s", name)
+		}
+		var ph string
+		ph, args = placeholders(v, args)
+		bound[name] = ph
+		return ph, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return out, args, nil
+}
+
+// call fn for each :name placeholder in s replacing it with the result.
+// Quoted strings, identifiers and :: casts are skipped
+func walkNamed(s string, fn func(name string) (string, error)) (string, error) {
+	out := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"':
+			// copy quoted string/identifier as is
+			j := strings.IndexByte(s[i+1:], c)
+			if j == -1 {
+				return "", fmt.Errorf("unterminated quote in %s", s)
+			}
+			out.WriteString(s[i : i+j+2])
+			i += j + 1
+		case c == ':' && i+1 < len(s) && s[i+1] == ':':
+			// cast
+			out.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(s) && isNameByte(s[i+1], true):
+			j := i + 1
+			for j < len(s) && isNameByte(s[j], false) {
+				j++
+			}
+			ph, err := fn(s[i+1 : j])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(ph)
+			i = j - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+// rewrite the ? placeholders in s as $1, $2... if s has exactly n of
+// them and no $N placeholders. Quoted strings and identifiers are
+// skipped as are the jsonb ?| and ?& operators. The jsonb ? operator
+// can't be told apart from a placeholder so s is left as is (and must
+// use $N placeholders) if counting it gives the wrong number of ?s
+func bindQuestion(s string, n int) string {
+	if n == 0 || maxPlaceholder(" "+s) > 0 || !strings.Contains(s, "?") {
+		return s
+	}
+	out := new(strings.Builder)
+	count := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(s[i+1:], c)
+			if j == -1 {
+				return s
+			}
+			out.WriteString(s[i : i+j+2])
+			i += j + 1
+		case c == '?' && i+1 < len(s) && (s[i+1] == '|' || s[i+1] == '&'):
+			out.WriteString(s[i : i+2])
+			i++
+		case c == '?':
+			count++
+			fmt.Fprintf(out, "$%d", count)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	if count != n {
+		return s
+	}
+	// placePat needs a character before each $
+	if s[0] == '?' {
+		return " " + out.String()
+	}
+	return out.String()
+}
+
+// append v to args returning the placeholder(s) to use for it.
+// Slices are expanded into a list of placeholders (or NULL if empty)
+func placeholders(v interface{}, args []interface{}) (string, []interface{}) {
+	rv := reflect.ValueOf(v)
+	_, isValue := v.(Value)
+	if isValue || rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args)), args
+	}
+	if rv.Len() == 0 {
+		return "NULL", args
+	}
+	phs := make([]string, rv.Len())
+	for i := range phs {
+		args = append(args, rv.Index(i).Interface())
+		phs[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return strings.Join(phs, ","), args
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestBindNamed(t *testing.T) {
+	s, args, err := bindNamed(
+		`SELECT ':x', id::text FROM person WHERE id IN (:ids) AND (name = :name OR nick = :name) AND tags = :tags`,
+		Params{
+			"ids":  []int{1, 2, 3},
+			"name": "bob",
+			"tags": Must(Array(Text)([]interface{}{"a"})),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT ':x', id::text FROM person WHERE id IN ($1,$2,$3) AND (name = $4 OR nick = $4) AND tags = $5`
+	if s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if len(args) != 5 || args[0] != 1 || args[3] != "bob" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	s, _, err = bindNamed(`id IN (:ids)`, Params{"ids": []int{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != `id IN (NULL)` {
+		t.Errorf("expected empty slice to bind as NULL got: %s", s)
+	}
+	if _, _, err = bindNamed(`id = :missing`, Params{}); err == nil {
+		t.Errorf("expected missing param to return an error")
+	}
+}
+
+func TestParseQueries(t *testing.T) {
+	src := `-- people queries
+
+-- :name find_active_people
+-- :relation person
+-- :doc people with a status
+SELECT * FROM person
+WHERE status = :status
+
+-- :name count_people
+SELECT count(*) FROM person
+`
+	nqs, err := parseQueries("people.sql", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nqs) != 2 {
+		t.Fatalf("expected 2 queries got %d", len(nqs))
+	}
+	nq := nqs[0]
+	if nq.name != "find_active_people" || nq.rel != "person" || nq.doc != "people with a status" {
+		t.Errorf("unexpected header: %+v", nq)
+	}
+	if nq.s != "SELECT * FROM person\nWHERE status = :status" {
+		t.Errorf("unexpected SQL: %q", nq.s)
+	}
+	if nqs[1].s != "SELECT count(*) FROM person" {
+		t.Errorf("unexpected SQL: %q", nqs[1].s)
+	}
+	if _, err = parseQueries("bad.sql", []byte("SELECT 1")); err == nil {
+		t.Errorf("expected SQL before -- :name to return an error")
+	}
+	if _, err = parseQueries("bad.sql", []byte("-- :name x\n-- :bogus y\nSELECT 1")); err == nil {
+		t.Errorf("expected unknown header to return an error")
+	}
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import "strings"
+
+// NameMatch controls how RecordValue ValueBy/Get/Set resolve column
+// names that do not match exactly. See DB.SetNameMatch
+type NameMatch uint
+
+// only exact column names match (the default)
+const MatchExact NameMatch = 0
+
+const (
+	// names match regardless of case, ie "Name" -> name
+	MatchCaseInsensitive NameMatch = 1 << iota
+	// camelCase names match snake_case columns, ie "userId" -> user_id
+	MatchSnakeCamel
+)
+
+// Set how records from this DB's Relations resolve column names that
+// do not match exactly so they can be used with ie JSON field names.
+// An exact match always wins and a name matching more than one column
+// resolves to none. Should be set before the DB is shared between goroutines
+func (db *DB) SetNameMatch(m NameMatch) {
+	db.nameMatch = m
+}
+
+func (m NameMatch) normalize(name string) string {
+	if m&MatchSnakeCamel != 0 {
+		name = snakeCase(name)
+	}
+	if m&MatchCaseInsensitive != 0 {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// index of the col named (or aliased) name in cs using the matching
+// rules m or -1 if there is no (unambiguous) match
+func (m NameMatch) index(cs []*col, name string) int {
+	for i, c := range cs {
+		if c.name == name {
+			return i
+		}
+	}
+	for i, c := range cs {
+		if c.alias != "" && c.alias == name {
+			return i
+		}
+	}
+	if m == MatchExact {
+		return -1
+	}
+	found := -1
+	want := m.normalize(name)
+	for i, c := range cs {
+		if m.normalize(c.name) == want {
+			if found != -1 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// inet holds a host address with an optional netmask
+func Inet(data interface{}) (Value, error) {
+	k := &pgInet{}
+	return k, k.Scan(data)
+}
+
+// cidr holds a network address. Bits to the right of the netmask must be zero
+func Cidr(data interface{}) (Value, error) {
+	k := &pgInet{cidr: true}
+	return k, k.Scan(data)
+}
+
+type pgInet struct {
+	ip    net.IP
+	mask  net.IPMask
+	cidr  bool
+	valid bool
+}
+
+// normalize ipv4 addresses to their 4 byte form so
+// mask lengths are 32 rather than 128
+func shortIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func (k *pgInet) parse(s string) error {
+	if strings.Contains(s, "/") {
+		ip, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return err
+		}
+		k.ip = shortIP(ip)
+		k.mask = n.Mask
+		return nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %s", s)
+	}
+	k.ip = shortIP(ip)
+	k.mask = net.CIDRMask(len(k.ip)*8, len(k.ip)*8)
+	return nil
+}
+
+func (k *pgInet) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case net.IP:
+		k.ip = shortIP(x)
+		k.mask = net.CIDRMask(len(k.ip)*8, len(k.ip)*8)
+	case *net.IPNet:
+		k.ip = shortIP(x.IP)
+		k.mask = x.Mask
+	case net.IPNet:
+		k.ip = shortIP(x.IP)
+		k.mask = x.Mask
+	case string:
+		err = k.parse(x)
+	case []byte:
+		err = k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set %s value with %T -> %v", k.typ(), src, src)
+	}
+	if err != nil {
+		return err
+	}
+	if len(k.mask) != len(k.ip) {
+		return fmt.Errorf("netmask does not match address family for %s", k.String())
+	}
+	if k.cidr && !k.ip.Equal(k.ip.Mask(k.mask)) {
+		return fmt.Errorf("invalid CIDR value %s has bits set to right of mask", k.String())
+	}
+	return nil
+}
+
+func (k *pgInet) typ() string {
+	if k.cidr {
+		return "CIDR"
+	}
+	return "INET"
+}
+
+func (k *pgInet) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgInet) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgInet) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+// formats like postgres: the netmask is only shown
+// for inet values if it does not cover the whole address
+func (k *pgInet) String() string {
+	if !k.valid {
+		return ""
+	}
+	ones, bits := k.mask.Size()
+	if !k.cidr && ones == bits {
+		return k.ip.String()
+	}
+	return fmt.Sprintf("%s/%d", k.ip.String(), ones)
+}
+
+// inet values return a net.IP and cidr values a *net.IPNet
+func (k *pgInet) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	if k.cidr {
+		return &net.IPNet{IP: k.ip, Mask: k.mask}
+	}
+	return k.ip
+}
+
+func (k *pgInet) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // stored as string currently
@@ -33,6 +34,11 @@ func (k *pgNumeric) Scan(src interface{}) (err error) {
 		k.s = strconv.FormatFloat(float64(x), 'f', k.scale, 64)
 	case float64:
 		k.s = strconv.FormatFloat(x, 'f', k.scale, 64)
+	case int, int8, int16, int32, int64:
+		k.s = k.withScale(fmt.Sprintf("%d", x))
+	case uint, uint8, uint16, uint32, uint64:
+		// unsigned values too big for a BIGINT can be stored in a NUMERIC
+		k.s = k.withScale(fmt.Sprintf("%d", x))
 	case string:
 		k.s = x
 	case []byte:
@@ -42,6 +48,24 @@ func (k *pgNumeric) Scan(src interface{}) (err error) {
 	}
 	return nil
 }
+
+// pad an integer string with zeros to the scale
+func (k *pgNumeric) withScale(s string) string {
+	if k.scale > 0 {
+		return s + "." + strings.Repeat("0", k.scale)
+	}
+	return s
+}
+
+// return the value as a uint64 if it is a non negative integer
+func (k *pgNumeric) Uint64() (uint64, error) {
+	s := k.s
+	if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+		s = s[:i]
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
 func (k *pgNumeric) IsNull() bool {
 	return !k.valid
 }
@@ -73,3 +97,10 @@ func (k *pgNumeric) Val() interface{} {
 	}
 	return k.s
 }
+
+func (k *pgNumeric) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
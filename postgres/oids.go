@@ -3,11 +3,53 @@ package postgres
 import (
 	"fmt"
 	"strconv"
+	"sync"
 )
 
+// typeFactory builds the ToValue for a type from its typmod args
+// (ie the 15 and 3 of numeric(15,3))
+type typeFactory func(args ...string) (ToValue, error)
+
+var (
+	typsMu     sync.RWMutex
+	typsByName = map[string]typeFactory{}
+)
+
+// RegisterType plugs in the Values for the pg_type with the given oid,
+// replacing any built in mapping. Types must be registered before the
+// relations that use them are loaded
+func RegisterType(oid uint32, factory func(args ...string) (ToValue, error)) {
+	typsMu.Lock()
+	defer typsMu.Unlock()
+	typs[oid] = factory
+}
+
+// RegisterTypeByName is like RegisterType but matches the pg_type name
+// (ie "citext" or "geometry"), which unlike the oid of an extension or
+// domain type is the same in every database
+func RegisterTypeByName(name string, factory func(args ...string) (ToValue, error)) {
+	typsMu.Lock()
+	defer typsMu.Unlock()
+	typsByName[name] = factory
+}
+
+func typeFor(oid uint32) (typeFactory, bool) {
+	typsMu.RLock()
+	defer typsMu.RUnlock()
+	f, ok := typs[oid]
+	return f, ok
+}
+
+func typeForName(name string) (typeFactory, bool) {
+	typsMu.RLock()
+	defer typsMu.RUnlock()
+	f, ok := typsByName[name]
+	return f, ok
+}
+
 // load all the known standard oids/Valstructors into the type map
 // this map is used by DB to convert col info into a ToValue
-var typs = map[uint32]func(args ...string) (ToValue, error){
+var typs = map[uint32]typeFactory{
 
 	16: func(args ...string) (ToValue, error) {
 		return Bool, nil
@@ -37,6 +79,10 @@ var typs = map[uint32]func(args ...string) (ToValue, error){
 		return Integer, nil
 	},
 
+	24: func(args ...string) (ToValue, error) {
+		return RegProc, nil
+	},
+
 	25: func(args ...string) (ToValue, error) {
 		return Text, nil
 	},
@@ -45,6 +91,22 @@ var typs = map[uint32]func(args ...string) (ToValue, error){
 		return Integer, nil
 	},
 
+	28: func(args ...string) (ToValue, error) {
+		return XID, nil
+	},
+
+	114: func(args ...string) (ToValue, error) {
+		return JSON, nil
+	},
+
+	142: func(args ...string) (ToValue, error) {
+		return XML, nil
+	},
+
+	650: func(args ...string) (ToValue, error) {
+		return Cidr, nil
+	},
+
 	700: func(args ...string) (ToValue, error) {
 		return Real, nil
 	},
@@ -53,6 +115,18 @@ var typs = map[uint32]func(args ...string) (ToValue, error){
 		return Double, nil
 	},
 
+	774: func(args ...string) (ToValue, error) {
+		return MacAddr8, nil
+	},
+
+	829: func(args ...string) (ToValue, error) {
+		return MacAddr, nil
+	},
+
+	869: func(args ...string) (ToValue, error) {
+		return Inet, nil
+	},
+
 	1042: func(args ...string) (ToValue, error) {
 		vs, err := argsToInts(args, 1)
 		if err != nil {
@@ -69,12 +143,20 @@ var typs = map[uint32]func(args ...string) (ToValue, error){
 		return VarChar(vs[0]), nil
 	},
 
+	1082: func(args ...string) (ToValue, error) {
+		return Date, nil
+	},
+
 	1114: func(args ...string) (ToValue, error) {
 		return Timestamp, nil
 	},
 
 	1184: func(args ...string) (ToValue, error) {
-		return Timestamp, nil
+		return TimestampTZ, nil
+	},
+
+	1186: func(args ...string) (ToValue, error) {
+		return Interval, nil
 	},
 
 	1700: func(args ...string) (ToValue, error) {
@@ -87,6 +169,118 @@ var typs = map[uint32]func(args ...string) (ToValue, error){
 		}
 		return Numeric(vs[0], vs[1]), nil
 	},
+
+	2202: func(args ...string) (ToValue, error) {
+		return Reg("regprocedure"), nil
+	},
+
+	2203: func(args ...string) (ToValue, error) {
+		return Reg("regoper"), nil
+	},
+
+	2204: func(args ...string) (ToValue, error) {
+		return Reg("regoperator"), nil
+	},
+
+	2205: func(args ...string) (ToValue, error) {
+		return RegClass, nil
+	},
+
+	2206: func(args ...string) (ToValue, error) {
+		return RegType, nil
+	},
+
+	2950: func(args ...string) (ToValue, error) {
+		return UUID, nil
+	},
+
+	2970: func(args ...string) (ToValue, error) {
+		return TxidSnapshot, nil
+	},
+
+	3220: func(args ...string) (ToValue, error) {
+		return LSN, nil
+	},
+
+	3614: func(args ...string) (ToValue, error) {
+		return TSVector, nil
+	},
+
+	3615: func(args ...string) (ToValue, error) {
+		return TSQuery, nil
+	},
+
+	3734: func(args ...string) (ToValue, error) {
+		return Reg("regconfig"), nil
+	},
+
+	3769: func(args ...string) (ToValue, error) {
+		return Reg("regdictionary"), nil
+	},
+
+	3802: func(args ...string) (ToValue, error) {
+		return JSONB, nil
+	},
+
+	3904: func(args ...string) (ToValue, error) {
+		return Range(Integer), nil
+	},
+
+	3906: func(args ...string) (ToValue, error) {
+		return Range(Numeric(0, -1)), nil
+	},
+
+	3908: func(args ...string) (ToValue, error) {
+		return Range(Timestamp), nil
+	},
+
+	3910: func(args ...string) (ToValue, error) {
+		return Range(TimestampTZ), nil
+	},
+
+	3912: func(args ...string) (ToValue, error) {
+		return Range(Date), nil
+	},
+
+	3926: func(args ...string) (ToValue, error) {
+		return Range(BigInt), nil
+	},
+
+	4089: func(args ...string) (ToValue, error) {
+		return Reg("regnamespace"), nil
+	},
+
+	4096: func(args ...string) (ToValue, error) {
+		return Reg("regrole"), nil
+	},
+
+	4451: func(args ...string) (ToValue, error) {
+		return Multirange(Integer), nil
+	},
+
+	4532: func(args ...string) (ToValue, error) {
+		return Multirange(Numeric(0, -1)), nil
+	},
+
+	4533: func(args ...string) (ToValue, error) {
+		return Multirange(Timestamp), nil
+	},
+
+	4534: func(args ...string) (ToValue, error) {
+		return Multirange(TimestampTZ), nil
+	},
+
+	4535: func(args ...string) (ToValue, error) {
+		return Multirange(Date), nil
+	},
+
+	4536: func(args ...string) (ToValue, error) {
+		return Multirange(BigInt), nil
+	},
+
+	5038: func(args ...string) (ToValue, error) {
+		return TxidSnapshot, nil
+	},
 }
 
 func argsToInts(args []string, need int) ([]int, error) {
@@ -0,0 +1,267 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// relations estimated to have at least this many rows are
+// counted from the planner statistics when paginating without
+// a filter (as an exact count would scan the whole table)
+const estimateCountOver = 1000000
+
+// Page is one page of the results of a Query
+type Page struct {
+	Records   []RecordValue
+	Total     int64 // number of matching rows
+	Estimated bool  // Total is a planner estimate
+	Page      int   // page number (from 1)
+	PerPage   int
+	Pages     int // number of pages
+	HasNext   bool
+	HasPrev   bool
+	// keyset cursors to fetch the following (with After) or preceding
+	// (with Before) records. Empty if there are none or if the query is
+	// unsorted or sorted in mixed directions. Paginate fails if a record
+	// a cursor is taken from has a NULL sort column
+	Next string
+	Prev string
+}
+
+// name of the window count fetched along with the records of a page
+const pageTotalAlias = "pql_page_total"
+
+// Fetch page (from 1) of perPage records along with the total count and
+// page metadata. Without an OrderBy the records are sorted by primary key
+// so pages are stable. The total is counted by the same statement that
+// fetches the records (with count(*) OVER ()) unless it is estimated
+func (q *Query) Paginate(page, perPage int) (*Page, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if page < 1 || perPage < 1 {
+		return nil, fmt.Errorf("cannot paginate page %d of %d records", page, perPage)
+	}
+	q = q.sortedByKey()
+	if q.err != nil {
+		return nil, q.err
+	}
+	p := &Page{Page: page, PerPage: perPage}
+	var err error
+	p.Total, p.Estimated, err = q.estimatedTotal()
+	if err != nil {
+		return nil, err
+	}
+	pq := q.Limit(perPage).Offset((page - 1) * perPage)
+	if !p.Estimated {
+		pq = pq.SelectExpr("count(*) OVER () AS " + pageTotalAlias)
+	}
+	p.Records, err = pq.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	if !p.Estimated {
+		counted := false
+		if len(p.Records) > 0 {
+			p.Total, counted = p.Records[0].Extra(pageTotalAlias).(int64)
+		}
+		// past the last page (so the window counted nothing)
+		// or the records were read from a cache
+		if !counted {
+			p.Total, p.Estimated, err = q.pageTotal()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.Pages = int((p.Total + int64(perPage) - 1) / int64(perPage))
+	p.HasPrev = page > 1
+	p.HasNext = page < p.Pages
+	if n := len(p.Records); n > 0 {
+		if p.HasNext {
+			p.Next, err = q.pageCursor(p.Records[n-1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if p.HasPrev {
+			p.Prev, err = q.pageCursor(p.Records[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// the cursor for v or "" if the sort order cannot be used for cursors
+func (q *Query) pageCursor(v RecordValue) (string, error) {
+	s, err := q.cursor(v)
+	if err == errNoOrder || err == errMixedOrder {
+		return "", nil
+	}
+	return s, err
+}
+
+// count the rows the query matches (ignoring any limit or offset)
+func (q *Query) pageTotal() (int64, bool, error) {
+	n, estimated, err := q.estimatedTotal()
+	if err != nil || estimated {
+		return n, estimated, err
+	}
+	q2 := q.cp()
+	q2.limit = 0
+	q2.offset = 0
+	n, err = q2.Count()
+	return n, false, err
+}
+
+// the estimated number of rows if the query is unfiltered and the
+// relation is big enough that counting would scan too many rows
+func (q *Query) estimatedTotal() (int64, bool, error) {
+	if len(q.where) == 0 && q.union == nil && q.from.db != nil {
+		n, err := q.from.ApproxCount()
+		if err != nil {
+			return 0, false, err
+		}
+		if n >= estimateCountOver {
+			return n, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// add the primary key columns to the sort order (if missing) so
+// rows are in a total order. They sort the same way as the last column
+func (q *Query) sortedByKey() *Query {
+	names, dirs := q.orderCols()
+	dir := Asc
+	if len(dirs) > 0 {
+		dir = dirs[len(dirs)-1]
+	}
+	q2 := q
+outer:
+	for _, c := range q.from.pks() {
+		for _, name := range names {
+			if name == c.name {
+				continue outer
+			}
+		}
+		q2 = q2.OrderBy(c.name, dir)
+	}
+	return q2
+}
+
+// the columns and directions of the sort order
+func (q *Query) orderCols() ([]string, []Direction) {
+	if q.order == "" {
+		return nil, nil
+	}
+	terms := strings.Split(q.order, ",")
+	names := make([]string, len(terms))
+	dirs := make([]Direction, len(terms))
+	for i, term := range terms {
+		parts := strings.Fields(term)
+		names[i] = parts[0]
+		if len(parts) > 1 && parts[1] == Desc.String() {
+			dirs[i] = Desc
+		}
+	}
+	return names, dirs
+}
+
+var (
+	errNoOrder    = errors.New("keyset cursors need a sort order")
+	errMixedOrder = errors.New("keyset cursors need all columns sorted in the same direction")
+)
+
+// encode the sort columns of v as a cursor. NULLs are refused as
+// a row comparison with NULL never matches so After would be empty
+func (q *Query) cursor(v RecordValue) (string, error) {
+	names, dirs := q.orderCols()
+	if len(names) == 0 {
+		return "", errNoOrder
+	}
+	for _, d := range dirs {
+		if d != dirs[0] {
+			return "", errMixedOrder
+		}
+	}
+	vals := make([]string, len(names))
+	for i, name := range names {
+		cv := v.ValueBy(name)
+		if cv == nil || cv.IsNull() {
+			return "", fmt.Errorf("keyset cursors cannot use the NULL value of %s (sort by NOT NULL columns)", name)
+		}
+		vals[i] = cv.String()
+	}
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Return a new Query for the records sorted after the
+// record the cursor (see Page.Next) was taken from
+func (q *Query) After(cursor string) *Query {
+	return q.keyset(cursor, false)
+}
+
+// Return a new Query for the records sorted before the record the
+// cursor (see Page.Prev) was taken from. With a Limit these are the
+// closest records to the cursor, still returned in sort order
+func (q *Query) Before(cursor string) *Query {
+	return q.keyset(cursor, true)
+}
+
+func (q *Query) keyset(cursor string, before bool) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.sortedByKey()
+	if q2.err != nil {
+		return q2
+	}
+	q2 = q2.cp()
+	names, dirs := q2.orderCols()
+	for _, d := range dirs {
+		if d != dirs[0] {
+			q2.err = errMixedOrder
+			return q2
+		}
+	}
+	var vals []*string
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &vals)
+	}
+	if err != nil || len(vals) != len(names) {
+		q2.err = fmt.Errorf("invalid cursor for %s: %q", q.from.Name, cursor)
+		return q2
+	}
+	params := make([]interface{}, len(names))
+	holders := make([]string, len(names))
+	for i, name := range names {
+		if vals[i] == nil {
+			q2.err = fmt.Errorf("invalid cursor for %s: NULL %s", q.from.Name, name)
+			return q2
+		}
+		params[i], err = q2.from.col(name).k(*vals[i])
+		if err != nil {
+			q2.err = fmt.Errorf("invalid cursor for %s: %v", q.from.Name, err)
+			return q2
+		}
+		holders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	op := ">"
+	if (dirs[0] == Desc) != before {
+		op = "<"
+	}
+	q2.reverse = before
+	return q2.Where(fmt.Sprintf("(%s) %s (%s)",
+		strings.Join(names, ","), op, strings.Join(holders, ",")), params...)
+}
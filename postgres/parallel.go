@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// queryer that runs queries on a DB bound to a context
+type ctxDB struct {
+	*DB
+	ctx context.Context
+}
+
+func (c *ctxDB) Query(q string, vals ...interface{}) (*Rows, error) {
+	return c.DB.QueryContext(c.ctx, q, vals...)
+}
+
+// like DB.QueryContext but the query is also cancelled with c.ctx
+// (so a Query's own WithContext or Timeout does not escape it)
+func (c *ctxDB) QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error) {
+	ctx, cancel := joinCtx(ctx, c.ctx)
+	rs, err := c.DB.QueryContext(ctx, q, vals...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	release := rs.release
+	rs.release = func() {
+		if release != nil {
+			release()
+		}
+		cancel()
+	}
+	return rs, nil
+}
+
+func (c *ctxDB) ExecContext(ctx context.Context, q string, vals ...interface{}) (sql.Result, error) {
+	ctx, cancel := joinCtx(ctx, c.ctx)
+	defer cancel()
+	return c.DB.ExecContext(ctx, q, vals...)
+}
+
+// a context derived from ctx that is also cancelled when other is done
+func joinCtx(ctx, other context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if other.Err() != nil {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Fetch each of the queries concurrently (each on its own connection
+// from the pool) returning their results in the same order. If any
+// query fails the others are cancelled and the first error is returned.
+// The queries must have been built from this DB (not a Tx or Conn)
+func (db *DB) Parallel(queries ...*Query) ([][]RecordValue, error) {
+	for _, q := range queries {
+		if q.err != nil {
+			return nil, q.err
+		}
+		if q.tx != db {
+			return nil, errors.New("Parallel queries must be built from the DB")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make([][]RecordValue, len(queries))
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		ferr error
+	)
+	for i, q := range queries {
+		q2 := q.cp()
+		q2.tx = &ctxDB{db, ctx}
+		wg.Add(1)
+		go func(i int, q *Query) {
+			defer wg.Done()
+			vs, err := q.Fetch()
+			if err != nil {
+				once.Do(func() {
+					ferr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = vs
+		}(i, q2)
+	}
+	wg.Wait()
+	if ferr != nil {
+		return nil, ferr
+	}
+	return results, nil
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// PlanGuard runs EXPLAIN for a set of queries and reports any plan
+// that sequentially scans a table with at least MinRows rows. Intended
+// to be used from go tests to catch queries that stop using an index:
+//
+//	g := db.PlanGuard(10000)
+//	g.Add("active people", people.Where("status = $1", "active"))
+//	g.AddNamed("find_active_people", Params{"status": "active"})
+//	g.Test(t)
+//
+// Table sizes come from pg_class.reltuples so tables should be
+// ANALYZEd first, tables that have never been analyzed count as empty
+type PlanGuard struct {
+	db      *DB
+	MinRows int64
+	plans   []*guardedQuery
+}
+
+type guardedQuery struct {
+	name string
+	s    string
+	args []interface{}
+	err  error
+}
+
+// Create a PlanGuard that fails sequential scans
+// of tables with minRows or more rows
+func (db *DB) PlanGuard(minRows int64) *PlanGuard {
+	return &PlanGuard{db: db, MinRows: minRows}
+}
+
+// Guard the SELECT that q.Fetch() would run
+func (g *PlanGuard) Add(name string, q *Query) *PlanGuard {
+	gq := &guardedQuery{name: name}
+	gq.s, gq.args, gq.err = q.ToSQL()
+	g.plans = append(g.plans, gq)
+	return g
+}
+
+// Guard a query loaded by LoadQueries
+func (g *PlanGuard) AddNamed(name string, params Params) *PlanGuard {
+	gq := &guardedQuery{name: name}
+	_, gq.s, gq.args, gq.err = g.db.Named(name).bind(params)
+	g.plans = append(g.plans, gq)
+	return g
+}
+
+// Guard some raw SQL
+func (g *PlanGuard) AddSQL(name string, s string, args ...interface{}) *PlanGuard {
+	g.plans = append(g.plans, &guardedQuery{name: name, s: s, args: args})
+	return g
+}
+
+// EXPLAIN each query returning an error describing all regressions
+func (g *PlanGuard) Check() error {
+	problems := make([]string, 0)
+	for _, gq := range g.plans {
+		if gq.err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", gq.name, gq.err))
+			continue
+		}
+		scans, err := g.seqScans(gq)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", gq.name, err))
+			continue
+		}
+		for _, scan := range scans {
+			problems = append(problems, fmt.Sprintf("%s: %s", gq.name, scan))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("query plans regressed:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Check the plans failing the test on any regression
+func (g *PlanGuard) Test(t testing.TB) {
+	t.Helper()
+	if err := g.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+// return a description of each sequential scan on a large table
+func (g *PlanGuard) seqScans(gq *guardedQuery) ([]string, error) {
+	rows, err := g.db.Query("EXPLAIN (FORMAT JSON, VERBOSE) "+gq.s, gq.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var b []byte
+	for rows.Next() {
+		err = rows.Scan(&b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	p, err := parsePlan(b)
+	if err != nil {
+		return nil, err
+	}
+	scans := make([]string, 0)
+	for _, n := range p.SeqScans() {
+		size, err := g.tableRows(n.Schema, n.Relation)
+		if err != nil {
+			return nil, err
+		}
+		if size >= g.MinRows {
+			scans = append(scans, fmt.Sprintf("Seq Scan on %s.%s (%d rows)", n.Schema, n.Relation, size))
+		}
+	}
+	return scans, nil
+}
+
+// estimated number of rows in a table
+func (g *PlanGuard) tableRows(schema, name string) (n int64, err error) {
+	err = g.db.scanRow([]interface{}{&n}, `
+		SELECT GREATEST(c.reltuples, 0)::bigint
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+	`, schema, name)
+	return n, err
+}
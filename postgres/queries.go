@@ -0,0 +1,244 @@
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// a query loaded by LoadQueries
+type namedSQL struct {
+	name string
+	doc  string
+	rel  string // relation to scan results into (if any)
+	s    string // SQL with :name placeholders
+	file string
+}
+
+// header comments ie "-- :name find_people"
+var queryHeaderPat = regexp.MustCompile(`^--\s*:(\w+)\s*(.*)$`)
+
+// regexp to match comparisons between a column and a :name placeholder
+var colNamedPat = regexp.MustCompile(`(?i)(?:(\w+)\.)?(\w+)\s*` + colOps + `\s*:(\w+)`)
+
+// Load named queries from each .sql file in dir. See LoadQueriesFS
+func (db *DB) LoadQueries(dir string) error {
+	return db.LoadQueriesFS(os.DirFS(dir))
+}
+
+// Load named queries from each .sql file at the root of fsys.
+// Each query starts with a header of HugSQL style comments:
+//
+//	-- :name find_active_people
+//	-- :relation person
+//	-- :doc people with a given status
+//	SELECT * FROM person WHERE status = :status
+//
+// :name is required. If :relation is given the results can be scanned
+// with QueryRecords and placeholders compared to columns are bound via the
+// column's Value. Queries are checked at load time: placeholders must be
+// well formed and columns compared to placeholders must exist.
+// Should be called before the DB is shared between goroutines
+func (db *DB) LoadQueriesFS(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return err
+	}
+	if db.queries == nil {
+		db.queries = make(map[string]*namedSQL)
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		nqs, err := parseQueries(file, b)
+		if err != nil {
+			return err
+		}
+		for _, nq := range nqs {
+			if dup, ok := db.queries[nq.name]; ok {
+				return fmt.Errorf("%s: query %s already defined in %s", file, nq.name, dup.file)
+			}
+			err = db.checkQuery(nq)
+			if err != nil {
+				return fmt.Errorf("%s: query %s: %v", file, nq.name, err)
+			}
+			db.queries[nq.name] = nq
+		}
+	}
+	return nil
+}
+
+// split a .sql file into named queries
+func parseQueries(file string, b []byte) ([]*namedSQL, error) {
+	nqs := make([]*namedSQL, 0)
+	var cur *namedSQL
+	var body []string
+	done := func() {
+		if cur != nil {
+			cur.s = strings.TrimSpace(strings.Join(body, "\n"))
+			nqs = append(nqs, cur)
+		}
+		body = nil
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		m := queryHeaderPat.FindStringSubmatch(strings.TrimSpace(line))
+		switch {
+		case m != nil && m[1] == "name":
+			done()
+			cur = &namedSQL{name: strings.TrimSpace(m[2]), file: file}
+			if cur.name == "" {
+				return nil, fmt.Errorf("%s:%d: missing query name", file, n)
+			}
+		case cur == nil:
+			if s := strings.TrimSpace(line); s != "" && !strings.HasPrefix(s, "--") {
+				return nil, fmt.Errorf("%s:%d: SQL before first -- :name", file, n)
+			}
+		case m != nil && len(body) == 0:
+			switch m[1] {
+			case "relation":
+				cur.rel = strings.TrimSpace(m[2])
+			case "doc":
+				cur.doc = strings.TrimSpace(m[2])
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown header :%s", file, n, m[1])
+			}
+		default:
+			body = append(body, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	done()
+	return nqs, nil
+}
+
+// check a loaded query against the Relation metadata
+func (db *DB) checkQuery(nq *namedSQL) error {
+	if nq.s == "" {
+		return fmt.Errorf("no SQL")
+	}
+	_, err := walkNamed(nq.s, func(name string) (string, error) {
+		return "$1", nil
+	})
+	if err != nil {
+		return err
+	}
+	rels, err := db.Relations()
+	if err != nil {
+		return err
+	}
+	if nq.rel != "" {
+		if _, ok := rels[nq.rel]; !ok {
+			return fmt.Errorf("No relation found: %s", nq.rel)
+		}
+	}
+	for _, m := range colNamedPat.FindAllStringSubmatch(nq.s, -1) {
+		if m[1] != "" {
+			continue // qualified by an alias
+		}
+		found := false
+		for _, rel := range rels {
+			if rel.col(m[2]) != nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("placeholder :%s is compared to unknown column %s", m[4], m[2])
+		}
+	}
+	return nil
+}
+
+// Statement is a query loaded by LoadQueries. See DB.Named
+type Statement struct {
+	db  *DB
+	tx  queryer
+	nq  *namedSQL
+	err error
+}
+
+// Return the loaded query with the given name.
+// Errors are defered until the Statement is run
+func (db *DB) Named(name string) *Statement {
+	return db.named(db, name)
+}
+
+// Like DB.Named but runs inside the transaction
+func (tx *Tx) Named(name string) *Statement {
+	return tx.db.named(tx, name)
+}
+
+func (db *DB) named(tx queryer, name string) *Statement {
+	st := &Statement{db: db, tx: tx}
+	st.nq = db.queries[name]
+	if st.nq == nil {
+		st.err = fmt.Errorf("No query loaded with name: %s", name)
+	}
+	return st
+}
+
+// the documentation from the :doc header (if any)
+func (st *Statement) Doc() string {
+	if st.nq == nil {
+		return ""
+	}
+	return st.nq.doc
+}
+
+// bind params returning the relation (if any), SQL and args
+func (st *Statement) bind(params Params) (*Relation, string, []interface{}, error) {
+	if st.err != nil {
+		return nil, "", nil, st.err
+	}
+	s, args, err := bindNamed(st.nq.s, params)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if st.nq.rel == "" {
+		return nil, s, args, nil
+	}
+	rel, err := st.db.Relation(st.nq.rel)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	args, err = (&Query{from: rel}).bindParams(s, args)
+	return rel, s, args, err
+}
+
+// Run the query
+func (st *Statement) Query(params Params) (*Rows, error) {
+	rel, s, args, err := st.bind(params)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := st.tx.Query(s, args...)
+	if err != nil {
+		return nil, err
+	}
+	rs.rel = rel
+	return rs, nil
+}
+
+// Run the query scanning each row into a RecordValue
+// for the relation named by the query's :relation header
+func (st *Statement) QueryRecords(params Params) ([]RecordValue, error) {
+	rel, s, args, err := st.bind(params)
+	if err != nil {
+		return nil, err
+	}
+	if rel == nil {
+		return nil, fmt.Errorf("query %s has no :relation to scan records into", st.nq.name)
+	}
+	q := &Query{tx: st.tx, from: rel}
+	return q.query(s, args...)
+}
@@ -1,14 +1,23 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ErrNotFound is returned (possibly wrapped) by FetchOneErr, GetErr and
+// friends when no rows match. Check for it with errors.Is
+var ErrNotFound = errors.New("no rows found")
+
 type queryer interface {
 	Query(string, ...interface{}) (*Rows, error)
 	Relations() (map[string]*Relation, error)
@@ -16,22 +25,57 @@ type queryer interface {
 
 type Rows struct {
 	*sql.Rows
+	rel     *Relation    // relation the rows are from (if known)
+	tracker *rowsTracker // tracks if the rows are closed (if enabled)
+	leakID  uint64
+	release func()       // called once the rows are closed (if set)
+	timeout func() error // the Query timeout error once it has passed (if set)
+}
+
+// like sql.Rows#Err but reports rows cut short by a Query
+// Timeout as timing out rather than as cancelled
+func (rs *Rows) Err() error {
+	err := rs.Rows.Err()
+	if err != nil && rs.timeout != nil {
+		if terr := rs.timeout(); terr != nil {
+			return terr
+		}
+	}
+	return err
 }
 
 // Similar to sql.Rows#Scan but scans all values into a RecordValue
 func (rs *Rows) ScanRecord(v RecordValue) error {
+	return rs.scanRecord(v)
+}
+
+// like ScanRecord but the row has extra columns after
+// the record's which are scanned into dest
+func (rs *Rows) scanRecord(v RecordValue, dest ...interface{}) error {
 	// get list of vals as interface
-	vals := make([]interface{}, len(v.Values()))
-	for i, v := range v.Values() {
-		vals[i] = v
+	vals := make([]interface{}, 0, len(v.Values())+len(dest))
+	for _, v := range v.Values() {
+		vals = append(vals, v)
 	}
-	err := rs.Scan(vals...)
+	err := rs.Scan(append(vals, dest...)...)
 	if err != nil {
 		return err
 	}
+	setNotNull(v)
 	return nil
 }
 
+// Scan each column of the row (which must be whole-row composites
+// ie "SELECT person, location FROM ...") into the matching RecordValue.
+// A NULL composite (ie from an outer join) leaves its record NULL
+func (rs *Rows) ScanRecords(vs ...RecordValue) error {
+	vals := make([]interface{}, len(vs))
+	for i, v := range vs {
+		vals[i] = v
+	}
+	return rs.Scan(vals...)
+}
+
 type Query struct {
 	tx          queryer
 	from        *Relation
@@ -40,28 +84,179 @@ type Query struct {
 	order       string
 	limit       int
 	offset      int
-	err         error // some errors are defered until a call the Fetch(), Update() etc
+	cache       CacheStore      // optional store for Fetch results
+	ttl         time.Duration   // how long cached results live
+	fullWrite   bool            // allow Update/Delete without a WHERE
+	ctidTx      *Tx             // record the ctid of fetched rows in this Tx
+	lock        string          // row locking clause (if any)
+	cols        []string        // columns to fetch (nil means all)
+	picked      []string        // columns named in Select (selected when used as a subquery)
+	preloads    []*preload      // references to fetch after the rows
+	reverse     bool            // fetch in reverse order then flip the results (see Before)
+	joins       []join          // relations joined by JoinRef
+	exprs       []selectExpr    // expressions added by SelectExpr
+	ctes        []cte           // WITH clauses added by With and WithRecursive
+	union       *union          // queries combined by Union (selected from in place of the relation)
+	ctx         context.Context // context the statements are run with (nil means none)
+	timeout     time.Duration   // cancel statements that run longer than this (see Timeout)
+	err         error           // some errors are defered until a call the Fetch(), Update() etc
 }
 
 func (q *Query) cp() *Query {
 	if q.err != nil {
 		panic("cp should not be called when there is a pending error")
 	}
-	return &Query{
-		q.tx,
-		q.from,
-		q.where,
-		q.whereParams,
-		q.order,
-		q.limit,
-		q.offset,
-		q.err,
-	}
+	q2 := *q
+	return &q2
 }
 
 // Return a new Query based on this query with an additional
-// (WHERE) filter.
+// (WHERE) filter. The params can also be given by name as a single
+// Params, ie Where("age > :min AND age < :max", Params{"min": 18, "max": 65})
+// or by position with ? placeholders, ie Where("age > ? AND name = ?", 18, "bob")
+// A *Query param is used as a subquery, ie:
+//
+//	db.From("person").Where("location_id IN $1", db.From("location").Select("id").Where("name = $1", "home"))
 func (q *Query) Where(w string, params ...interface{}) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	if len(params) == 1 {
+		if named, ok := params[0].(Params); ok {
+			bw, bound, err := bindNamed(w, named)
+			if err != nil {
+				q2.err = fmt.Errorf("cannot use Where(%s): %v", w, err)
+				return q2
+			}
+			w, params = bw, bound
+		}
+	}
+	w = bindQuestion(w, len(params))
+	params, err := q.bindParams(w, params)
+	if err != nil {
+		q2.err = err
+		return q2
+	}
+	w, params, err = bindSubqueries(w, params)
+	if err != nil {
+		q2.err = fmt.Errorf("cannot use Where(%s): %v", w, err)
+		return q2
+	}
+	q2.where = append(q2.where, w)
+	q2.whereParams = append(q2.whereParams, params...)
+	return q2
+}
+
+// comparison operators used to find which column a param is compared
+// to. Key operators (ie jsonb ?) are left out as their right hand side
+// is not of the column's type
+const colOps = `(=|<>|!=|<=|>=|<|>|@>|<@|&&|\bLIKE\b|\bILIKE\b)`
+
+// regexp to match comparisons between a column and a placeholder ie "age >= $1"
+var colParamPat = regexp.MustCompile(`(?i)(?:(\w+)\.)?(\w+)\s*` + colOps + `\s*\$(\d+)`)
+
+// the right hand side of a containment operator is only of the column's
+// type for arrays (not ie range @> element or jsonb @> jsonb)
+func bindsAsCol(c *col, op string) bool {
+	switch op {
+	case "@>", "<@", "&&":
+		v, err := c.k(nil)
+		if err != nil {
+			return false
+		}
+		_, ok := v.(ArrayValue)
+		return ok
+	}
+	return true
+}
+
+// convert plain Go params into Values using the ToValue of the column
+// they are compared against in w, so that ie Where("age = $1", "17") binds
+// an Integer. Params that are already Values (or are not compared to a
+// known column) are passed through untouched
+func (q *Query) bindParams(w string, params []interface{}) ([]interface{}, error) {
+	if q.from == nil || len(params) == 0 {
+		return params, nil
+	}
+	var bound []interface{}
+	for _, m := range colParamPat.FindAllStringSubmatch(w, -1) {
+		if m[1] != "" && m[1] != q.from.Name {
+			continue // column of another relation
+		}
+		n, err := strconv.Atoi(m[4])
+		if err != nil || n < 1 || n > len(params) {
+			continue
+		}
+		p := params[n-1]
+		if p == nil {
+			continue
+		}
+		if _, ok := p.(driver.Valuer); ok {
+			continue
+		}
+		if _, ok := p.(*Query); ok {
+			continue
+		}
+		c := q.from.col(m[2])
+		if c == nil || !bindsAsCol(c, m[3]) {
+			continue
+		}
+		v, err := c.k(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use %v as param for column %s: %v", p, c.name, err)
+		}
+		if bound == nil {
+			bound = make([]interface{}, len(params))
+			copy(bound, params)
+		}
+		bound[n-1] = v
+	}
+	if bound == nil {
+		return params, nil
+	}
+	return bound, nil
+}
+
+// Return a new Query filtered to rows where the named column is one of
+// vals, bound as a single array param (col = ANY($1)) so the SQL is the
+// same however many values there are. A single slice is expanded, ie
+// WhereIn("id", []int64{1, 2}). No vals matches no rows
+func (q *Query) WhereIn(name string, vals ...interface{}) *Query {
+	if q.err != nil {
+		return q
+	}
+	c := q.from.col(name)
+	if c == nil {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("could not use WhereIn(%s) unknown column name", name)
+		return q2
+	}
+	if len(vals) == 1 {
+		if rv := reflect.ValueOf(vals[0]); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			vals = make([]interface{}, rv.Len())
+			for i := range vals {
+				vals[i] = rv.Index(i).Interface()
+			}
+		}
+	}
+	if vals == nil {
+		vals = []interface{}{}
+	}
+	v, err := Array(c.k)(vals)
+	if err != nil {
+		q2 := q.cp()
+		q2.err = fmt.Errorf("cannot use %v in WhereIn(%s): %v", vals, name, err)
+		return q2
+	}
+	return q.Where(fmt.Sprintf("%s = ANY($1)", name), v)
+}
+
+// Return a new Query with an additional (WHERE) filter whose params are
+// bound exactly as given, without the conversion to the type of the
+// compared column Where does. An escape hatch for predicates Where would
+// misread, ie Raw("name = ANY(string_to_array($1, ','))", "bob,alice")
+func (q *Query) Raw(w string, params ...interface{}) *Query {
 	if q.err != nil {
 		return q
 	}
@@ -146,6 +341,67 @@ func (q *Query) Limit(n int) *Query {
 	return q2
 }
 
+// Direction is the sort order of an OrderBy column
+type Direction int
+
+const (
+	Asc Direction = iota
+	Desc
+)
+
+func (d Direction) String() string {
+	if d == Desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// Return a new Query sorted by the named column (ascending unless
+// Desc is given). Each call adds a column to sort by after any
+// previous ones
+func (q *Query) OrderBy(name string, dir ...Direction) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	if q.from.col(name) == nil {
+		q2.err = fmt.Errorf("cannot order by %s: no such column on %s", name, q.from.Name)
+		return q2
+	}
+	d := Asc
+	if len(dir) > 0 {
+		d = dir[0]
+	}
+	if q2.order != "" {
+		q2.order += ","
+	}
+	q2.order += fmt.Sprintf("%s %s", name, d)
+	return q2
+}
+
+// Fetch a random sample of up to n records where the chance of each
+// record being picked is proportional to the weightCol column. Records
+// with a NULL or non-positive weight are never picked. Uses the
+// Efraimidis-Spirakis key (-ln(u)/weight) so it takes a single scan
+func (q *Query) SampleWeighted(weightCol string, n int) ([]RecordValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.from.col(weightCol) == nil {
+		return nil, fmt.Errorf("cannot sample by %s: no such column on %s", weightCol, q.from.Name)
+	}
+	q2 := q.Where(fmt.Sprintf("%s > 0", weightCol))
+	if q2.err != nil {
+		return nil, q2.err
+	}
+	q2 = q2.cp()
+	// 1 - random() is never 0 so ln is always finite
+	q2.order = fmt.Sprintf("-ln(1.0 - random()) / %s", weightCol)
+	q2.limit = n
+	q2.offset = 0
+	return q2.Fetch()
+}
+
 func (q *Query) Offset(n int) *Query {
 	if q.err != nil {
 		return q
@@ -155,11 +411,108 @@ func (q *Query) Offset(n int) *Query {
 	return q2
 }
 
+// regexp to match a plain relation name or alias
+var identPat = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Lock the fetched rows of only the named relations (or aliases)
+// with FOR UPDATE OF so rows from other relations referenced by the
+// query (ie reference data) are not locked too. Only meaningful
+// inside a transaction
+func (q *Query) ForUpdateOf(rels ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	if len(rels) == 0 {
+		q2.err = fmt.Errorf("ForUpdateOf requires at least one relation")
+		return q2
+	}
+	for _, name := range rels {
+		if !identPat.MatchString(name) {
+			q2.err = fmt.Errorf("ForUpdateOf: invalid relation name %q", name)
+			return q2
+		}
+	}
+	q2.lock = "FOR UPDATE OF " + strings.Join(rels, ", ")
+	return q2
+}
+
+// LockOption sets what a row locking clause (see ForUpdate)
+// does when a row is already locked by another transaction
+type LockOption int
+
+const (
+	// fail with an error rather than waiting for the lock
+	NoWait LockOption = iota + 1
+	// leave out rows that are locked rather than waiting, ie to claim
+	// the next unclaimed job from a queue:
+	//
+	//	tx.From("job").Where("done = false").OrderBy("id").Limit(1).ForUpdate(SkipLocked).FetchOne()
+	SkipLocked
+)
+
+func (o LockOption) String() string {
+	switch o {
+	case NoWait:
+		return "NOWAIT"
+	case SkipLocked:
+		return "SKIP LOCKED"
+	}
+	return fmt.Sprintf("LockOption(%d)", int(o))
+}
+
+// Lock the fetched rows with FOR UPDATE until the end of the
+// transaction. Only meaningful inside a transaction
+func (q *Query) ForUpdate(opts ...LockOption) *Query {
+	return q.withLock("FOR UPDATE", opts)
+}
+
+// Lock the fetched rows with FOR SHARE so they cannot be changed (but
+// can still be read and share locked) until the end of the transaction.
+// Only meaningful inside a transaction
+func (q *Query) ForShare(opts ...LockOption) *Query {
+	return q.withLock("FOR SHARE", opts)
+}
+
+func (q *Query) withLock(lock string, opts []LockOption) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	if len(opts) > 1 {
+		q2.err = fmt.Errorf("%s: only one of NoWait or SkipLocked can be used", lock)
+		return q2
+	}
+	for _, o := range opts {
+		if o != NoWait && o != SkipLocked {
+			q2.err = fmt.Errorf("%s: invalid %v", lock, o)
+			return q2
+		}
+		if o == SkipLocked && q.from.db != nil {
+			if err := q.from.db.require(FeatureSkipLocked); err != nil {
+				q2.err = err
+				return q2
+			}
+		}
+		lock += " " + o.String()
+	}
+	q2.lock = lock
+	return q2
+}
+
 func (q *Query) rows(s string, params ...interface{}) (*Rows, error) {
 	if q.err != nil {
 		return nil, q.err
 	}
-	return q.tx.Query(s, params...)
+	if q.from.db != nil && q.from.db.patterns != nil {
+		q.from.db.patterns.record(q)
+	}
+	rs, err := q.runQuery(s, params...)
+	if err != nil {
+		return nil, err
+	}
+	rs.rel = q.from
+	return rs, nil
 }
 
 func (q *Query) query(s string, params ...interface{}) ([]RecordValue, error) {
@@ -168,37 +521,192 @@ func (q *Query) query(s string, params ...interface{}) ([]RecordValue, error) {
 		return nil, err
 	}
 	defer rs.Close()
+	max := q.maxRows()
+	extras := q.extraExprs()
 	all := make([]RecordValue, 0)
 	for rs.Next() {
-		vx, err := q.from.k(nil)
-		if err != nil {
-			return nil, err
-		}
-		v, ok := vx.(RecordValue)
-		if !ok {
-			return nil, fmt.Errorf("%T is not a RecordValue", vx)
+		if max > 0 && len(all) == max {
+			return nil, fmt.Errorf("%w: %s returned more than %d rows", ErrTooManyRows, q.from.Name, max)
 		}
-		v.SetRelation(q.from)
-		err = rs.ScanRecord(v)
+		v, err := q.scanRow(rs, extras)
 		if err != nil {
 			return nil, err
 		}
 		all = append(all, v)
 	}
+	err = rs.Err()
+	if err != nil {
+		return nil, err
+	}
+	if q.reverse {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
 	return all, nil
 }
 
+// scan the current row of rs into a new RecordValue
+// followed by the values of the extra expressions
+func (q *Query) scanRow(rs *Rows, extras []selectExpr) (RecordValue, error) {
+	vx, err := q.from.k(nil)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := vx.(RecordValue)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a RecordValue", vx)
+	}
+	v.SetRelation(q.from)
+	extra := make([]interface{}, len(extras))
+	for i := range extra {
+		extra[i] = new(interface{})
+	}
+	if q.ctidTx != nil {
+		err = q.ctidTx.scanCtid(rs, v, extra...)
+	} else {
+		err = rs.scanRecord(v, extra...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.cols != nil {
+		setPartial(v, q.loadedCols())
+	}
+	for i, e := range extras {
+		setExtra(v, e.alias, *extra[i].(*interface{}))
+	}
+	return v, nil
+}
+
 // perform a SELECT for the current query and
 // return a slice of RecordValues
 func (q *Query) Fetch() ([]RecordValue, error) {
 	if q.err != nil {
 		return nil, q.err
 	}
-	return q.query(q.selectSql(), q.selectArgs()...)
+	if q2, ok := q.withCtid(); ok {
+		return q2.preloaded(q2.query(q2.fetchSql(), q2.selectArgs()...))
+	}
+	var vs []RecordValue
+	var err error
+	if _, inTx := q.tx.(*Tx); q.cache != nil && !inTx {
+		vs, err = q.cachedQuery()
+	} else {
+		vs, err = q.query(q.selectSql(), q.selectArgs()...)
+	}
+	if err == nil {
+		q.shadowRead(vs)
+	}
+	return q.preloaded(vs, err)
+}
+
+// rows identified by ctid (see IdentityCtid) are fetched with their
+// ctid so they can be written later in the same Tx. Returns the query
+// to fetch them with and whether it records ctids
+func (q *Query) withCtid() (*Query, bool) {
+	tx, ok := q.tx.(*Tx)
+	if !ok || q.from.identity.kind != identityCtid || q.union != nil {
+		return q, false
+	}
+	q2 := q.cp()
+	q2.ctidTx = tx
+	return q2, true
+}
+
+// the SELECT that Fetch runs
+func (q *Query) fetchSql() string {
+	if q.ctidTx != nil {
+		return q.selectSql(q.fieldList(), q.from.Name+".ctid")
+	}
+	return q.selectSql()
+}
+
+// Return the statement and args Fetch would run, ie to log
+// or test the generated SQL or to run it some other way
+func (q *Query) ToSQL() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	q2, _ := q.withCtid()
+	args := q2.selectArgs()
+	return castComposites(q2.fetchSql(), args), args, nil
+}
+
+// like Fetch but returns the RecordValues keyed by
+// primary key (as returned by Val)
+func (q *Query) FetchMap() (map[interface{}]RecordValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	pk := q.from.pk()
+	if pk == nil {
+		return nil, fmt.Errorf("No primary key found for relation %s", q.from.Name)
+	}
+	return q.FetchMapBy(pk.name)
+}
+
+// like FetchMap but keyed by the named column. Returns an error if
+// the column is NULL or has the same value for more than one row
+func (q *Query) FetchMapBy(name string) (map[interface{}]RecordValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.from.col(name) == nil {
+		return nil, fmt.Errorf("could not FetchMapBy %s unknown column name", name)
+	}
+	vs, err := q.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[interface{}]RecordValue, len(vs))
+	for _, v := range vs {
+		key := v.Get(name)
+		if key == nil {
+			return nil, fmt.Errorf("could not FetchMapBy %s: NULL key in %s", name, q.from.Name)
+		}
+		if !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("could not FetchMapBy %s: %T cannot be used as a key", name, key)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("could not FetchMapBy %s: duplicate key %v in %s", name, key, q.from.Name)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// like Fetch but groups the RecordValues by the Val of the named column
+// (rows where it is NULL are grouped under nil), ie to build a map of
+// parent id to children:
+//
+//	byPerson, err := db.From("membership").FetchGrouped("person_id")
+func (q *Query) FetchGrouped(name string) (map[interface{}][]RecordValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.from.col(name) == nil {
+		return nil, fmt.Errorf("could not FetchGrouped %s unknown column name", name)
+	}
+	vs, err := q.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[interface{}][]RecordValue)
+	for _, v := range vs {
+		key := v.Get(name)
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("could not FetchGrouped %s: %T cannot be used as a key", name, key)
+		}
+		m[key] = append(m[key], v)
+	}
+	return m, nil
 }
 
 // perform a SELECT and return a single RecordValue for this query
 // will return nil if no rows where returned
+//
+// Deprecated: the nil result is easy to miss, use FetchOneErr
 func (q *Query) FetchOne() (RecordValue, error) {
 	rs, err := q.Limit(1).Fetch()
 	if err != nil {
@@ -210,8 +718,52 @@ func (q *Query) FetchOne() (RecordValue, error) {
 	return rs[0], nil
 }
 
+// like FetchOne but returns ErrNotFound if no rows where returned
+func (q *Query) FetchOneErr() (RecordValue, error) {
+	v, err := q.FetchOne()
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w in %s", ErrNotFound, q.from.Name)
+	}
+	return v, nil
+}
+
+// Fetch the record with the lowest primary key (ignoring any other
+// sort order) or nil if there are no records
+func (q *Query) First() (RecordValue, error) {
+	return q.byKey(Asc).FetchOne()
+}
+
+// Fetch the record with the highest primary key (ignoring any other
+// sort order) or nil if there are no records
+func (q *Query) Last() (RecordValue, error) {
+	return q.byKey(Desc).FetchOne()
+}
+
+// sort only by the primary key
+func (q *Query) byKey(dir Direction) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	pks := q.from.pks()
+	if len(pks) == 0 {
+		q2.err = fmt.Errorf("cannot sort %s by primary key: no primary key", q.from.Name)
+		return q2
+	}
+	q2.order = ""
+	for _, c := range pks {
+		q2 = q2.OrderBy(c.name, dir)
+	}
+	return q2
+}
+
 // create a new Query with a WHERE filter for the relation's
 // primary key and the call FetchOne
+//
+// Deprecated: the nil result is easy to miss, use GetErr
 func (q *Query) Get(pk interface{}) (RecordValue, error) {
 	if q.err != nil {
 		return nil, q.err
@@ -220,15 +772,109 @@ func (q *Query) Get(pk interface{}) (RecordValue, error) {
 	if pkcol == nil {
 		return nil, fmt.Errorf("No primary key found for relation %s", q.from.Name)
 	}
+	// only use the relation's cache for plain lookups of whole records
+	// outside of a transaction so uncommitted data never ends up cached
+	_, direct := q.tx.(*DB)
+	cacheable := direct && q.from.cache != nil && q.plainLookup()
+	if cacheable {
+		if v := q.from.cached(pk); v != nil {
+			return v, nil
+		}
+	}
 	s := fmt.Sprintf(`%s = $1`, pkcol.name)
-	return q.Where(s, pk).FetchOne()
+	v, err := q.Where(s, pk).FetchOne()
+	if err != nil {
+		return nil, err
+	}
+	if cacheable && v != nil {
+		q.from.cacheRecord(v)
+	}
+	return v, nil
+}
+
+// reports whether the query fetches whole records with no filter,
+// expressions, preloads or locking so Get can use the relation's cache
+func (q *Query) plainLookup() bool {
+	return len(q.where) == 0 && q.cols == nil && len(q.exprs) == 0 &&
+		len(q.preloads) == 0 && len(q.joins) == 0 && q.lock == ""
+}
+
+// like Get but returns ErrNotFound if there is no record with primary key pk
+func (q *Query) GetErr(pk interface{}) (RecordValue, error) {
+	v, err := q.Get(pk)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w in %s with primary key %v", ErrNotFound, q.from.Name, pk)
+	}
+	return v, nil
+}
+
+// like GetErr but panics on error
+func (q *Query) MustGet(pk interface{}) RecordValue {
+	v, err := q.GetErr(pk)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// like GetErr but matches on a set of columns that form a unique key,
+// ie:
+//
+//	v, err := db.From("membership").GetBy(map[string]interface{}{
+//		"person_id": 1, "location_id": 100,
+//	})
+//
+// Returns an error if the columns are not covered by a unique index
+func (q *Query) GetBy(cols map[string]interface{}) (RecordValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("GetBy requires at least one column")
+	}
+	names := make([]string, 0, len(cols))
+	for name := range cols {
+		if q.from.col(name) == nil {
+			return nil, fmt.Errorf("could not GetBy %s unknown column name", name)
+		}
+		if cols[name] == nil {
+			return nil, fmt.Errorf("could not GetBy NULL %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !q.from.isUnique(names) {
+		return nil, fmt.Errorf("could not GetBy (%s) no unique index on %s covers those columns",
+			strings.Join(names, ","), q.from.Name)
+	}
+	q2 := q
+	for _, name := range names {
+		q2 = q2.Where(fmt.Sprintf("%s = $1", name), cols[name])
+	}
+	v, err := q2.FetchOne()
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w in %s with %v", ErrNotFound, q.from.Name, cols)
+	}
+	return v, nil
 }
 
 func (q *Query) agg(sel string, v Value, vals ...interface{}) error {
 	if q.err != nil {
 		return q.err
 	}
-	rs, err := q.rows(q.selectSql(sel), q.selectArgs()...)
+	// aggregates return a single row so sorting is meaningless
+	// (and an error for columns that are not aggregated) as is
+	// locking the rows (which is also an error)
+	q2 := q.cp()
+	q2.order = ""
+	q2.lock = ""
+	rs, err := q2.rows(q2.selectSql(sel), q2.selectArgs()...)
 	if err != nil {
 		return err
 	}
@@ -256,6 +902,25 @@ func (q *Query) Count() (int64, error) {
 	return v.Val().(int64), nil
 }
 
+// Return the planner's estimate of the number of rows the query matches
+// without running it, ie for UI badges on huge tables where count(*) is
+// too slow. Unfiltered queries use the relation's statistics (see
+// Relation.ApproxCount) otherwise the estimate is read from EXPLAIN so
+// it is only as good as the planner's guess for the filters
+func (q *Query) EstimatedCount() (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if len(q.where) == 0 && len(q.joins) == 0 && len(q.ctes) == 0 && q.union == nil && q.limit == 0 && q.from.db != nil {
+		return q.from.ApproxCount()
+	}
+	p, err := q.explain("FORMAT JSON")
+	if err != nil {
+		return 0, err
+	}
+	return int64(p.PlanRows), nil
+}
+
 // perform a "SELECT sum(x)" query
 func (q *Query) Sum(name string) (Value, error) {
 	if q.err != nil {
@@ -352,14 +1017,19 @@ func (q *Query) ArrayAgg(name string) (Value, error) {
 func (q *Query) selectSql(names ...string) string {
 	cols := strings.Join(names, ",")
 	if cols == "" {
-		cols = q.from.fields(true)
+		cols = q.fieldList()
 	}
-	return fmt.Sprintf(`SELECT %s FROM %s %s %s %s`,
+	nwith := len(q.withArgs())
+	return fmt.Sprintf(`%sSELECT %s FROM %s %s %s %s %s %s %s`,
+		q.withExpr(),
 		cols,
-		q.from.Name,
-		q.whereExpr(),
+		q.fromExpr(nwith),
+		q.joinExpr(),
+		q.whereExprFrom(nwith+len(q.unionArgs())),
+		q.orderExpr(),
 		q.limitExpr(),
-		q.offsetExpr())
+		q.offsetExpr(),
+		q.lock)
 }
 
 // regexp to match the $X placeholders in queries
@@ -367,40 +1037,69 @@ var placePat = regexp.MustCompile(`(?:[^\\]\$)(\d+)`)
 
 // convert all the where expressions into a single one
 func (q *Query) whereExpr() string {
+	return q.whereExprFrom(0)
+}
+
+// like whereExpr but the placeholders start after $offset so other
+// params (ie the SET of an UPDATE) can be bound before the where params.
+// Each expression numbers its own placeholders from $1 so they are
+// shifted by the highest placeholder of the expressions before it
+func (q *Query) whereExprFrom(offset int) string {
 	if len(q.where) == 0 {
 		return ""
 	}
 	sts := make([]string, len(q.where))
-	var i int64
 	for idx, st := range q.where {
-		if i == 0 { // find the bigest $X in this string
-			matches := placePat.FindAllStringSubmatch(st, -1)
-			if len(matches) == 0 {
-				continue
-			}
-			for _, m := range matches {
-				n, err := strconv.ParseInt(m[1], 10, 64)
-				if err != nil {
-					panic(fmt.Sprintf("could not convert %s to int", m[1]))
-				}
-				if n > i {
-					i = n
-				}
-			}
-		} else { // update each $X we find by adding i to it
-			st = placePat.ReplaceAllStringFunc(st, func(m string) string {
-				n, err := strconv.ParseInt(m[2:], 10, 64)
-				if err != nil {
-					panic(fmt.Sprintf("could not convert %s to int", m[2:]))
-				}
-				return fmt.Sprintf(`%s%d`, m[0:2], n+1)
-			})
-		}
-		sts[idx] = st
+		sts[idx] = renumber(st, offset)
+		offset += maxPlaceholder(st)
 	}
 	return fmt.Sprintf(`WHERE %s`, strings.Join(sts, " AND "))
 }
 
+// find the bigest $X in s
+func maxPlaceholder(s string) int {
+	max := 0
+	for _, m := range placePat.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			panic(fmt.Sprintf("could not convert %s to int", m[1]))
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// add offset to each $X in s
+func renumber(s string, offset int) string {
+	if offset == 0 {
+		return s
+	}
+	return placePat.ReplaceAllStringFunc(s, func(m string) string {
+		n, err := strconv.Atoi(m[2:])
+		if err != nil {
+			panic(fmt.Sprintf("could not convert %s to int", m[2:]))
+		}
+		return fmt.Sprintf(`%s%d`, m[0:2], n+offset)
+	})
+}
+
+func (q *Query) orderExpr() string {
+	if q.order == "" {
+		return ""
+	}
+	if !q.reverse {
+		return fmt.Sprintf(`ORDER BY %s`, q.order)
+	}
+	names, dirs := q.orderCols()
+	terms := make([]string, len(names))
+	for i, name := range names {
+		terms[i] = fmt.Sprintf("%s %s", name, 1-dirs[i])
+	}
+	return fmt.Sprintf(`ORDER BY %s`, strings.Join(terms, ","))
+}
+
 func (q *Query) limitExpr() string {
 	if q.limit == 0 {
 		return ""
@@ -418,6 +1117,8 @@ func (q *Query) offsetExpr() string {
 // return the vals to bind to placholders for selectSql
 func (q *Query) selectArgs() []interface{} {
 	vals := make([]interface{}, 0)
+	vals = append(vals, q.withArgs()...)
+	vals = append(vals, q.unionArgs()...)
 	vals = append(vals, q.whereParams...)
 	return vals
 }
@@ -0,0 +1,886 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a Relation that is not backed by a DB for testing Query building
+func testRelation() *Relation {
+	cols := []*col{
+		Col("id", BigInt),
+		Col("name", Text),
+		Col("age", Integer),
+		Col("tags", Array(Text)),
+	}
+	cols[0].pk = true
+	return &Relation{Name: "person", k: Record(cols...), cols: cols}
+}
+
+func TestWhereBindsColumnValues(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("age >= $1 AND person.name LIKE $2", "17", "b%").
+		And("tags @> $1", []interface{}{"x"})
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if v, ok := q.whereParams[0].(Value); !ok || v.Val().(int64) != 17 {
+		t.Errorf("expected age param to be bound as an Integer got: %#v", q.whereParams[0])
+	}
+	if _, ok := q.whereParams[1].(Value); !ok {
+		t.Errorf("expected name param to be bound as Text got: %#v", q.whereParams[1])
+	}
+	if v, ok := q.whereParams[2].(Value); !ok || v.String() != `{"x"}` {
+		t.Errorf("expected tags param to be bound as an Array got: %#v", q.whereParams[2])
+	}
+	q = (&Query{from: testRelation()}).Where("age = $1", "old")
+	if q.err == nil {
+		t.Errorf("expected an error binding a non-integer to age")
+	}
+	q = (&Query{from: testRelation()}).Where("lower(name) = $1", 1)
+	if q.err != nil || q.whereParams[0] != 1 {
+		t.Errorf("expected params not compared to a column to be passed through")
+	}
+	rel := NewRelation("thing",
+		Col("id", BigInt, PrimaryKey()),
+		Col("attrs", HStore),
+		Col("doc", JSONB),
+		Col("r", Range(Integer)))
+	q = (&Query{from: rel}).
+		Where("attrs ? $1 AND doc ? $2 AND r @> $3 AND doc @> $4", "k", "k", 5, `{"a":1}`).
+		Where("other.id = $1", "x")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	for i, p := range q.whereParams {
+		if _, ok := p.(Value); ok {
+			t.Errorf("expected param %d not to be bound as the column type got: %#v", i, p)
+		}
+	}
+}
+
+func TestWhereExprRenumbers(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("age > $1 AND age < $2", 1, 2).
+		And("name = $1 OR name = $1", "bob").
+		And("id IS NOT NULL").
+		And("id = $1", 3)
+	expected := `WHERE age > $1 AND age < $2 AND name = $3 OR name = $3 AND id IS NOT NULL AND id = $4`
+	if s := q.whereExpr(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if s := q.whereExprFrom(2); !strings.HasPrefix(s, `WHERE age > $3 AND age < $4 AND name = $5`) {
+		t.Errorf("expected placeholders to start from $3 got: %s", s)
+	}
+}
+
+func TestFullTableWriteGuard(t *testing.T) {
+	q := &Query{from: testRelation()}
+	if _, err := q.Delete(); !errors.Is(err, ErrFullTableWrite) {
+		t.Errorf("expected ErrFullTableWrite got: %v", err)
+	}
+	if _, err := q.Update(map[string]interface{}{"age": 1}); !errors.Is(err, ErrFullTableWrite) {
+		t.Errorf("expected ErrFullTableWrite got: %v", err)
+	}
+	if err := q.AllowFullTableWrite().checkWrite(); err != nil {
+		t.Errorf("expected AllowFullTableWrite to permit the write got: %v", err)
+	}
+	w := q.Where("age > $1", 1)
+	for _, q := range []*Query{w.Limit(1), w.Offset(1), w.OrderBy("age"), w.ForUpdate()} {
+		if _, err := q.Delete(); err == nil {
+			t.Errorf("expected Delete to refuse a query with a limit, order or lock")
+		}
+	}
+}
+
+func TestGetByRequiresUniqueIndex(t *testing.T) {
+	rel := testRelation()
+	rel.uniques = [][]string{{"id"}, {"name", "age"}}
+	q := &Query{from: rel}
+	if !rel.isUnique([]string{"age", "name", "tags"}) {
+		t.Errorf("expected (age,name,tags) to be unique")
+	}
+	if _, err := q.GetBy(map[string]interface{}{"name": "bob"}); err == nil {
+		t.Errorf("expected non unique columns to return an error")
+	}
+	if _, err := q.GetBy(map[string]interface{}{"nope": 1}); err == nil {
+		t.Errorf("expected unknown column to return an error")
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob, jr", nil, []interface{}{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	CSV.Begin(&b, rel)
+	if err = CSV.Encode(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,name,age,tags\n1,\"bob, jr\",,\"{\"\"a\"\"}\"\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, b.String())
+	}
+	b.Reset()
+	if err = NDJSON.Encode(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), `{"id":1,"name":"bob, jr","age":null,`) {
+		t.Errorf("unexpected NDJSON: %s", b.String())
+	}
+}
+
+func TestCastComposites(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anon, _ := Record(Col("a", Text))([]interface{}{"x"})
+	s := castComposites("SELECT f($1, $2, $1::text, $10)", []interface{}{v, anon, 3, 4, 5, 6, 7, 8, 9, 10})
+	if s != "SELECT f($1::person, $2, $1::text, $10)" {
+		t.Errorf("unexpected cast sql: %s", s)
+	}
+	typed, _ := compositeRecord("thing", Col("a", Text))([]interface{}{"x"})
+	if s = castComposites("SELECT $1", []interface{}{typed}); s != "SELECT $1::thing" {
+		t.Errorf("expected composite type cast got: %s", s)
+	}
+	if b, err := v.Value(); err != nil || string(b.([]byte)) != `(1,"bob",,)` {
+		t.Errorf("expected record param to encode as a row got: %s %v", b, err)
+	}
+}
+
+func TestForUpdate(t *testing.T) {
+	q := (&Query{from: testRelation()}).OrderBy("id").Limit(1).ForUpdate(SkipLocked)
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if s := q.selectSql(); !strings.HasSuffix(s, "LIMIT 1  FOR UPDATE SKIP LOCKED") {
+		t.Errorf("expected locking clause after LIMIT got: %s", s)
+	}
+	if s := (&Query{from: testRelation()}).ForShare(NoWait).lock; s != "FOR SHARE NOWAIT" {
+		t.Errorf("unexpected lock: %s", s)
+	}
+	if q = (&Query{from: testRelation()}).ForUpdate(NoWait, SkipLocked); q.err == nil {
+		t.Errorf("expected NoWait with SkipLocked to fail")
+	}
+}
+
+func TestForUpdateOf(t *testing.T) {
+	q := (&Query{from: testRelation()}).Where("age > $1", 17).Limit(1).ForUpdateOf("person")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if s := q.selectSql(); !strings.HasSuffix(strings.TrimSpace(s), "LIMIT 1  FOR UPDATE OF person") {
+		t.Errorf("expected locking clause after LIMIT got: %s", s)
+	}
+	if q = (&Query{from: testRelation()}).ForUpdateOf(); q.err == nil {
+		t.Errorf("expected ForUpdateOf without relations to fail")
+	}
+	if q = (&Query{from: testRelation()}).ForUpdateOf("person; DROP TABLE x"); q.err == nil {
+		t.Errorf("expected invalid relation name to fail")
+	}
+}
+
+func TestWhereStruct(t *testing.T) {
+	type base struct {
+		Name *string
+	}
+	type filter struct {
+		base
+		MinAge int      `db:"age" where:">="`
+		MaxAge *int     `db:"age" where:"<"`
+		IDs    []int64  `db:"id" where:"in"`
+		Tags   []string `where:"@>"`
+		Skip   string   `db:"-"`
+	}
+	name := "bob"
+	zero := 0
+	q := (&Query{from: testRelation()}).WhereStruct(&filter{
+		base:   base{&name},
+		MinAge: 18,
+		MaxAge: &zero,
+		IDs:    []int64{1, 2},
+		Skip:   "x",
+	})
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WHERE name = $1 AND age >= $2 AND age < $3 AND id = ANY($4)"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if len(q.whereParams) != 4 || q.whereParams[3].(Value).String() != "{1,2}" {
+		t.Errorf("unexpected params: %v", q.whereParams)
+	}
+	if q = (&Query{from: testRelation()}).WhereStruct(filter{}); q.err != nil || len(q.where) != 0 {
+		t.Errorf("expected an empty filter to add no conditions")
+	}
+	bad := []interface{}{
+		struct{ Missing int }{1},
+		struct {
+			Age int `where:"~"`
+		}{1},
+		struct {
+			Age int `where:"in"`
+		}{1},
+		7,
+	}
+	for _, f := range bad {
+		if q = (&Query{from: testRelation()}).WhereStruct(f); q.err == nil {
+			t.Errorf("expected %#v to fail", f)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	person := testRelation()
+	lcols := []*col{Col("id", Integer), Col("name", Text)}
+	lcols[0].pk = true
+	location := &Relation{Name: "location", k: Record(lcols...), cols: lcols}
+	fk := Col("location_id", Integer)
+	fk.refT, fk.refF = "location", "id"
+	person.cols = append(person.cols, fk)
+	person.k = Record(person.cols...)
+	person.refs = []*ref{{"location", ref_hasOne, location, fk}}
+	location.refs = []*ref{{"person", ref_hasMany, person, fk}}
+
+	q := (&Query{from: person}).Fields("name", "location.name")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "id,name,NULL,NULL,location_id"
+	if f := q.fieldList(); f != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, f)
+	}
+	if len(q.preloads) != 1 || strings.Join(q.preloads[0].cols, ",") != "name,id" {
+		t.Errorf("unexpected preloads: %v", q.preloads)
+	}
+	q = (&Query{from: location}).Fields("person")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if f := q.fieldList(); f != "id,NULL" {
+		t.Errorf("expected only the key columns got: %s", f)
+	}
+	if len(q.preloads) != 1 || q.preloads[0].cols != nil {
+		t.Errorf("expected all person columns to be preloaded got: %v", q.preloads)
+	}
+	for _, f := range []string{"missing", "location.missing", "location.name.x"} {
+		if q = (&Query{from: person}).Fields(f); q.err == nil {
+			t.Errorf("expected %s to fail", f)
+		}
+	}
+	if q = (&Query{from: person}).Select("missing"); q.err == nil {
+		t.Errorf("expected selecting an unknown column to fail")
+	}
+}
+
+func TestChecksumSql(t *testing.T) {
+	rel := testRelation()
+	s, args, err := rel.checksumSql(nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT count(*), COALESCE(md5(string_agg(md5(ROW(age,id,name,tags)::text), '' ORDER BY id)), '') FROM person WHERE id <= $1`
+	if s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if len(args) != 1 || args[0].(Value).Val() != int64(10) {
+		t.Errorf("unexpected args: %v", args)
+	}
+	if _, _, err = rel.checksumSql("x", nil); err == nil {
+		t.Errorf("expected a bad primary key to fail")
+	}
+	if _, _, err = testMembership().checksumSql(nil, nil); err == nil {
+		t.Errorf("expected a composite primary key to fail")
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	rel := testRelation()
+	rec := func(vals ...interface{}) RecordValue {
+		v, err := rel.New(vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	primary := []RecordValue{rec(1, "bob", 20, nil), rec(2, "jeff", 30, nil), rec(3, "alice", nil, nil)}
+	shadow := []RecordValue{rec(4, "zed", 1, nil), rec(2, "jeff", 31, nil), rec(1, "bob", 20, nil), rec(3, "alice", 0, nil)}
+	diffs := diffRecords(rel, primary, shadow)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs got: %d", len(diffs))
+	}
+	if d := diffs[0]; d.Key != "2" || strings.Join(d.Cols, ",") != "age" {
+		t.Errorf("expected age of 2 to differ got: %+v", d)
+	}
+	if d := diffs[1]; d.Key != "3" || strings.Join(d.Cols, ",") != "age" {
+		t.Errorf("expected NULL and 0 to differ got: %+v", d)
+	}
+	if d := diffs[2]; d.Key != "4" || d.Primary != nil || d.Shadow == nil {
+		t.Errorf("expected 4 to only be on the shadow got: %+v", d)
+	}
+
+	ist := time.FixedZone("", 5*3600+1800)
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		k    ToValue
+		p, s interface{}
+	}{
+		{TimestampTZ, at, at.In(ist)},
+		{Numeric(10, 2), "1.5", "1.50"},
+		{JSONB, `{"a":1,"b":2}`, `{"b":2,"a":1}`},
+	} {
+		rel := NewRelation("thing", Col("id", BigInt, PrimaryKey()), Col("x", tc.k))
+		p, err := rel.New([]interface{}{1, tc.p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := rel.New([]interface{}{1, tc.s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diffs := diffRecords(rel, []RecordValue{p}, []RecordValue{s}); len(diffs) != 0 {
+			t.Errorf("expected %v and %v to be the same got: %v", tc.p, tc.s, diffs[0].Cols)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	q := (&Query{from: testRelation()}).OrderBy("age", Desc).OrderBy("name").Limit(2)
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "SELECT id,name,age,tags FROM person   ORDER BY age DESC,name ASC LIMIT 2  "
+	if s := q.selectSql(); s != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, s)
+	}
+	if q = (&Query{from: testRelation()}).OrderBy("age; DROP TABLE person"); q.err == nil {
+		t.Errorf("expected ordering by an unknown column to fail")
+	}
+}
+
+func TestSortByKey(t *testing.T) {
+	q := (&Query{from: testRelation()}).OrderBy("age").byKey(Desc)
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if o := q.orderExpr(); o != "ORDER BY id DESC" {
+		t.Errorf("expected only the primary key order got: %s", o)
+	}
+	rel := testRelation()
+	rel.cols[0].pk = false
+	if q := (&Query{from: rel}).byKey(Asc); q.err == nil {
+		t.Errorf("expected sorting a relation without a primary key to fail")
+	}
+}
+
+func TestKeysetCursors(t *testing.T) {
+	rel := testRelation()
+	q := (&Query{from: rel}).OrderBy("age", Desc).sortedByKey()
+	v, err := rel.New([]interface{}{7, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := q.cursor(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := (&Query{from: rel}).OrderBy("age", Desc).After(cursor)
+	if after.err != nil {
+		t.Fatal(after.err)
+	}
+	expected := "WHERE (age,id) < ($1,$2) ORDER BY age DESC,id DESC"
+	if s := after.whereExpr() + " " + after.orderExpr(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if after.whereParams[0].(Value).Val() != int64(20) || after.whereParams[1].(Value).Val() != int64(7) {
+		t.Errorf("unexpected params: %v", after.whereParams)
+	}
+	before := (&Query{from: rel}).OrderBy("age", Desc).Before(cursor)
+	expected = "WHERE (age,id) > ($1,$2) ORDER BY age ASC,id ASC"
+	if s := before.whereExpr() + " " + before.orderExpr(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if q = (&Query{from: rel}).OrderBy("age", Desc).OrderBy("name").After(cursor); q.err == nil {
+		t.Errorf("expected mixed sort directions to fail")
+	}
+	if q = (&Query{from: rel}).After("junk"); q.err == nil {
+		t.Errorf("expected an invalid cursor to fail")
+	}
+	v.Set("age", nil)
+	q = (&Query{from: rel}).OrderBy("age", Desc).sortedByKey()
+	if _, err = q.cursor(v); err == nil || !strings.Contains(err.Error(), "NULL value of age") {
+		t.Errorf("expected a cursor for a NULL sort column to fail got: %v", err)
+	}
+	if q = (&Query{from: rel}).OrderBy("age").After("W251bGwsIjciXQ"); q.err == nil {
+		t.Errorf("expected a cursor holding NULL to fail")
+	}
+	if s, err := (&Query{from: rel}).OrderBy("age", Desc).OrderBy("name").pageCursor(v); s != "" || err != nil {
+		t.Errorf("expected no cursor for mixed sort directions got: %q %v", s, err)
+	}
+	if _, err = (&Query{from: rel}).Paginate(0, 10); err == nil {
+		t.Errorf("expected page 0 to fail")
+	}
+}
+
+func TestSampleWeightedColumn(t *testing.T) {
+	if _, err := (&Query{from: testRelation()}).SampleWeighted("weight", 1); err == nil {
+		t.Errorf("expected an unknown weight column to fail")
+	}
+}
+
+func TestJoinRefBuild(t *testing.T) {
+	person := testRelation()
+	lcols := []*col{Col("id", Integer, PrimaryKey()), Col("name", Text)}
+	location := NewRelation("location", lcols...)
+	fk := Col("location_id", Integer, References("location", "id"))
+	person.cols = append(person.cols, fk)
+	person.k = Record(person.cols...)
+	person.refs = []*ref{{"location", ref_hasOne, location, fk}}
+	location.refs = []*ref{{"person", ref_hasMany, person, fk}}
+
+	q := (&Query{from: person}).JoinRef("location").Where("location.name = $1", "g1")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "SELECT person.id,person.name,person.age,person.tags,person.location_id FROM person JOIN location location ON location.id = person.location_id WHERE location.name = $1"
+	if s := strings.TrimSpace(q.selectSql()); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	q = (&Query{from: location}).JoinRef("person").JoinRef("person")
+	expected = "JOIN person person ON person.location_id = location.id"
+	if s := q.joinExpr(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if q = (&Query{from: person}).JoinRef("missing"); q.err == nil {
+		t.Errorf("expected joining an unknown reference to fail")
+	}
+	q = (&Query{from: person}).JoinRef("location").Where("id = 1")
+	if _, err := q.Delete(); err == nil {
+		t.Errorf("expected Delete with a join to fail")
+	}
+}
+
+func TestWhereCond(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("name = $1", "bob").
+		WhereCond(And(
+			Cond("age >= $1", "18"),
+			Or(Cond("$1 = ANY(tags)", "x"), Cond("age < $1 AND name = $2", 10, "y")),
+		))
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WHERE name = $1 AND ((age >= $2) AND (($3 = ANY(tags)) OR (age < $4 AND name = $5)))"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if len(q.whereParams) != 5 {
+		t.Fatalf("expected 5 params got: %v", q.whereParams)
+	}
+	if v, ok := q.whereParams[1].(Value); !ok || v.Val() != int64(18) {
+		t.Errorf("expected age param to be bound as an Integer got: %#v", q.whereParams[1])
+	}
+	if s, _ := Or().sql(0); s != "FALSE" {
+		t.Errorf("expected an empty Or to be FALSE got: %s", s)
+	}
+}
+
+func TestWhereIn(t *testing.T) {
+	for _, q := range []*Query{
+		(&Query{from: testRelation()}).WhereIn("id", 1, "2", int64(3)),
+		(&Query{from: testRelation()}).WhereIn("id", []int{1, 2, 3}),
+	} {
+		if q.err != nil {
+			t.Fatal(q.err)
+		}
+		if w := q.whereExpr(); w != "WHERE id = ANY($1)" {
+			t.Errorf("unexpected where: %s", w)
+		}
+		if s := q.whereParams[0].(Value).String(); s != "{1,2,3}" {
+			t.Errorf("expected the values to be bound as one array got: %s", s)
+		}
+	}
+	if q := (&Query{from: testRelation()}).WhereIn("id"); q.err != nil || q.whereParams[0].(Value).String() != "{}" {
+		t.Errorf("expected no values to bind an empty array")
+	}
+	if q := (&Query{from: testRelation()}).WhereIn("id", "x"); q.err == nil {
+		t.Errorf("expected a bad value to fail")
+	}
+	if q := (&Query{from: testRelation()}).WhereIn("missing", 1); q.err == nil {
+		t.Errorf("expected an unknown column to fail")
+	}
+}
+
+func TestWhereNamed(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("name = $1", "bob").
+		Where("age > :min AND age < :max OR age = :min", Params{"min": 18, "max": "65"})
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WHERE name = $1 AND age > $2 AND age < $3 OR age = $2"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if len(q.whereParams) != 3 {
+		t.Fatalf("expected 3 params got: %v", q.whereParams)
+	}
+	if v, ok := q.whereParams[2].(Value); !ok || v.String() != "65" {
+		t.Errorf("expected named params to be converted to the column type got: %#v", q.whereParams[2])
+	}
+	if q := (&Query{from: testRelation()}).Where("age > :min", Params{}); q.err == nil {
+		t.Errorf("expected a missing named param to fail")
+	}
+}
+
+func TestWhereQuestion(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("name = $1", "bob").
+		Where("age > ? AND name <> 'why?' AND age < ?", 18, "65").
+		Where("? = ANY(tags)", "x")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WHERE name = $1 AND age > $2 AND name <> 'why?' AND age < $3 AND  $4 = ANY(tags)"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if v, ok := q.whereParams[2].(Value); !ok || v.String() != "65" {
+		t.Errorf("expected ? params to be converted to the column type got: %#v", q.whereParams[2])
+	}
+	for _, w := range []string{"tags ?| $1", "tags ? 'x' AND age > $1", "tags ? 'x' AND age > ?"} {
+		if q := (&Query{from: testRelation()}).Where(w, 1); q.where[0] != w {
+			t.Errorf("expected %s to be left as is got: %s", w, q.where[0])
+		}
+	}
+	sub := (&Query{from: testRelation()}).Select("id").Where("name = ?", "bob")
+	q = (&Query{from: testRelation()}).Where("age > ? AND id IN ?", 18, sub)
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected = "WHERE age > $1 AND id IN (SELECT id FROM person  WHERE name = $2    )"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if len(q.whereParams) != 2 {
+		t.Errorf("expected 2 params got: %v", q.whereParams)
+	}
+}
+
+func TestSelectExpr(t *testing.T) {
+	q := (&Query{from: testRelation()}).SelectExpr("lower(name) AS lname", "age + 1 as age")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "id,name,age + 1,tags,lower(name) AS lname"
+	if s := q.fieldList(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	q = q.Select("name")
+	if names := q.loadedCols(); strings.Join(names, ",") != "id,name,age" {
+		t.Errorf("expected the replaced column to be loaded got: %v", names)
+	}
+	if q := (&Query{from: testRelation()}).SelectExpr("lower(name)"); q.err == nil {
+		t.Errorf("expected an expression without an alias to fail")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	q := (&Query{from: testRelation()}).
+		Where("age = $1", "17").
+		Raw("age::text = $1", "17")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	if w := q.whereExpr(); w != "WHERE age = $1 AND age::text = $2" {
+		t.Errorf("unexpected where: %s", w)
+	}
+	if _, ok := q.whereParams[0].(Value); !ok {
+		t.Errorf("expected Where to convert its param got: %#v", q.whereParams[0])
+	}
+	if p, ok := q.whereParams[1].(string); !ok || p != "17" {
+		t.Errorf("expected Raw to bind its param as given got: %#v", q.whereParams[1])
+	}
+}
+
+func TestSubquery(t *testing.T) {
+	locs := &Relation{Name: "location", k: Record(Col("id", Integer, PrimaryKey()), Col("name", Text)),
+		cols: []*col{Col("id", Integer, PrimaryKey()), Col("name", Text)}}
+	sub := (&Query{from: locs}).Select("id").Where("name = $1 OR name = $2", "home", "work")
+	q := (&Query{from: testRelation()}).
+		Where("age > $1", 17).
+		Where("name = $2 AND id IN $1", sub, "bob")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WHERE age > $1 AND name = $4 AND id IN (SELECT id FROM location  WHERE name = $2 OR name = $3    )"
+	if w := q.whereExpr(); w != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w)
+	}
+	if len(q.whereParams) != 4 || q.whereParams[2].(Value).String() != "work" || q.whereParams[3].(Value).String() != "bob" {
+		t.Errorf("unexpected params: %v", q.whereParams)
+	}
+	bad := (&Query{from: locs}).Where("nope = $1", 1).OrderBy("nope")
+	if q := (&Query{from: testRelation()}).Where("id IN $1", bad); q.err == nil {
+		t.Errorf("expected a subquery with an error to fail")
+	}
+}
+
+func TestWithCTE(t *testing.T) {
+	rel := testRelation()
+	q := (&Query{from: rel}).
+		With("adults", (&Query{from: rel}).Select("id").Where("age >= $1", 18)).
+		WithRecursive("team", (&Query{from: rel}).Where("name = $1", "bob"), "person.age = team.age + 1").
+		Where("id IN (SELECT id FROM adults) AND name <> $1", "alice")
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "WITH RECURSIVE adults AS (SELECT id FROM person  WHERE age >= $1    ), " +
+		"team AS (SELECT id,name,age,tags FROM person  WHERE name = $2     UNION SELECT person.id,person.name,person.age,person.tags FROM person JOIN team ON person.age = team.age + 1) " +
+		"SELECT id,name,age,tags FROM person  WHERE id IN (SELECT id FROM adults) AND name <> $3    "
+	if s := q.selectSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if args := q.selectArgs(); len(args) != 3 || args[2].(Value).String() != "alice" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	if _, err := q.Delete(); err == nil {
+		t.Errorf("expected Delete with a WITH clause to fail")
+	}
+	if q := q.With("adults", &Query{from: rel}); q.err == nil {
+		t.Errorf("expected a repeated WITH name to fail")
+	}
+}
+
+func TestUnion(t *testing.T) {
+	rel := testRelation()
+	q := (&Query{from: rel}).Where("age < $1", 18).
+		UnionAll((&Query{from: rel}).Where("age > $1", 65)).
+		Where("name <> $1", "bob").
+		OrderBy("age").
+		Limit(10)
+	if q.err != nil {
+		t.Fatal(q.err)
+	}
+	expected := "SELECT id,name,age,tags FROM (" +
+		"(SELECT id,name,age,tags FROM person  WHERE age < $1    ) UNION ALL (SELECT id,name,age,tags FROM person  WHERE age > $2    )" +
+		") AS person  WHERE name <> $3 ORDER BY age ASC LIMIT 10  "
+	if s := q.selectSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if args := q.selectArgs(); len(args) != 3 {
+		t.Errorf("unexpected args: %v", args)
+	}
+	other := &Relation{Name: "other", k: Record(Col("id", BigInt)), cols: []*col{Col("id", BigInt)}}
+	if q := (&Query{from: rel}).Union(&Query{from: other}); q.err == nil {
+		t.Errorf("expected a union of different columns to fail")
+	}
+	if _, err := q.Delete(); err == nil {
+		t.Errorf("expected Delete of a union to fail")
+	}
+}
+
+func TestEach(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	rel := NewRelation("x", Col("x", BigInt, PrimaryKey()))
+	var got []interface{}
+	err = (&Query{tx: db, from: rel}).Each(func(v RecordValue) error {
+		got = append(got, v.Get("x"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != int64(1) {
+		t.Errorf("expected one record with x = 1 got: %v", got)
+	}
+	stop := errors.New("stop")
+	if err = (&Query{tx: db, from: rel}).Each(func(v RecordValue) error { return stop }); err != stop {
+		t.Errorf("expected the error from fn to be returned got: %v", err)
+	}
+	if _, err = (&Query{tx: db, from: rel, reverse: true}).Iter(); err == nil {
+		t.Errorf("expected iterating a reversed query to fail")
+	}
+}
+
+func TestFetchContext(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	rel := NewRelation("x", Col("x", BigInt, PrimaryKey()))
+	vs, err := (&Query{tx: db, from: rel}).FetchContext(context.Background())
+	if err != nil || len(vs) != 1 {
+		t.Fatalf("expected one record got: %v %v", vs, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = (&Query{tx: db, from: rel}).FetchContext(ctx); err != context.Canceled {
+		t.Errorf("expected a cancelled context to stop the fetch got: %v", err)
+	}
+	if _, err = (&Query{tx: db, from: rel}).WithContext(ctx).Count(); err != context.Canceled {
+		t.Errorf("expected a cancelled context to stop the count got: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	rel := NewRelation("x", Col("x", BigInt, PrimaryKey()))
+	vs, err := (&Query{tx: db, from: rel}).Timeout(time.Minute).Fetch()
+	if err != nil || len(vs) != 1 {
+		t.Fatalf("expected one record got: %v %v", vs, err)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = (&Query{tx: db, from: rel}).WithContext(ctx).Timeout(time.Minute).Fetch()
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 1m0s") {
+		t.Errorf("expected the query to time out got: %v", err)
+	}
+	fakeDrv.rows, fakeDrv.delay = 3, 30*time.Millisecond
+	defer func() { fakeDrv.rows, fakeDrv.delay = 0, 0 }()
+	vs, err = (&Query{tx: db, from: rel}).Timeout(50 * time.Millisecond).Fetch()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout while reading the rows to fail the fetch got: %v %v", vs, err)
+	}
+	_, err = (&Query{tx: db, from: rel}).Timeout(50 * time.Millisecond).Count()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout while reading the rows to fail the count got: %v", err)
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	s, args, err := (&Query{from: testRelation()}).Where("age > $1", 17).Limit(5).ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "SELECT id,name,age,tags FROM person  WHERE age > $1  LIMIT 5  " {
+		t.Errorf("unexpected sql: %q", s)
+	}
+	if len(args) != 1 || args[0].(Value).String() != "17" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	if _, _, err = (&Query{from: testRelation()}).OrderBy("nope").ToSQL(); err == nil {
+		t.Errorf("expected a pending error to be returned")
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	p, err := parsePlan([]byte(`[{"Plan": {"Node Type": "Nested Loop", "Total Cost": 12.5, "Plan Rows": 3,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "person", "Schema": "public", "Filter": "(age > 17)"},
+			{"Node Type": "Index Scan", "Relation Name": "location", "Index Name": "location_pkey", "Actual Loops": 3}
+		]}, "Planning Time": 0.2, "Execution Time": 1.5}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NodeType != "Nested Loop" || p.PlanRows != 3 || p.ExecutionTime != 1.5 || len(p.Plans) != 2 {
+		t.Errorf("unexpected plan: %+v", p)
+	}
+	if scans := p.SeqScans(); len(scans) != 1 || scans[0].Relation != "person" || scans[0].Filter != "(age > 17)" {
+		t.Errorf("expected one seq scan of person got: %v", scans)
+	}
+	expected := "Nested Loop (cost=0.00..12.50 rows=3)\n" +
+		"  Seq Scan on person (cost=0.00..0.00 rows=0)\n" +
+		"  Index Scan on location using location_pkey (cost=0.00..0.00 rows=0) (actual time=0.000 rows=0 loops=3)\n"
+	if s := p.String(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if _, err = parsePlan([]byte(`[]`)); err == nil {
+		t.Errorf("expected no plan to fail")
+	}
+}
+
+func TestShadowReadsStop(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db, shadow := &DB{DB: raw}, &DB{DB: raw}
+	rel := NewRelation("x", Col("x", BigInt, PrimaryKey()))
+	shadow.rels = map[string]*Relation{"x": rel}
+	var (
+		mu    sync.Mutex
+		diffs []*ShadowDiff
+	)
+	db.ShadowReads(shadow, func(d *ShadowDiff) {
+		mu.Lock()
+		defer mu.Unlock()
+		diffs = append(diffs, d)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = (&Query{tx: db, from: rel}).WithContext(ctx).Fetch()
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		(&Query{tx: db, from: rel}).Fetch()
+		close(done)
+	}()
+	db.StopShadowReads()
+	<-done
+	db.StopShadowReads()
+	if len(diffs) != 0 {
+		t.Errorf("expected the shadow read to match despite the cancelled context got: %v", diffs[0])
+	}
+
+	// a shadow without the relation reports every read that is shadowed
+	shadow.rels = map[string]*Relation{}
+	db.ShadowReads(shadow, func(d *ShadowDiff) {
+		mu.Lock()
+		defer mu.Unlock()
+		diffs = append(diffs, d)
+	})
+	if _, err = (&Query{tx: &ctxDB{db, context.Background()}, from: rel}).Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	db.StopShadowReads()
+	if len(diffs) != 1 || diffs[0].Err == nil {
+		t.Errorf("expected reads through Parallel to be shadowed got: %v", diffs)
+	}
+}
+
+func TestParallelCancelsOwnContext(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	ctx, cancel := context.WithCancel(context.Background())
+	cdb := &ctxDB{db, ctx}
+	cancel()
+	rel := NewRelation("x", Col("x", BigInt, PrimaryKey()))
+	q := &Query{tx: cdb, from: rel}
+	if _, err = q.WithContext(context.Background()).Fetch(); err != context.Canceled {
+		t.Errorf("expected the Parallel context to cancel a query with its own context got: %v", err)
+	}
+	if _, err = q.Timeout(time.Minute).Fetch(); err != context.Canceled {
+		t.Errorf("expected the Parallel context to cancel a query with a timeout got: %v", err)
+	}
+}
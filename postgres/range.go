@@ -0,0 +1,254 @@
+package postgres
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+)
+
+// A Value holding a range of el values
+type RangeValue interface {
+	Value
+	// lower bound (a NULL Value if unbounded)
+	Lower() Value
+	// upper bound (a NULL Value if unbounded)
+	Upper() Value
+	// the bound brackets ie "[)"
+	Bounds() string
+	// reports whether the range is "empty"
+	IsEmpty() bool
+}
+
+// A range of el values ie Range(Integer) for int4range.
+// Values can be set from a range literal ("[1,10)", "empty") or
+// from []interface{}{lower, upper} with optional bounds as a third element
+// (default "[)"). Use nil for an unbounded lower or upper
+func Range(el ToValue) ToValue {
+	return func(data interface{}) (Value, error) {
+		k := &pgRange{el: el}
+		return k, k.Scan(data)
+	}
+}
+
+type pgRange struct {
+	el       ToValue
+	lower    Value
+	upper    Value
+	lowerInc bool
+	upperInc bool
+	empty    bool
+	valid    bool
+}
+
+func (k *pgRange) Scan(src interface{}) (err error) {
+	k.empty = false
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	k.lower, err = k.el(nil)
+	if err != nil {
+		return err
+	}
+	k.upper, err = k.el(nil)
+	if err != nil {
+		return err
+	}
+	switch x := src.(type) {
+	case []interface{}:
+		if len(x) < 2 || len(x) > 3 {
+			return fmt.Errorf("cannot set Range Value with %d elements need lower, upper and optional bounds", len(x))
+		}
+		bounds := "[)"
+		if len(x) == 3 {
+			s, ok := x[2].(string)
+			if !ok || !validBounds(s) {
+				return fmt.Errorf("invalid Range bounds %v", x[2])
+			}
+			bounds = s
+		}
+		k.lowerInc = bounds[0] == '['
+		k.upperInc = bounds[1] == ']'
+		err = k.lower.Scan(x[0])
+		if err != nil {
+			return err
+		}
+		return k.upper.Scan(x[1])
+	default:
+		b, err := srcToBytes(src)
+		if err != nil {
+			return err
+		}
+		return k.parse(b)
+	}
+}
+
+func validBounds(s string) bool {
+	return len(s) == 2 && (s[0] == '[' || s[0] == '(') && (s[1] == ']' || s[1] == ')')
+}
+
+// parse a range literal ie [1,10) or ["2010-01-01 14:30","2010-01-01 15:30")
+func (k *pgRange) parse(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.EqualFold(b, []byte("empty")) {
+		k.empty = true
+		return nil
+	}
+	if len(b) < 3 || !validBounds(string([]byte{b[0], b[len(b)-1]})) {
+		return fmt.Errorf("invalid range literal %s", string(b))
+	}
+	k.lowerInc = b[0] == '['
+	k.upperInc = b[len(b)-1] == ']'
+	parts, err := splitRange(b[1 : len(b)-1])
+	if err != nil {
+		return fmt.Errorf("invalid range literal %s: %v", string(b), err)
+	}
+	for i, v := range []Value{k.lower, k.upper} {
+		if parts[i] == nil {
+			continue // unbounded
+		}
+		err = v.Scan(parts[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split the inside of a range literal into its lower and upper
+// bound, unquoting them. An unbounded side is returned as nil
+func splitRange(b []byte) ([][]byte, error) {
+	parts := make([][]byte, 0, 2)
+	var cur []byte
+	quoted := false
+	seen := false // seen any chars for the current bound
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '\\' && i+1 < len(b):
+			i++
+			cur = append(cur, b[i])
+			seen = true
+		case c == '"' && quoted && i+1 < len(b) && b[i+1] == '"':
+			i++
+			cur = append(cur, '"')
+		case c == '"':
+			quoted = !quoted
+			seen = true
+		case c == ',' && !quoted:
+			parts = append(parts, boundBytes(cur, seen))
+			cur = nil
+			seen = false
+		default:
+			cur = append(cur, c)
+			seen = true
+		}
+	}
+	parts = append(parts, boundBytes(cur, seen))
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected 2 bounds got %d", len(parts))
+	}
+	return parts, nil
+}
+
+func boundBytes(b []byte, seen bool) []byte {
+	if !seen {
+		return nil
+	}
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func (k *pgRange) Lower() Value {
+	return k.lower
+}
+
+func (k *pgRange) Upper() Value {
+	return k.upper
+}
+
+func (k *pgRange) Bounds() string {
+	b := []byte("()")
+	if k.lowerInc {
+		b[0] = '['
+	}
+	if k.upperInc {
+		b[1] = ']'
+	}
+	return string(b)
+}
+
+func (k *pgRange) IsEmpty() bool {
+	return k.valid && k.empty
+}
+
+func (k *pgRange) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgRange) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.bytes()
+}
+
+func (k *pgRange) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	if k.empty {
+		return []byte("empty"), nil
+	}
+	bounds := k.Bounds()
+	b := bytes.NewBufferString("")
+	b.WriteByte(bounds[0])
+	for i, v := range []Value{k.lower, k.upper} {
+		if i == 1 {
+			b.WriteString(",")
+		}
+		if v.IsNull() {
+			continue
+		}
+		vb, err := v.bytes()
+		if err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case *pgNumeric, *pgInteger, *pgFloat, *pgTimestamp, *pgTimestampTZ, *pgDate:
+			b.Write(vb)
+		default:
+			b.WriteString(`"`)
+			b.Write(escape(vb, 1))
+			b.WriteString(`"`)
+		}
+	}
+	b.WriteByte(bounds[1])
+	return b.Bytes(), nil
+}
+
+func (k *pgRange) String() string {
+	if !k.valid {
+		return ""
+	}
+	s, _ := k.bytes()
+	return string(s)
+}
+
+// returns the range literal
+func (k *pgRange) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgRange) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
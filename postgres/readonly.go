@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrReadOnly is returned when attempting to write via a ReadOnlyDB
+// or a transaction it opened
+var ErrReadOnly = errors.New("read only")
+
+// ReadOnlyDB is a handle to a DB that can only be used for reading.
+// Insert, Update, Delete and Exec return ErrReadOnly as do Query.Update
+// and Query.Delete on Queries built from it. Transactions are opened
+// READ ONLY so the server also rejects any writes made inside them.
+// Raw SQL passed to Query is sent as is, use Transaction to have the
+// server enforce read only access for arbitrary SQL
+type ReadOnlyDB struct {
+	db *DB
+}
+
+// Return a read only handle to the DB suitable for
+// handing to reporting/analytics code
+func (db *DB) ReadOnly() *ReadOnlyDB {
+	return &ReadOnlyDB{db}
+}
+
+// reports whether tx was obtained from a ReadOnlyDB
+func isReadOnly(tx queryer) bool {
+	switch x := tx.(type) {
+	case *ReadOnlyDB:
+		return true
+	case *Tx:
+		return x.readOnly
+	}
+	return false
+}
+
+func (ro *ReadOnlyDB) Relations() (map[string]*Relation, error) {
+	return ro.db.Relations()
+}
+
+// Get Relation info by name
+func (ro *ReadOnlyDB) Relation(name string) (*Relation, error) {
+	return ro.db.Relation(name)
+}
+
+// Create a Query for a named relation
+// any errors are defered until an actual query is performed
+func (ro *ReadOnlyDB) From(name string) *Query {
+	q := new(Query)
+	rel, err := ro.db.Relation(name)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	q.from = rel
+	q.tx = ro
+	return q
+}
+
+func (ro *ReadOnlyDB) Query(q string, vals ...interface{}) (*Rows, error) {
+	return ro.db.Query(q, vals...)
+}
+
+func (ro *ReadOnlyDB) QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error) {
+	return ro.db.QueryContext(ctx, q, vals...)
+}
+
+// Like DB.NamedSQL
+func (ro *ReadOnlyDB) NamedSQL(s string, params Params) *NamedQuery {
+	return newNamedQuery(ro, s, params)
+}
+
+// Like DB.Named
+func (ro *ReadOnlyDB) Named(name string) *Statement {
+	return ro.db.named(ro, name)
+}
+
+// Start a READ ONLY transaction
+func (ro *ReadOnlyDB) Begin() (*Tx, error) {
+	return ro.BeginTx(context.Background(), nil)
+}
+
+// Like DB.BeginTx but the transaction is always READ ONLY
+func (ro *ReadOnlyDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	ropts := sql.TxOptions{ReadOnly: true}
+	if opts != nil {
+		ropts.Isolation = opts.Isolation
+	}
+	tx, err := ro.db.BeginTx(ctx, &ropts)
+	if err != nil {
+		return nil, err
+	}
+	tx.readOnly = true
+	return tx, nil
+}
+
+// Like DB.Transaction but the transaction is READ ONLY
+func (ro *ReadOnlyDB) Transaction(fn func(tx *Tx) error) error {
+	tx, err := ro.Begin()
+	if err != nil {
+		return err
+	}
+	return runTx(tx, fn)
+}
+
+func (ro *ReadOnlyDB) Insert(vs ...RecordValue) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyDB) Update(vs ...RecordValue) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyDB) Upsert(vs ...RecordValue) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyDB) Delete(vs ...RecordValue) error {
+	return ErrReadOnly
+}
+
+func (ro *ReadOnlyDB) Exec(q string, vals ...interface{}) (sql.Result, error) {
+	return nil, ErrReadOnly
+}
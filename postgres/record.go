@@ -25,6 +25,15 @@ type pgRecord struct {
 	cs    []*col
 	valid bool
 	rel   *Relation
+	typ   string // composite type name (if not from a Relation)
+	// records attached by Query.Preload keyed by reference name
+	related map[string][]RecordValue
+	// columns not fetched by a Query.Select (nil if all were)
+	unloaded map[string]bool
+	// columns New left NULL for a DEFAULT expression to fill in
+	defaulted map[string]bool
+	// values of expressions added by Query.SelectExpr keyed by alias
+	extra map[string]interface{}
 }
 
 func (k *pgRecord) Relation() *Relation {
@@ -35,6 +44,79 @@ func (k *pgRecord) SetRelation(rel *Relation) {
 	k.rel = rel
 }
 
+// Return the records attached to this record for the named reference
+// by Query.Preload (or nil if it was not preloaded)
+func (k *pgRecord) Related(name string) []RecordValue {
+	return k.related[name]
+}
+
+func (k *pgRecord) setRelated(name string, vs []RecordValue) {
+	if k.related == nil {
+		k.related = make(map[string][]RecordValue)
+	}
+	k.related[name] = vs
+}
+
+// Return the value of the named expression fetched by
+// Query.SelectExpr (or nil if there was none)
+func (k *pgRecord) Extra(name string) interface{} {
+	return k.extra[name]
+}
+
+func setExtra(v RecordValue, name string, val interface{}) {
+	k, ok := v.(*pgRecord)
+	if !ok {
+		return
+	}
+	if k.extra == nil {
+		k.extra = make(map[string]interface{})
+	}
+	k.extra[name] = val
+}
+
+// reports whether the record was fetched with only some
+// of its columns (see Query.Select)
+func (k *pgRecord) IsPartial() bool {
+	return len(k.unloaded) > 0
+}
+
+// reports whether the named column was fetched (or has been Set)
+func (k *pgRecord) Loaded(name string) bool {
+	return k.ValueBy(name) != nil && !k.unloaded[name]
+}
+
+// mark the columns not in names as not fetched
+func setPartial(v RecordValue, names []string) {
+	k, ok := v.(*pgRecord)
+	if !ok {
+		return
+	}
+	k.unloaded = make(map[string]bool)
+outer:
+	for _, c := range k.cs {
+		for _, name := range names {
+			if c.name == name {
+				continue outer
+			}
+		}
+		k.unloaded[c.name] = true
+	}
+}
+
+// reports whether the named column still holds the NULL New
+// left for its DEFAULT expression (ie it has not been Set)
+func isDefaulted(v RecordValue, name string) bool {
+	k, ok := v.(*pgRecord)
+	return ok && k.defaulted[name]
+}
+
+// mark a record scanned from a row as not NULL
+func setNotNull(v RecordValue) {
+	if k, ok := v.(*pgRecord); ok {
+		k.valid = true
+	}
+}
+
 func (k *pgRecord) IsNull() bool {
 	return !k.valid
 }
@@ -74,6 +156,13 @@ func (k *pgRecord) Val() interface{} {
 	return vals
 }
 
+func (k *pgRecord) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
 func (k *pgRecord) Map() map[string]Value {
 	m := make(map[string]Value)
 	for i, v := range k.vs {
@@ -91,10 +180,12 @@ func (k *pgRecord) ValueAt(idx int) Value {
 }
 
 func (k *pgRecord) ValueBy(name string) Value {
-	for i, c := range k.cs {
-		if c.name == name {
-			return k.vs[i]
-		}
+	m := MatchExact
+	if k.rel != nil && k.rel.db != nil {
+		m = k.rel.db.nameMatch
+	}
+	if i := m.index(k.cs, name); i != -1 {
+		return k.vs[i]
 	}
 	return nil
 }
@@ -107,11 +198,28 @@ func (k *pgRecord) Get(name string) interface{} {
 	return v.Val()
 }
 
+// like Get but returns fallback if name is missing or NULL
+func (k *pgRecord) GetOr(name string, fallback interface{}) interface{} {
+	v := k.ValueBy(name)
+	if v == nil {
+		return fallback
+	}
+	return v.ValOr(fallback)
+}
+
 func (k *pgRecord) Set(name string, src interface{}) error {
 	v := k.ValueBy(name)
 	if v == nil {
 		return fmt.Errorf("No column %s", name)
 	}
+	// a record with a column set is no longer NULL
+	k.valid = true
+	for i, c := range k.cs {
+		if k.vs[i] == v {
+			delete(k.unloaded, c.name)
+			delete(k.defaulted, c.name)
+		}
+	}
 	return v.Scan(src)
 }
 
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// RefreshPolicy controls which columns are re-read (via RETURNING) into
+// a RecordValue after Insert or Update writes it. See RefreshAfterWrite
+type RefreshPolicy struct {
+	all  bool
+	cols []string
+}
+
+// re-read every column, picking up defaults and any changes
+// made by triggers. This is the default
+var RefreshAll = RefreshPolicy{all: true}
+
+// do not re-read anything, the RecordValue is left as written
+var RefreshNone = RefreshPolicy{}
+
+// re-read only the named columns
+func RefreshCols(names ...string) RefreshPolicy {
+	return RefreshPolicy{cols: names}
+}
+
+// Set the columns re-read after Insert and after Update of records in
+// this relation, ie to only pick up the generated id and a trigger
+// maintained updated_at:
+//
+//	rel.RefreshAfterWrite(RefreshCols("id", "updated_at"), RefreshCols("updated_at"))
+//
+// Should be called before the Relation is shared between goroutines
+func (r *Relation) RefreshAfterWrite(insert, update RefreshPolicy) error {
+	for _, p := range []RefreshPolicy{insert, update} {
+		err := r.checkRefresh(p)
+		if err != nil {
+			return err
+		}
+	}
+	r.refreshInsert = &insert
+	r.refreshUpdate = &update
+	return nil
+}
+
+// check the columns of p are columns of r
+func (r *Relation) checkRefresh(p RefreshPolicy) error {
+	for _, name := range p.cols {
+		if r.col(name) == nil {
+			return fmt.Errorf("cannot refresh %s unknown column for %s", name, r.Name)
+		}
+	}
+	return nil
+}
+
+// the columns to re-read for policy p (nil means RefreshAll)
+func (r *Relation) refreshCols(p *RefreshPolicy) []*col {
+	if p == nil || p.all {
+		return r.cols
+	}
+	cols := make([]*col, 0, len(p.cols))
+	for _, c := range r.cols {
+		for _, name := range p.cols {
+			if c.name == name {
+				cols = append(cols, c)
+				break
+			}
+		}
+	}
+	return cols
+}
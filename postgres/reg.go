@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+// RegValue is a Value holding one of the reg* oid alias types
+// (regclass, regtype, regproc...). Postgres sends only the name so
+// the oid is unknown (0) until the Value is resolved with DB.Resolve,
+// likewise a Value set from an oid has no name until resolved
+type RegValue interface {
+	Value
+	Oid() uint32
+	Name() string
+}
+
+// Reg returns a ToValue for the named reg* type ie Reg("regclass").
+// Values can be set from the textual name, an oid (any integer type)
+// or a numeric string
+func Reg(typ string) ToValue {
+	return func(data interface{}) (Value, error) {
+		k := &pgReg{typ: typ}
+		return k, k.Scan(data)
+	}
+}
+
+var (
+	RegClass = Reg("regclass")
+	RegType  = Reg("regtype")
+	RegProc  = Reg("regproc")
+)
+
+type pgReg struct {
+	typ   string // the reg* type name
+	oid   uint32
+	name  string
+	valid bool
+}
+
+func (k *pgReg) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	k.oid, k.name = 0, ""
+	var s string
+	switch x := src.(type) {
+	case uint32:
+		k.oid = x
+		return nil
+	case int64:
+		k.oid = uint32(x)
+		return nil
+	case int:
+		k.oid = uint32(x)
+		return nil
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	default:
+		return fmt.Errorf("cannot set %s value with %T -> %v", k.typ, src, src)
+	}
+	// postgres outputs the oid when it has no name for it
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		k.oid = uint32(n)
+		return nil
+	}
+	k.name = s
+	return nil
+}
+
+func (k *pgReg) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgReg) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgReg) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+// the name if known otherwise the oid
+func (k *pgReg) String() string {
+	if !k.valid {
+		return ""
+	}
+	if k.name != "" {
+		return k.name
+	}
+	return strconv.FormatUint(uint64(k.oid), 10)
+}
+
+func (k *pgReg) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgReg) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+func (k *pgReg) Oid() uint32 {
+	return k.oid
+}
+
+func (k *pgReg) Name() string {
+	return k.name
+}
+
+// Fill in the missing oid or name of a RegValue by asking the server
+func (db *DB) Resolve(v RegValue) error {
+	k, ok := v.(*pgReg)
+	if !ok {
+		return fmt.Errorf("cannot resolve %T", v)
+	}
+	if k.IsNull() {
+		return nil
+	}
+	return db.scanRow(
+		[]interface{}{&k.oid, &k.name},
+		fmt.Sprintf(`SELECT $1::%s::oid, $1::%s::text`, k.typ, k.typ),
+		k.String(),
+	)
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Repo provides typed CRUD for a relation where each row is
+// represented by a struct of type T. Columns are mapped to
+// fields by `db:"name"` tags or the snake_case field name
+type Repo[T any] struct {
+	db  *DB
+	rel *Relation
+}
+
+// Create a Repo for the named relation. T must be a struct type
+func NewRepo[T any](db *DB, name string) (*Repo[T], error) {
+	var zero T
+	if reflect.TypeOf(zero) == nil || reflect.TypeOf(zero).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Repo type must be a struct got: %T", zero)
+	}
+	rel, err := db.Relation(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Repo[T]{db, rel}, nil
+}
+
+// Relation the Repo is for
+func (r *Repo[T]) Relation() *Relation {
+	return r.rel
+}
+
+// Create a Query for the Repo's relation, for use with Find
+func (r *Repo[T]) Query() *Query {
+	return r.db.From(r.rel.Name)
+}
+
+// Fetch the row with primary key pk.
+// Returns ErrNotFound if there is no such row
+func (r *Repo[T]) Get(pk interface{}) (T, error) {
+	var t T
+	v, err := r.Query().GetErr(pk)
+	if err != nil {
+		return t, err
+	}
+	err = recordToStruct(v, reflect.ValueOf(&t).Elem())
+	return t, err
+}
+
+// Fetch all rows matching q, which must be a Query for the Repo's
+// relation. If q is nil all rows are returned
+func (r *Repo[T]) Find(q *Query) ([]T, error) {
+	if q == nil {
+		q = r.Query()
+	}
+	if q.err == nil && q.from != r.rel {
+		return nil, fmt.Errorf("Query for %s cannot be used with Repo for %s", q.from.Name, r.rel.Name)
+	}
+	vs, err := q.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	ts := make([]T, len(vs))
+	for i, v := range vs {
+		err = recordToStruct(v, reflect.ValueOf(&ts[i]).Elem())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// INSERT the row held by t. Fields are updated from the RETURNING
+// result (ie to set the primary key). Primary key fields left at their
+// zero value are inserted as NULL so the column's default applies
+func (r *Repo[T]) Insert(t *T) error {
+	return r.write(t, true, r.db.Insert)
+}
+
+// UPDATE the row held by t
+func (r *Repo[T]) Update(t *T) error {
+	return r.write(t, false, r.db.Update)
+}
+
+// DELETE the row held by t
+func (r *Repo[T]) Delete(t *T) error {
+	return r.write(t, false, r.db.Delete)
+}
+
+func (r *Repo[T]) write(t *T, insert bool, op func(vs ...RecordValue) error) error {
+	if t == nil {
+		return fmt.Errorf("cannot write nil %T", t)
+	}
+	src := reflect.ValueOf(t).Elem()
+	v, err := structToRecord(r.rel, src)
+	if err != nil {
+		return err
+	}
+	if insert {
+		err = nullZeroKeys(r.rel, v, src)
+		if err != nil {
+			return err
+		}
+	}
+	err = op(v)
+	if err != nil {
+		return err
+	}
+	return recordToStruct(v, src)
+}
@@ -61,8 +61,12 @@ func rowScanner(src interface{}, dests []Value) error {
 		}
 		// parse each part
 		for i, vx := range dests {
-			// parse
-			err = vx.Scan(parts[i])
+			// parse (nil parts are NULL)
+			var part interface{}
+			if parts[i] != nil {
+				part = parts[i]
+			}
+			err = vx.Scan(part)
 			if err != nil {
 				return err
 			}
@@ -105,6 +109,13 @@ func (k *pgRow) Val() interface{} {
 	return values
 }
 
+func (k *pgRow) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
 func (k *pgRow) Values() []Value {
 	return k.vs
 }
@@ -129,6 +140,13 @@ func rowBytes(valid bool, vs []Value) ([]byte, error) {
 	b.WriteString("(")
 	last := len(vs) - 1
 	for i, child := range vs {
+		// NULL is an empty field ("NULL" would be read as text)
+		if child.IsNull() {
+			if i != last {
+				b.WriteString(",")
+			}
+			continue
+		}
 		cb, err := child.bytes()
 		if err != nil {
 			return nil, err
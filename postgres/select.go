@@ -0,0 +1,341 @@
+package postgres
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// a reference to fetch (with the columns to fetch) after a query
+type preload struct {
+	ref  *ref
+	cols []string // nil means all
+	all  bool     // all columns were requested
+}
+
+// Return a new Query that only fetches the named columns, ie to avoid
+// loading large bytea or jsonb columns. The other columns of the returned
+// records are left NULL and the records are marked partial (see
+// IsPartial and Loaded) so Update only writes the loaded columns. The
+// primary key is always fetched so the records can still be updated
+func (q *Query) Select(names ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	cols, err := q.from.selectCols(names)
+	if err != nil {
+		q2.err = err
+		return q2
+	}
+	q2.cols = cols
+	q2.picked = names
+	return q2
+}
+
+// check names are columns of r and add the primary key
+func (r *Relation) selectCols(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	cols := make([]string, 0, len(names)+1)
+	for _, c := range r.pks() {
+		cols = append(cols, c.name)
+	}
+	for _, name := range names {
+		if r.col(name) == nil {
+			return nil, fmt.Errorf("cannot select %s: no such column on %s", name, r.Name)
+		}
+		cols = appendName(cols, name)
+	}
+	return cols, nil
+}
+
+func appendName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// an SQL expression added to the SELECT by SelectExpr
+type selectExpr struct {
+	expr  string
+	alias string
+	col   bool // alias is a column so expr is fetched in its place
+}
+
+// regexp to split "expr AS alias"
+var selectExprPat = regexp.MustCompile(`(?is)^\s*(.+?)\s+AS\s+(\w+)\s*$`)
+
+// Return a new Query that also selects each SQL expression, which must be
+// of the form "expr AS alias", ie SelectExpr("lower(name) AS lname"). If
+// the alias is a column of the relation the expression is fetched into
+// that column in place of the column itself, otherwise its value (as
+// returned by the driver) is available from each record with Extra.
+// Expressions are not escaped so must not contain user input
+func (q *Query) SelectExpr(exprs ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.exprs = append([]selectExpr(nil), q.exprs...)
+	for _, e := range exprs {
+		m := selectExprPat.FindStringSubmatch(e)
+		if m == nil {
+			q2.err = fmt.Errorf("cannot select %q: expected an expression of the form \"expr AS alias\"", e)
+			return q2
+		}
+		q2.exprs = append(q2.exprs, selectExpr{expr: m[1], alias: m[2], col: q.from.col(m[2]) != nil})
+	}
+	return q2
+}
+
+// the expression selected in place of the named column (if any)
+func (q *Query) exprFor(name string) (string, bool) {
+	for _, e := range q.exprs {
+		if e.col && e.alias == name {
+			return e.expr, true
+		}
+	}
+	return "", false
+}
+
+// the expressions selected after the columns
+func (q *Query) extraExprs() []selectExpr {
+	var extras []selectExpr
+	for _, e := range q.exprs {
+		if !e.col {
+			extras = append(extras, e)
+		}
+	}
+	return extras
+}
+
+// the columns loaded into the fetched records (nil means all)
+func (q *Query) loadedCols() []string {
+	if q.cols == nil {
+		return nil
+	}
+	names := q.cols
+	for _, e := range q.exprs {
+		if e.col {
+			names = appendName(names, e.alias)
+		}
+	}
+	return names
+}
+
+// csv list of the columns to SELECT. Columns not selected are
+// fetched as NULL so rows still scan into whole records and
+// expressions not fetched into a column are added at the end
+func (q *Query) fieldList() string {
+	if q.cols == nil && len(q.joins) == 0 && len(q.exprs) == 0 {
+		return q.from.fields(true)
+	}
+	fields := make([]string, len(q.from.cols), len(q.from.cols)+len(q.exprs))
+	for i, c := range q.from.cols {
+		fields[i] = "NULL"
+		if q.cols == nil {
+			fields[i] = q.field(c.name)
+		}
+		for _, name := range q.cols {
+			if c.name == name {
+				fields[i] = q.field(c.name)
+				break
+			}
+		}
+		if expr, ok := q.exprFor(c.name); ok {
+			fields[i] = expr
+		}
+	}
+	for _, e := range q.extraExprs() {
+		fields = append(fields, e.expr+" AS "+e.alias)
+	}
+	return strings.Join(fields, ",")
+}
+
+// the column name qualified by the relation name
+// if other relations are joined
+func (q *Query) field(name string) string {
+	if len(q.joins) == 0 {
+		return name
+	}
+	return q.from.Name + "." + name
+}
+
+// Return a new Query that also fetches the named references (see
+// Related) of the fetched records using one query per reference
+func (q *Query) Preload(names ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.copyPreloads()
+	for _, name := range names {
+		p, err := q2.preloadFor(name)
+		if err != nil {
+			q2.err = err
+			return q2
+		}
+		p.all = true
+	}
+	return q2
+}
+
+// copy the preloads so they can be changed without affecting
+// the query this one was copied from
+func (q *Query) copyPreloads() {
+	ps := make([]*preload, len(q.preloads))
+	for i, p := range q.preloads {
+		cp := *p
+		ps[i] = &cp
+	}
+	q.preloads = ps
+}
+
+// find (or add) the preload for the named reference
+func (q *Query) preloadFor(name string) (*preload, error) {
+	for _, p := range q.preloads {
+		if p.ref.name == name {
+			return p, nil
+		}
+	}
+	for _, ref := range q.from.refs {
+		if ref.name == name {
+			p := &preload{ref: ref}
+			q.preloads = append(q.preloads, p)
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot preload %s: no such reference on %s", name, q.from.Name)
+}
+
+// Return a new Query that fetches only the requested fields, ie from an
+// API layer. Each field is either a column name, a reference name (to
+// preload all its columns) or "reference.column". The columns needed to
+// match up preloaded records are added automatically
+func (q *Query) Fields(fields ...string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	q2.copyPreloads()
+	var names []string
+	for _, f := range fields {
+		parts := strings.Split(f, ".")
+		if len(parts) == 1 && q.from.col(f) != nil {
+			names = append(names, f)
+			continue
+		}
+		if len(parts) > 2 {
+			q2.err = fmt.Errorf("cannot select %s: only one level of reference is supported", f)
+			return q2
+		}
+		p, err := q2.preloadFor(parts[0])
+		if err != nil {
+			q2.err = fmt.Errorf("cannot select %s: no such column or reference on %s", f, q.from.Name)
+			return q2
+		}
+		if len(parts) == 1 {
+			p.all = true
+			continue
+		}
+		if p.ref.rel.col(parts[1]) == nil {
+			q2.err = fmt.Errorf("cannot select %s: no such column on %s", f, p.ref.rel.Name)
+			return q2
+		}
+		p.cols = appendName(p.cols, parts[1])
+	}
+	for _, p := range q2.preloads {
+		names = appendName(names, p.localKey())
+		if p.all {
+			p.cols = nil
+		} else {
+			p.cols = appendName(p.cols, p.remoteKey())
+		}
+	}
+	return q2.Select(names...)
+}
+
+// the column of the fetched records used to match preloaded records
+func (p *preload) localKey() string {
+	if p.ref.kind == ref_hasOne {
+		return p.ref.col.name
+	}
+	return p.ref.col.refF
+}
+
+// the column of the preloaded records used to match fetched records
+func (p *preload) remoteKey() string {
+	if p.ref.kind == ref_hasOne {
+		return p.ref.col.refF
+	}
+	return p.ref.col.name
+}
+
+// attach the preloaded references to vs
+func (q *Query) preloaded(vs []RecordValue, err error) ([]RecordValue, error) {
+	if err != nil || len(q.preloads) == 0 || len(vs) == 0 {
+		return vs, err
+	}
+	for _, p := range q.preloads {
+		if err := q.preload(p, vs); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+func (q *Query) preload(p *preload, vs []RecordValue) error {
+	local := q.from.col(p.localKey())
+	remote := p.ref.rel.col(p.remoteKey())
+	if local == nil || remote == nil {
+		return fmt.Errorf("cannot preload %s: unknown key columns", p.ref.name)
+	}
+	var keys []interface{}
+	seen := make(map[string]bool)
+	for _, v := range vs {
+		kv := v.ValueBy(local.name)
+		if kv == nil || kv.IsNull() || seen[kv.String()] {
+			continue
+		}
+		seen[kv.String()] = true
+		keys = append(keys, kv.Val())
+	}
+	byKey := make(map[string][]RecordValue)
+	if len(keys) > 0 {
+		arr, err := Array(remote.k)(keys)
+		if err != nil {
+			return err
+		}
+		rs, err := (&Query{tx: q.tx, from: p.ref.rel, ctx: q.ctx}).
+			Select(p.cols...).
+			Where(fmt.Sprintf("%s = ANY($1)", remote.name), arr).
+			Fetch()
+		if err != nil {
+			return fmt.Errorf("cannot preload %s: %v", p.ref.name, err)
+		}
+		for _, r := range rs {
+			k := r.ValueBy(remote.name).String()
+			byKey[k] = append(byKey[k], r)
+		}
+	}
+	for _, v := range vs {
+		k, ok := v.(*pgRecord)
+		if !ok {
+			continue
+		}
+		var rs []RecordValue
+		if kv := v.ValueBy(local.name); kv != nil && !kv.IsNull() {
+			rs = byKey[kv.String()]
+		}
+		if rs == nil {
+			rs = []RecordValue{}
+		}
+		k.setRelated(p.ref.name, rs)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ShadowDiff reports a record that was fetched differently from the
+// primary and the shadow DB. Primary or Shadow is nil if the record was
+// only found on one side. Err is set (and the records nil) if the shadow
+// query failed
+type ShadowDiff struct {
+	Relation string
+	Key      string      // primary key of the record (or row number without one)
+	Primary  RecordValue // record from the primary
+	Shadow   RecordValue // record from the shadow DB
+	Cols     []string    // names of the columns that differ
+	Err      error
+}
+
+type shadowReader struct {
+	db     *DB
+	report func(d *ShadowDiff)
+	wg     sync.WaitGroup
+}
+
+// Also run each Fetch (and so Get, FetchOne etc) made directly on this DB
+// against shadow in the background and call report with each record that
+// differs, ie to validate a new schema or server before cutting over.
+// Records are matched by primary key and compared column by column using
+// the primary's columns with Value.Equal (so 1.0 = 1.00 and timestamptz
+// values in different zones are the same instant). If report is nil diffs
+// are logged. Only queries from the DB and its Parallel are shadowed: those
+// made with a Tx, Conn, ReadOnlyDB or Stream (or fetched by ctid) are not.
+// Should be called before the DB is shared between goroutines
+func (db *DB) ShadowReads(shadow *DB, report func(d *ShadowDiff)) {
+	if report == nil {
+		report = logShadowDiff
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.shadow = &shadowReader{db: shadow, report: report}
+}
+
+// Stop shadowing reads started by ShadowReads (if any)
+// waiting for running comparisons to finish
+func (db *DB) StopShadowReads() {
+	db.mu.Lock()
+	s := db.shadow
+	db.shadow = nil
+	db.mu.Unlock()
+	if s != nil {
+		s.wg.Wait()
+	}
+}
+
+func logShadowDiff(d *ShadowDiff) {
+	if d.Err != nil {
+		log.Printf("postgres: shadow read of %s failed: %v", d.Relation, d.Err)
+		return
+	}
+	log.Printf("postgres: shadow read of %s %s differs in %v", d.Relation, d.Key, d.Cols)
+}
+
+// compare the result of the query with the shadow DB in the background
+func (q *Query) shadowRead(vs []RecordValue) {
+	var db *DB
+	switch x := q.tx.(type) {
+	case *DB:
+		db = x
+	case *ctxDB:
+		db = x.DB
+	default:
+		return
+	}
+	// add to the WaitGroup while holding the lock so
+	// StopShadowReads can't start waiting in between
+	db.mu.RLock()
+	s := db.shadow
+	if s != nil {
+		s.wg.Add(1)
+	}
+	db.mu.RUnlock()
+	if s == nil {
+		return
+	}
+	primary := make([]RecordValue, len(vs))
+	for i, v := range vs {
+		primary[i] = v.Clone().(RecordValue)
+	}
+	go func() {
+		defer s.wg.Done()
+		shadow, err := q.onShadow(s.db)
+		if err != nil {
+			s.report(&ShadowDiff{Relation: q.from.Name, Err: err})
+			return
+		}
+		for _, d := range diffRecords(q.from, primary, shadow) {
+			s.report(d)
+		}
+	}()
+}
+
+// run the query against the same named relation on db
+func (q *Query) onShadow(db *DB) ([]RecordValue, error) {
+	rel, err := db.Relation(q.from.Name)
+	if err != nil {
+		return nil, err
+	}
+	q2 := q.cp()
+	q2.tx = db
+	q2.from = rel
+	// the caller may cancel its context as soon as it has
+	// its records so the shadow read must not share it
+	q2.ctx = nil
+	q2.cache = nil
+	q2.lock = ""
+	q2.preloads = nil
+	return q2.query(q2.selectSql(), q2.selectArgs()...)
+}
+
+// compare a primary and shadow column with Equal or, if the shadow
+// column is a different type, by their NULLs and text
+func shadowEqual(pv, sv Value) bool {
+	if sv == nil {
+		return false
+	}
+	if reflect.TypeOf(pv) == reflect.TypeOf(sv) {
+		return pv.Equal(sv)
+	}
+	return pv.IsNull() == sv.IsNull() && pv.String() == sv.String()
+}
+
+// match up the records by primary key (or position) and return a
+// ShadowDiff for each one that is missing or has different columns
+func diffRecords(rel *Relation, primary, shadow []RecordValue) []*ShadowDiff {
+	key := func(i int, v RecordValue) string {
+		if pk := rel.pk(); pk != nil {
+			if pkv := v.ValueBy(pk.name); pkv != nil {
+				return pkv.String()
+			}
+		}
+		return strconv.Itoa(i)
+	}
+	byKey := make(map[string]RecordValue, len(shadow))
+	for i, v := range shadow {
+		byKey[key(i, v)] = v
+	}
+	var diffs []*ShadowDiff
+	for i, p := range primary {
+		k := key(i, p)
+		s, ok := byKey[k]
+		if !ok {
+			diffs = append(diffs, &ShadowDiff{Relation: rel.Name, Key: k, Primary: p})
+			continue
+		}
+		delete(byKey, k)
+		var cols []string
+		for _, c := range rel.cols {
+			if !shadowEqual(p.ValueBy(c.name), s.ValueBy(c.name)) {
+				cols = append(cols, c.name)
+			}
+		}
+		if len(cols) > 0 {
+			diffs = append(diffs, &ShadowDiff{Relation: rel.Name, Key: k, Primary: p, Shadow: s, Cols: cols})
+		}
+	}
+	for i, s := range shadow {
+		if k := key(i, s); byKey[k] != nil {
+			diffs = append(diffs, &ShadowDiff{Relation: rel.Name, Key: k, Shadow: s})
+		}
+	}
+	return diffs
+}
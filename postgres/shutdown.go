@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShutdown is returned by Query, Exec and Begin once Shutdown has
+// been called on the DB
+var ErrShutdown = errors.New("DB is shutting down")
+
+// counts the queries (open Rows and Exec calls) and transactions in
+// progress on a DB so Shutdown can wait for them
+type inflight struct {
+	mu      sync.Mutex
+	n       int
+	closing bool
+	idle    chan struct{} // closed when n drops to 0 (if waiting)
+}
+
+// start some work. Returns false once closing
+func (f *inflight) add() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closing {
+		return false
+	}
+	f.n++
+	return true
+}
+
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// stop accepting work and wait for the work in progress to finish
+func (f *inflight) drain(ctx context.Context) error {
+	f.mu.Lock()
+	f.closing = true
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown drains the DB so a service can stop cleanly. New queries and
+// transactions fail with ErrShutdown, the transaction watchdog, shadow
+// reads and row tracking are stopped and open Rows and transactions are
+// waited for until ctx is done. The pool is then closed. Returns ctx's
+// error if the wait was cut short (the pool is still closed)
+func (db *DB) Shutdown(ctx context.Context) error {
+	db.StopWatchingTransactions()
+	err := db.inflight.drain(ctx)
+	db.StopShadowReads()
+	db.StopTrackingRows()
+	cerr := db.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
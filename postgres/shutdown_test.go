@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: raw}
+	rs, err := db.Query("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- db.Shutdown(ctx) }()
+	for closing := false; !closing; {
+		db.inflight.mu.Lock()
+		closing = db.inflight.closing
+		db.inflight.mu.Unlock()
+	}
+	if _, err = db.Exec("x"); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected new work to be refused got: %v", err)
+	}
+	rs.Close()
+	if err = <-done; err != nil {
+		t.Errorf("expected shutdown to finish once the rows closed got: %v", err)
+	}
+
+	raw, err = sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = &DB{DB: raw}
+	if _, err = db.Query("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = db.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected shutdown to give up at the deadline got: %v", err)
+	}
+}
+
+func TestShutdownRefusesRowLookups(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: raw}
+	rel := testRelation()
+	rel.db = db
+	if _, err = rel.ApproxCount(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rel.IsEmpty(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected IsEmpty to be refused got: %v", err)
+	}
+	if _, err = rel.ApproxCount(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected ApproxCount to be refused got: %v", err)
+	}
+	if _, err = db.Type("thing"); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected Type to be refused got: %v", err)
+	}
+}
+
+func TestShutdownWaitsForConn(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: raw}
+	db.TrackRows(nil)
+	db.WatchTransactions(time.Minute, nil)
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- db.Shutdown(ctx) }()
+	// reads the hooks Shutdown clears while it waits
+	rs, err := c.Query("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+	select {
+	case err = <-done:
+		t.Fatalf("expected shutdown to wait for the Conn got: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.Close()
+	if err = <-done; err != nil {
+		t.Errorf("expected shutdown to finish once the Conn closed got: %v", err)
+	}
+	if _, err = db.Conn(context.Background()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected new connections to be refused got: %v", err)
+	}
+}
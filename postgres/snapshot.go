@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// version of the envelope written by Snapshot
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version  int           `json:"version"`
+	Relation string        `json:"relation,omitempty"`
+	Cols     []snapshotCol `json:"cols"`
+}
+
+// a column's driver.Value tagged with its type so it decodes
+// back to exactly what was encoded (json alone loses int vs float etc)
+type snapshotCol struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type,omitempty"` // empty means NULL
+	Value *string `json:"value,omitempty"`
+}
+
+func encodeSnapshotCol(name string, v driver.Value) (snapshotCol, error) {
+	c := snapshotCol{Name: name}
+	var s string
+	switch x := v.(type) {
+	case nil:
+		return c, nil
+	case int64:
+		c.Type, s = "int", fmt.Sprint(x)
+	case float64:
+		c.Type, s = "float", fmt.Sprint(x)
+	case bool:
+		c.Type, s = "bool", fmt.Sprint(x)
+	case string:
+		c.Type, s = "string", x
+	case []byte:
+		c.Type, s = "bytes", base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		c.Type, s = "time", x.Format(time.RFC3339Nano)
+	default:
+		return c, fmt.Errorf("cannot snapshot column %s with %T", name, v)
+	}
+	c.Value = &s
+	return c, nil
+}
+
+func (c snapshotCol) decode() (interface{}, error) {
+	if c.Type == "" {
+		return nil, nil
+	}
+	if c.Value == nil {
+		return nil, fmt.Errorf("snapshot column %s has no value", c.Name)
+	}
+	s := *c.Value
+	var v interface{}
+	var err error
+	switch c.Type {
+	case "int":
+		var i int64
+		_, err = fmt.Sscan(s, &i)
+		v = i
+	case "float":
+		var f float64
+		_, err = fmt.Sscan(s, &f)
+		v = f
+	case "bool":
+		v = s == "true"
+	case "string":
+		v = s
+	case "bytes":
+		v, err = base64.StdEncoding.DecodeString(s)
+	case "time":
+		v, err = time.Parse(time.RFC3339Nano, s)
+	default:
+		err = fmt.Errorf("unknown snapshot type %q", c.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snapshot column %s: %v", c.Name, err)
+	}
+	return v, nil
+}
+
+// Snapshot returns a versioned JSON encoding of the record's values
+// and relation name that RestoreSnapshot can later apply. Intended for
+// undo/redo or outbox style patterns.
+func (k *pgRecord) Snapshot() ([]byte, error) {
+	s := snapshot{Version: snapshotVersion}
+	if k.rel != nil {
+		s.Relation = k.rel.Name
+	}
+	for i, v := range k.vs {
+		dv, err := v.Value()
+		if err != nil {
+			return nil, fmt.Errorf("cannot snapshot column %s: %v", k.cs[i].name, err)
+		}
+		c, err := encodeSnapshotCol(k.cs[i].name, dv)
+		if err != nil {
+			return nil, err
+		}
+		s.Cols = append(s.Cols, c)
+	}
+	return json.Marshal(s)
+}
+
+// RestoreSnapshot sets the record's values from a Snapshot. It is an
+// error if the snapshot was taken from a different relation or if it
+// names a column the record does not have. Columns missing from the
+// snapshot are left unchanged.
+func (k *pgRecord) RestoreSnapshot(b []byte) error {
+	s, err := readSnapshot(b)
+	if err != nil {
+		return err
+	}
+	if k.rel != nil && s.Relation != "" && s.Relation != k.rel.Name {
+		return fmt.Errorf("cannot restore snapshot of %s into %s", s.Relation, k.rel.Name)
+	}
+	// decode everything first so a bad snapshot leaves k untouched
+	vals := make(map[Value]interface{}, len(s.Cols))
+	for _, c := range s.Cols {
+		v := k.ValueBy(c.Name)
+		if v == nil {
+			return fmt.Errorf("No column %s", c.Name)
+		}
+		vals[v], err = c.decode()
+		if err != nil {
+			return err
+		}
+	}
+	for v, src := range vals {
+		err = v.Scan(src)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSnapshot(b []byte) (*snapshot, error) {
+	s := new(snapshot)
+	err := json.Unmarshal(b, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return s, nil
+}
+
+// RestoreSnapshot returns a new RecordValue for the relation named in
+// the snapshot with the snapshot's values applied.
+func (db *DB) RestoreSnapshot(b []byte) (RecordValue, error) {
+	s, err := readSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	if s.Relation == "" {
+		return nil, fmt.Errorf("snapshot has no relation")
+	}
+	r, err := db.Relation(s.Relation)
+	if err != nil {
+		return nil, err
+	}
+	v, err := r.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return v, v.RestoreSnapshot(b)
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// SQL to fetch planner estimates and activity stats for a relation
+	selectStatsSql = `
+		SELECT
+			pgc.reltuples::float8,
+			pgc.relpages::int8,
+			COALESCE(s.n_live_tup, 0),
+			COALESCE(s.n_dead_tup, 0),
+			s.last_vacuum,
+			s.last_autovacuum,
+			s.last_analyze,
+			s.last_autoanalyze
+		FROM pg_class pgc
+		LEFT JOIN pg_stat_user_tables s ON s.relid = pgc.oid
+		WHERE pgc.oid = $1
+	`
+)
+
+// Stats holds size estimates and maintenance info for a Relation.
+// Times are zero if the operation has never run
+type Stats struct {
+	Tuples          float64 // estimated number of rows (pg_class.reltuples)
+	Pages           int64   // size on disk in pages (pg_class.relpages)
+	LiveTuples      int64
+	DeadTuples      int64
+	LastVacuum      time.Time
+	LastAutoVacuum  time.Time
+	LastAnalyze     time.Time
+	LastAutoAnalyze time.Time
+}
+
+var errNoDB = errors.New("Relation was not loaded from a database")
+
+// Fetch current statistics for the relation from
+// pg_class and pg_stat_user_tables
+func (r *Relation) Stats() (*Stats, error) {
+	if r.db == nil {
+		return nil, errNoDB
+	}
+	rows, err := r.db.Query(selectStatsSql, r.oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = fmt.Errorf("No pg_class entry for relation %s", r.Name)
+		}
+		return nil, err
+	}
+	st := new(Stats)
+	times := make([]Value, 4)
+	for i := range times {
+		times[i], _ = Timestamp(nil)
+	}
+	err = rows.Scan(&st.Tuples, &st.Pages, &st.LiveTuples, &st.DeadTuples,
+		times[0], times[1], times[2], times[3])
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range []*time.Time{&st.LastVacuum, &st.LastAutoVacuum, &st.LastAnalyze, &st.LastAutoAnalyze} {
+		if !times[i].IsNull() {
+			*t = times[i].Val().(time.Time)
+		}
+	}
+	return st, rows.Close()
+}
+
+// Run ANALYZE on the relation to refresh planner statistics
+func (r *Relation) Analyze() error {
+	if r.db == nil {
+		return errNoDB
+	}
+	_, err := r.db.Exec(fmt.Sprintf(`ANALYZE %s`, r.Name))
+	return err
+}
+
+// Run VACUUM on the relation. If analyze is true
+// then VACUUM ANALYZE is performed.
+// Cannot be run inside a transaction block
+func (r *Relation) Vacuum(analyze bool) error {
+	if r.db == nil {
+		return errNoDB
+	}
+	s := fmt.Sprintf(`VACUUM %s`, r.Name)
+	if analyze {
+		s = fmt.Sprintf(`VACUUM ANALYZE %s`, r.Name)
+	}
+	_, err := r.db.Exec(s)
+	return err
+}
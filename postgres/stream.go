@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// number of rows FETCHed from the cursor at a time by Stream
+const streamBatch = 1000
+
+// RecordEncoder writes RecordValues to a stream. See Query.Stream
+type RecordEncoder interface {
+	// called once before any records ie to write a header
+	Begin(w io.Writer, rel *Relation) error
+	Encode(w io.Writer, v RecordValue) error
+	// called once after all records
+	End(w io.Writer) error
+}
+
+// CSV encodes records as comma separated values with a header row of
+// column names. NULLs are written as empty fields
+var CSV RecordEncoder = csvEncoder{}
+
+// NDJSON encodes each record as a JSON object on its own line
+var NDJSON RecordEncoder = ndjsonEncoder{}
+
+type csvEncoder struct{}
+
+func (csvEncoder) write(w io.Writer, fields []string) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(fields)
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (e csvEncoder) Begin(w io.Writer, rel *Relation) error {
+	names := make([]string, len(rel.cols))
+	for i, c := range rel.cols {
+		names[i] = c.name
+	}
+	return e.write(w, names)
+}
+
+func (e csvEncoder) Encode(w io.Writer, v RecordValue) error {
+	vals := v.Values()
+	fields := make([]string, len(vals))
+	for i, x := range vals {
+		fields[i] = x.String()
+	}
+	return e.write(w, fields)
+}
+
+func (csvEncoder) End(w io.Writer) error {
+	return nil
+}
+
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Begin(w io.Writer, rel *Relation) error {
+	return nil
+}
+
+// keys are each column's alias (if any) in column order
+func (ndjsonEncoder) Encode(w io.Writer, v RecordValue) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (ndjsonEncoder) End(w io.Writer) error {
+	return nil
+}
+
+// Stream every row matching the query to w using enc without holding
+// more than a batch of rows in memory. Rows are read through a server
+// side cursor inside a transaction (the Query's own Tx if it was built
+// from one) and the export stops when ctx is cancelled, ie:
+//
+//	err := db.From("person").Stream(r.Context(), w, CSV)
+func (q *Query) Stream(ctx context.Context, w io.Writer, enc RecordEncoder) (err error) {
+	if q.err != nil {
+		return q.err
+	}
+	var tx *sql.Tx
+	switch x := q.tx.(type) {
+	case *DB:
+		ptx, err := x.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer ptx.Rollback()
+		tx = ptx.Tx
+	case *ReadOnlyDB:
+		ptx, err := x.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer ptx.Rollback()
+		tx = ptx.Tx
+	case *Tx:
+		tx = x.Tx
+	default:
+		return fmt.Errorf("cannot Stream a query on %T", q.tx)
+	}
+	// declared and scanned like Fetch so SelectExpr extras, partial
+	// records and ctids are handled the same way
+	q, _ = q.withCtid()
+	_, err = tx.ExecContext(ctx, `DECLARE pql_stream NO SCROLL CURSOR FOR `+q.fetchSql(), q.selectArgs()...)
+	if err != nil {
+		return err
+	}
+	defer tx.Exec(`CLOSE pql_stream`)
+	bw := bufio.NewWriter(w)
+	err = enc.Begin(bw, q.from)
+	if err != nil {
+		return err
+	}
+	for {
+		n, err := q.streamBatch(ctx, tx, bw, enc)
+		if err != nil {
+			return err
+		}
+		if n < streamBatch {
+			break
+		}
+	}
+	err = enc.End(bw)
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// FETCH and encode the next batch of rows from the cursor
+func (q *Query) streamBatch(ctx context.Context, tx *sql.Tx, w io.Writer, enc RecordEncoder) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM pql_stream`, streamBatch))
+	if err != nil {
+		return 0, err
+	}
+	rs := &Rows{Rows: rows, rel: q.from}
+	defer rs.Close()
+	extras := q.extraExprs()
+	n := 0
+	for rs.Next() {
+		v, err := q.scanRow(rs, extras)
+		if err != nil {
+			return n, err
+		}
+		err = enc.Encode(w, v)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rs.Err()
+}
@@ -0,0 +1,391 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// convert a Go field name to the column name it maps to by default
+// ie LocationID -> location_id
+func snakeCase(s string) string {
+	rs := []rune(s)
+	b := new(strings.Builder)
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			// start a new word at a lower->upper change or at the
+			// end of an acronym (the "I" in "IDName")
+			if i > 0 && (unicode.IsLower(rs[i-1]) ||
+				(i+1 < len(rs) && unicode.IsLower(rs[i+1]) && unicode.IsUpper(rs[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// map column names to struct field indexes for t.
+// Fields are matched by a `db:"name"` tag or the snake_case of the
+// field name. Fields tagged `db:"-"` and unexported fields are ignored
+// and untagged embedded structs are flattened
+func structFields(t reflect.Type) map[string][]int {
+	fs := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for name, idx := range structFields(f.Type) {
+				if _, ok := fs[name]; !ok {
+					fs[name] = append([]int{i}, idx...)
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		fs[name] = []int{i}
+	}
+	return fs
+}
+
+// return the struct value that ptr points to
+func structElem(ptr interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a non-nil pointer to a struct got: %T", ptr)
+	}
+	return rv.Elem(), nil
+}
+
+// copy each column of v into the matching field of the struct dest
+func recordToStruct(v RecordValue, dest reflect.Value) error {
+	fs := structFields(dest.Type())
+	for name, vx := range v.Map() {
+		idx, ok := fs[name]
+		if !ok {
+			continue
+		}
+		err := setField(dest.FieldByIndex(idx), vx)
+		if err != nil {
+			return fmt.Errorf("cannot set field for column %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+func setField(f reflect.Value, vx Value) error {
+	// let fields that know how to scan themselves do so
+	if f.CanAddr() && f.Addr().Type().Implements(scannerType) {
+		dv, err := vx.Value()
+		if err != nil {
+			return err
+		}
+		return f.Addr().Interface().(sql.Scanner).Scan(dv)
+	}
+	if vx.IsNull() {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	// pointer fields are allocated for non NULL values
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		err := setField(p.Elem(), vx)
+		if err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	src := reflect.ValueOf(vx.Val())
+	switch {
+	case src.Type().AssignableTo(f.Type()):
+		f.Set(src)
+	case src.Type().ConvertibleTo(f.Type()) && src.Kind() != reflect.Slice:
+		f.Set(src.Convert(f.Type()))
+	case src.Kind() == reflect.Slice && f.Kind() == reflect.Slice:
+		// ie []interface{} from an array into []string
+		s := reflect.MakeSlice(f.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			el := src.Index(i)
+			if el.Kind() == reflect.Interface {
+				el = el.Elem()
+			}
+			if !el.IsValid() {
+				continue
+			}
+			if !el.Type().ConvertibleTo(f.Type().Elem()) {
+				return fmt.Errorf("cannot use %s as %s", el.Type(), f.Type().Elem())
+			}
+			s.Index(i).Set(el.Convert(f.Type().Elem()))
+		}
+		f.Set(s)
+	default:
+		return fmt.Errorf("cannot use %T as %s", vx.Val(), f.Type())
+	}
+	return nil
+}
+
+// Build a RecordValue from the fields of the struct (or pointer to
+// struct) v so it can be passed to Insert/Update. Columns are matched
+// to fields like Repo does and columns without a field are left NULL
+// and marked as not loaded (see IsPartial) so they are not written
+func (r *Relation) FromStruct(v interface{}) (RecordValue, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct or pointer to a struct got: %T", v)
+	}
+	return structToRecord(r, rv)
+}
+
+// set the primary key columns whose field in src is the zero value to
+// NULL so an INSERT leaves them to their default (ie a serial id)
+func nullZeroKeys(rel *Relation, v RecordValue, src reflect.Value) error {
+	fs := structFields(src.Type())
+	for _, c := range rel.pks() {
+		idx, ok := fs[c.name]
+		if !ok || !src.FieldByIndex(idx).IsZero() {
+			continue
+		}
+		err := v.Set(c.name, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build a RecordValue for rel from the fields of the struct src.
+// Columns without a matching field are left NULL and not loaded
+func structToRecord(rel *Relation, src reflect.Value) (RecordValue, error) {
+	v, err := rel.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	fs := structFields(src.Type())
+	mapped := make([]string, 0, len(rel.cols))
+	for _, c := range rel.cols {
+		idx, ok := fs[c.name]
+		if !ok {
+			continue
+		}
+		mapped = append(mapped, c.name)
+		data, err := fieldData(src.FieldByIndex(idx))
+		if err != nil {
+			return nil, err
+		}
+		err = v.Set(c.name, data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set column %s: %v", c.name, err)
+		}
+	}
+	if len(mapped) < len(rel.cols) {
+		setPartial(v, mapped)
+	}
+	return v, nil
+}
+
+// return something suitable for passing to Value.Scan
+func fieldData(f reflect.Value) (interface{}, error) {
+	if vr, ok := f.Interface().(driver.Valuer); ok {
+		if f.Kind() == reflect.Ptr && f.IsNil() {
+			return nil, nil
+		}
+		return vr.Value()
+	}
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil, nil
+		}
+		f = f.Elem()
+	}
+	switch f.Kind() {
+	// use the underlying types for named basic types
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Bool:
+		return f.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return f.Float(), nil
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			return f.Bytes(), nil
+		}
+		if f.IsNil() {
+			return nil, nil
+		}
+		// arrays are scanned from []interface{}
+		vals := make([]interface{}, f.Len())
+		for i := range vals {
+			el, err := fieldData(f.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = el
+		}
+		return vals, nil
+	}
+	return f.Interface(), nil
+}
+
+// Scan the current row into the struct pointed to by dest matching
+// columns to fields like Repo does. Columns of the relation the rows
+// came from (if known) are decoded with its Values, others are
+// scanned straight into the field. Columns without a field are ignored
+func (rs *Rows) ScanStruct(dest interface{}) error {
+	rv, err := structElem(dest)
+	if err != nil {
+		return err
+	}
+	names, err := rs.Columns()
+	if err != nil {
+		return err
+	}
+	fs := structFields(rv.Type())
+	vals := make([]interface{}, len(names))
+	vs := make([]Value, len(names))
+	for i, name := range names {
+		idx, ok := fs[name]
+		if !ok {
+			vals[i] = new(interface{})
+			continue
+		}
+		if rs.rel != nil {
+			if c := rs.rel.col(name); c != nil {
+				vs[i], err = c.k(nil)
+				if err != nil {
+					return err
+				}
+				vals[i] = vs[i]
+				continue
+			}
+		}
+		vals[i] = rv.FieldByIndex(idx).Addr().Interface()
+	}
+	err = rs.Scan(vals...)
+	if err != nil {
+		return err
+	}
+	for i, v := range vs {
+		if v == nil {
+			continue
+		}
+		err = setField(rv.FieldByIndex(fs[names[i]]), v)
+		if err != nil {
+			return fmt.Errorf("cannot set field for column %s: %v", names[i], err)
+		}
+	}
+	return nil
+}
+
+// Fetch the query's rows into dest which must be a pointer to a slice
+// of structs (or of pointers to structs). See Repo for how columns are
+// matched to fields
+func (q *Query) FetchStructs(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice of structs got: %T", dest)
+	}
+	st := rv.Elem().Type()
+	et := st.Elem()
+	ptr := et.Kind() == reflect.Ptr
+	if ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a slice of structs got: %T", dest)
+	}
+	vs, err := q.Fetch()
+	if err != nil {
+		return err
+	}
+	s := reflect.MakeSlice(st, len(vs), len(vs))
+	for i, v := range vs {
+		el := s.Index(i)
+		if ptr {
+			el.Set(reflect.New(et))
+			el = el.Elem()
+		}
+		err = recordToStruct(v, el)
+		if err != nil {
+			return err
+		}
+	}
+	rv.Elem().Set(s)
+	return nil
+}
+
+var mapType = reflect.TypeOf(map[string]interface{}{})
+
+// Fetch the query's rows into dest which must be a pointer to a slice of:
+//
+//   - map[string]interface{} keyed by column name (NULLs are nil and
+//     columns not Selected are left out)
+//   - structs (or pointers to structs) as FetchStructs
+//   - a plain type (ie []int64 or []string) if the query Selects exactly
+//     one column, ie db.From("person").Select("id").FetchInto(&ids)
+func (q *Query) FetchInto(dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice got: %T", dest)
+	}
+	st := rv.Elem().Type()
+	et := st.Elem()
+	if et.Kind() == reflect.Struct || (et.Kind() == reflect.Ptr && et.Elem().Kind() == reflect.Struct) {
+		return q.FetchStructs(dest)
+	}
+	var col string
+	if et != mapType {
+		if len(q.picked) != 1 {
+			return fmt.Errorf("cannot fetch %s into %T: Select exactly one column", q.from.Name, dest)
+		}
+		col = q.picked[0]
+	}
+	vs, err := q.Fetch()
+	if err != nil {
+		return err
+	}
+	s := reflect.MakeSlice(st, len(vs), len(vs))
+	for i, v := range vs {
+		if col == "" {
+			m := make(map[string]interface{}, len(v.Values()))
+			for name, vx := range v.Map() {
+				if v.Loaded(name) {
+					m[name] = vx.Val()
+				}
+			}
+			s.Index(i).Set(reflect.ValueOf(m))
+			continue
+		}
+		err = setField(s.Index(i), v.ValueBy(col))
+		if err != nil {
+			return fmt.Errorf("cannot fetch column %s into %T: %v", col, dest, err)
+		}
+	}
+	rv.Elem().Set(s)
+	return nil
+}
@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPerson struct {
+	ID         int64
+	Name       string
+	Age        *int
+	LocationID int    `db:"location_id"`
+	Ignored    string `db:"-"`
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, out := range map[string]string{
+		"Name":       "name",
+		"LocationID": "location_id",
+		"IDName":     "id_name",
+		"createdAt":  "created_at",
+	} {
+		if s := snakeCase(in); s != out {
+			t.Errorf("expected %s to be %s got: %s", in, out, s)
+		}
+	}
+}
+
+func TestStructRecordRoundTrip(t *testing.T) {
+	cols := []*col{
+		Col("id", BigInt),
+		Col("name", Text),
+		Col("age", Integer),
+		Col("location_id", Integer),
+		Col("tags", Array(Text)),
+		Col("at", Timestamp),
+	}
+	rel := &Relation{Name: "person", k: Record(cols...), cols: cols}
+	type tagged struct {
+		testPerson
+		Tags []string
+		At   time.Time
+	}
+	age := 30
+	src := tagged{testPerson{1, "bob", &age, 100, "x"}, []string{"a", "b"}, date1}
+	v, err := structToRecord(rel, reflect.ValueOf(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("location_id").(int64) != 100 || v.Get("age").(int64) != 30 {
+		t.Errorf("unexpected record: %s", v.String())
+	}
+	var dest tagged
+	err = recordToStruct(v, reflect.ValueOf(&dest).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest.Ignored = "x"
+	if !reflect.DeepEqual(src, dest) {
+		t.Errorf("expected %v got: %v", src, dest)
+	}
+	// NULL into a pointer field
+	v.Set("age", nil)
+	err = recordToStruct(v, reflect.ValueOf(&dest).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.Age != nil {
+		t.Errorf("expected NULL age to be nil got: %v", *dest.Age)
+	}
+}
+
+func TestFetchStructsDest(t *testing.T) {
+	q := &Query{from: testRelation()}
+	var p testPerson
+	var ints []int
+	for _, dest := range []interface{}{nil, p, &p, &ints} {
+		if err := q.FetchStructs(dest); err == nil {
+			t.Errorf("expected %T to be rejected", dest)
+		}
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.FromStruct(&testPerson{ID: 7, Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("id") != int64(7) || v.Get("name") != "bob" || !v.ValueBy("age").IsNull() {
+		t.Errorf("unexpected record: %s", v)
+	}
+	if v.Relation() != rel {
+		t.Errorf("expected record to belong to the relation")
+	}
+	type nameOnly struct {
+		ID   int64
+		Name string
+	}
+	v, err = rel.FromStruct(nameOnly{ID: 7, Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsPartial() || v.Loaded("age") || !v.Loaded("name") {
+		t.Errorf("expected columns without a field not to be loaded")
+	}
+	if set := p.loaded(v).set; len(set) != 1 || set[0].name != "name" {
+		t.Errorf("expected only the mapped columns to be updated got: %v", set)
+	}
+	if _, err = rel.FromStruct(7); err == nil {
+		t.Errorf("expected a non struct to be rejected")
+	}
+}
+
+func TestRepoInsertZeroKey(t *testing.T) {
+	rel := testRelation()
+	for _, tc := range []struct {
+		p    testPerson
+		sql  string
+		args int
+	}{
+		{testPerson{Name: "bob"}, "INSERT INTO person (name,age) VALUES ($1,$2)", 2},
+		{testPerson{ID: 7, Name: "bob"}, "INSERT INTO person (id,name,age) VALUES ($1,$2,$3)", 3},
+	} {
+		src := reflect.ValueOf(&tc.p).Elem()
+		v, err := structToRecord(rel, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = nullZeroKeys(rel, v, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := rel.insertPlan(v)
+		if s := p.insertSql(); !strings.HasPrefix(s, tc.sql) {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.sql, s)
+		}
+		if args := p.args(v); len(args) != tc.args {
+			t.Errorf("expected %d args got: %v", tc.args, args)
+		}
+	}
+}
+
+func TestFetchInto(t *testing.T) {
+	raw, err := sql.Open("pql_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	db := &DB{DB: raw}
+	q := &Query{tx: db, from: NewRelation("x", Col("x", BigInt, PrimaryKey()))}
+	var ids []int64
+	err = q.Select("x").FetchInto(&ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("expected [1] got: %v", ids)
+	}
+	var ms []map[string]interface{}
+	err = q.FetchInto(&ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0]["x"] != int64(1) {
+		t.Errorf("expected [map[x:1]] got: %v", ms)
+	}
+	var xs []struct{ X int }
+	err = q.FetchInto(&xs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xs) != 1 || xs[0].X != 1 {
+		t.Errorf("expected a struct with X = 1 got: %v", xs)
+	}
+	if err = q.FetchInto(&ids); err == nil {
+		t.Errorf("expected fetching a plain slice without Select to fail")
+	}
+	if err = q.FetchInto(ids); err == nil {
+		t.Errorf("expected a non pointer to fail")
+	}
+}
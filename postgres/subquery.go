@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// replace the placeholders in w of params that are a *Query with the
+// query's SQL in parentheses, ie Where("location_id IN $1", sub), and
+// bind the subquery's params after the others renumbering to match
+func bindSubqueries(w string, params []interface{}) (string, []interface{}, error) {
+	subs := false
+	for _, p := range params {
+		if sub, ok := p.(*Query); ok {
+			if sub.err != nil {
+				return "", nil, fmt.Errorf("invalid subquery: %w", sub.err)
+			}
+			subs = true
+		}
+	}
+	if !subs {
+		return w, params, nil
+	}
+	bound := make([]interface{}, 0, len(params))
+	holders := make([]string, len(params)) // replacement for each $N
+	for i, p := range params {
+		if sub, ok := p.(*Query); ok {
+			holders[i] = "(" + renumber(sub.subquerySql(), len(bound)) + ")"
+			bound = append(bound, sub.selectArgs()...)
+			continue
+		}
+		bound = append(bound, p)
+		holders[i] = "$" + strconv.Itoa(len(bound))
+	}
+	var err error
+	w = placePat.ReplaceAllStringFunc(w, func(m string) string {
+		n, _ := strconv.Atoi(m[2:])
+		if n < 1 || n > len(holders) {
+			err = fmt.Errorf("no param given for %s", m[1:])
+			return m
+		}
+		return m[:1] + holders[n-1]
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return w, bound, nil
+}
+
+// SQL for the query used as a subquery. Only the columns
+// named in Select (if any) are selected
+func (q *Query) subquerySql() string {
+	if len(q.picked) == 0 {
+		return q.selectSql()
+	}
+	fields := make([]string, len(q.picked))
+	for i, name := range q.picked {
+		fields[i] = q.field(name)
+	}
+	return q.selectSql(fields...)
+}
@@ -104,3 +104,10 @@ func (k *pgText) Val() interface{} {
 	}
 	return k.s
 }
+
+func (k *pgText) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
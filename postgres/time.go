@@ -24,6 +24,7 @@ var timeFormats = []string{
 	"15:04:05-07",
 	"15:04:05",
 	"2006-01-02",
+	time.RFC3339Nano,
 }
 
 func parseTime(s string, t *time.Time) (err error) {
@@ -62,7 +63,11 @@ func (k *pgTimestamp) Scan(src interface{}) error {
 	case []byte:
 		return parseTime(string(x), &k.t)
 	default:
-		return fmt.Errorf("cannot set TIMESTAMP value with %T -> %v", src, src)
+		t, ok := civilTime(src)
+		if !ok {
+			return fmt.Errorf("cannot set TIMESTAMP value with %T -> %v", src, src)
+		}
+		k.t = t
 	}
 	return nil
 }
@@ -98,3 +103,197 @@ func (k *pgTimestamp) Val() interface{} {
 	}
 	return k.t
 }
+
+func (k *pgTimestamp) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// TimestampTZ is like Timestamp but keeps the zone offset postgres
+// returns (the session's TimeZone) rather than treating it as UTC
+func TimestampTZ(data interface{}) (Value, error) {
+	k := new(pgTimestampTZ)
+	return k, k.Scan(data)
+}
+
+// TimestampTZIn returns a ToValue for TimestampTZ Values that are
+// converted to loc when set, ie to display times in a user's zone:
+//
+//	TimestampTZIn(time.Local)
+func TimestampTZIn(loc *time.Location) ToValue {
+	return func(data interface{}) (Value, error) {
+		k := &pgTimestampTZ{loc: loc}
+		return k, k.Scan(data)
+	}
+}
+
+type pgTimestampTZ struct {
+	t     time.Time
+	loc   *time.Location // convert to this location (if set)
+	valid bool
+}
+
+// formats for timestamptz output including
+// offsets with minutes ie India's +05:30
+var timeTZFormats = []string{
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05-07:00:00",
+	time.RFC3339Nano,
+}
+
+func parseTimeTZ(s string, t *time.Time) error {
+	for _, f := range timeTZFormats {
+		if x, err := time.Parse(f, s); err == nil {
+			*t = x
+			return nil
+		}
+	}
+	// fall back to the formats without an offset
+	return parseTime(s, t)
+}
+
+func (k *pgTimestampTZ) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case time.Time:
+		k.t = x
+	case string:
+		err = parseTimeTZ(x, &k.t)
+	case []byte:
+		err = parseTimeTZ(string(x), &k.t)
+	default:
+		return fmt.Errorf("cannot set TIMESTAMPTZ value with %T -> %v", src, src)
+	}
+	if err == nil && k.loc != nil {
+		k.t = k.t.In(k.loc)
+	}
+	return err
+}
+
+func (k *pgTimestampTZ) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgTimestampTZ) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.t, nil
+}
+
+func (k *pgTimestampTZ) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.t.Format(time.RFC3339Nano)), nil
+}
+
+func (k *pgTimestampTZ) String() string {
+	if !k.valid {
+		return ""
+	}
+	return k.t.Format(time.RFC3339Nano)
+}
+
+func (k *pgTimestampTZ) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.t
+}
+
+func (k *pgTimestampTZ) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+func Date(data interface{}) (Value, error) {
+	k := new(pgDate)
+	return k, k.Scan(data)
+}
+
+// date values are held as midnight UTC on the day
+type pgDate struct {
+	t     time.Time
+	valid bool
+}
+
+const dateFormat = "2006-01-02"
+
+func (k *pgDate) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	var t time.Time
+	switch x := src.(type) {
+	case time.Time:
+		t = x
+	case string:
+		err = parseTime(x, &t)
+	case []byte:
+		err = parseTime(string(x), &t)
+	default:
+		var ok bool
+		t, ok = civilTime(src)
+		if !ok {
+			return fmt.Errorf("cannot set DATE value with %T -> %v", src, src)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// drop the time part in the time's own zone so the day doesn't shift
+	y, m, d := t.Date()
+	k.t = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return nil
+}
+
+func (k *pgDate) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgDate) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgDate) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgDate) String() string {
+	if !k.valid {
+		return ""
+	}
+	return k.t.Format(dateFormat)
+}
+
+func (k *pgDate) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.t
+}
+
+func (k *pgDate) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
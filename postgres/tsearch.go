@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A lexeme from a tsvector (or tsquery)
+type Lexeme struct {
+	Word      string
+	Positions []int  // positions of the word in the document (if any)
+	Weights   []byte // weight (A-D) of each position
+}
+
+// A Value made up of text search lexemes
+type LexemeValue interface {
+	Value
+	Lexemes() []Lexeme
+}
+
+func TSVector(data interface{}) (Value, error) {
+	k := new(pgTSVector)
+	return k, k.Scan(data)
+}
+
+type pgTSVector struct {
+	ls    []Lexeme
+	valid bool
+}
+
+// read a (possibly single quoted) word from the start of s.
+// returns the word and the rest of s
+func readLexeme(s string) (string, string, error) {
+	if s[0] != '\'' {
+		i := strings.IndexAny(s, " :&|!()")
+		if i == -1 {
+			i = len(s)
+		}
+		return s[:i], s[i:], nil
+	}
+	w := new(strings.Builder)
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			w.WriteByte(s[i])
+		case s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+			w.WriteByte('\'')
+		case s[i] == '\'':
+			return w.String(), s[i+1:], nil
+		default:
+			w.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated lexeme in %s", s)
+}
+
+func quoteLexeme(w string) string {
+	w = strings.Replace(w, `\`, `\\`, -1)
+	w = strings.Replace(w, `'`, `''`, -1)
+	return "'" + w + "'"
+}
+
+// parse the tsvector text format ie 'a':1A,2 'cat':3
+func parseTSVector(s string) ([]Lexeme, error) {
+	ls := make([]Lexeme, 0)
+	s = strings.TrimSpace(s)
+	for s != "" {
+		word, rest, err := readLexeme(s)
+		if err != nil {
+			return nil, err
+		}
+		l := Lexeme{Word: word}
+		if strings.HasPrefix(rest, ":") {
+			i := strings.IndexByte(rest, ' ')
+			if i == -1 {
+				i = len(rest)
+			}
+			for _, p := range strings.Split(rest[1:i], ",") {
+				weight := byte('D')
+				if n := len(p); n > 0 && p[n-1] >= 'A' && p[n-1] <= 'D' {
+					weight = p[n-1]
+					p = p[:n-1]
+				}
+				pos, err := strconv.Atoi(p)
+				if err != nil {
+					return nil, fmt.Errorf("invalid lexeme position %s", p)
+				}
+				l.Positions = append(l.Positions, pos)
+				l.Weights = append(l.Weights, weight)
+			}
+			rest = rest[i:]
+		}
+		ls = append(ls, l)
+		s = strings.TrimLeft(rest, " ")
+	}
+	return ls, nil
+}
+
+func (k *pgTSVector) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case []Lexeme:
+		k.ls = x
+	case string:
+		k.ls, err = parseTSVector(x)
+	case []byte:
+		k.ls, err = parseTSVector(string(x))
+	default:
+		return fmt.Errorf("cannot set TSVECTOR value with %T -> %v", src, src)
+	}
+	return err
+}
+
+func (k *pgTSVector) Lexemes() []Lexeme {
+	return k.ls
+}
+
+func (k *pgTSVector) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgTSVector) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgTSVector) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgTSVector) String() string {
+	if !k.valid {
+		return ""
+	}
+	parts := make([]string, len(k.ls))
+	for i, l := range k.ls {
+		parts[i] = quoteLexeme(l.Word)
+		for j, pos := range l.Positions {
+			sep := ","
+			if j == 0 {
+				sep = ":"
+			}
+			parts[i] += sep + strconv.Itoa(pos)
+			if j < len(l.Weights) && l.Weights[j] != 'D' {
+				parts[i] += string(l.Weights[j])
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (k *pgTSVector) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgTSVector) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+func TSQuery(data interface{}) (Value, error) {
+	k := new(pgTSQuery)
+	return k, k.Scan(data)
+}
+
+// the query text is kept as is and only parsed for Lexemes
+type pgTSQuery struct {
+	s     string
+	valid bool
+}
+
+func (k *pgTSQuery) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case string:
+		k.s = x
+	case []byte:
+		k.s = string(x)
+	default:
+		return fmt.Errorf("cannot set TSQUERY value with %T -> %v", src, src)
+	}
+	_, err := k.lexemes()
+	return err
+}
+
+// find the words in the query skipping operators and
+// any :* or weight suffixes
+func (k *pgTSQuery) lexemes() ([]Lexeme, error) {
+	ls := make([]Lexeme, 0)
+	s := k.s
+	for s != "" {
+		switch {
+		case strings.ContainsRune(" &|!()", rune(s[0])):
+			s = s[1:]
+		case s[0] == '<':
+			// phrase operator <-> or <N>
+			i := strings.IndexByte(s, '>')
+			if i == -1 {
+				return nil, fmt.Errorf("invalid tsquery %s", k.s)
+			}
+			s = s[i+1:]
+		case s[0] == ':':
+			i := strings.IndexAny(s, " &|!()")
+			if i == -1 {
+				i = len(s)
+			}
+			s = s[i:]
+		default:
+			word, rest, err := readLexeme(s)
+			if err != nil {
+				return nil, err
+			}
+			ls = append(ls, Lexeme{Word: word})
+			s = rest
+		}
+	}
+	return ls, nil
+}
+
+func (k *pgTSQuery) Lexemes() []Lexeme {
+	ls, _ := k.lexemes()
+	return ls
+}
+
+func (k *pgTSQuery) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgTSQuery) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.s, nil
+}
+
+func (k *pgTSQuery) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.s), nil
+}
+
+func (k *pgTSQuery) String() string {
+	if !k.valid {
+		return ""
+	}
+	return k.s
+}
+
+func (k *pgTSQuery) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.s
+}
+
+func (k *pgTSQuery) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
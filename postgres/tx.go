@@ -1,9 +1,11 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sync/atomic"
 )
 
 // wrapper type around sql.Tx
@@ -11,7 +13,17 @@ import (
 // RecordValues
 type Tx struct {
 	*sql.Tx
-	db *DB
+	db       *DB
+	done     int32                  // set to 1 once Commit or Rollback has been called
+	readOnly bool                   // opened by a ReadOnlyDB
+	ctids    map[RecordValue]string // ctid of rows read/written (see IdentityCtid)
+	active   int32                  // 1 while counted as in progress by the DB (see Shutdown)
+	onCommit []func()               // run once the Tx has committed
+}
+
+// Reports whether Commit or Rollback has been called on the Tx
+func (tx *Tx) Done() bool {
+	return atomic.LoadInt32(&tx.done) == 1
 }
 
 func (tx *Tx) Relations() (rels map[string]*Relation, err error) {
@@ -33,36 +45,61 @@ func (tx *Tx) From(name string) *Query {
 	return q
 }
 
-// perform query q and update values in v from the first RETURNING result
-func (tx *Tx) queryAndUpdate(q string, v RecordValue, update bool) error {
-	rs, err := tx.Query(q, v.Relation().valArgs(v, update)...)
+// perform the write planned by p and update values
+// in v from the first RETURNING result
+func (tx *Tx) writeAndRefresh(ctx context.Context, p *writePlan, q string, v RecordValue, args []interface{}) error {
+	if p.returning() == "" {
+		_, err := tx.Tx.ExecContext(ctx, q, args...)
+		return err
+	}
+	rs, err := tx.QueryContext(ctx, q, args...)
 	if err != nil {
 		return err
 	}
 	defer rs.Close()
 	for rs.Next() {
-		err := rs.ScanRecord(v)
+		var ctid string
+		err := p.scan(rs, v, &ctid)
 		if err != nil {
 			return err
 		}
+		if p.match == identityCtid {
+			tx.setCtid(v, ctid)
+		}
+	}
+	err = rs.Err()
+	if err != nil {
+		return err
 	}
 	return rs.Close()
 }
 
+// args for an UPDATE or DELETE planned by p including
+// the ctid of v if that is how the row is identified
+func (tx *Tx) whereArgs(p *writePlan, v RecordValue) ([]interface{}, error) {
+	args := p.args(v)
+	if p.match == identityCtid {
+		ctid, err := tx.ctid(v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, ctid)
+	}
+	return args, nil
+}
+
 // INSERT RecordValue(s)
 func (tx *Tx) Insert(vs ...RecordValue) error {
+	return tx.InsertContext(context.Background(), vs...)
+}
+
+// like Insert but the statements are cancelled when ctx is done
+func (tx *Tx) InsertContext(ctx context.Context, vs ...RecordValue) error {
+	if tx.readOnly {
+		return ErrReadOnly
+	}
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return errors.New("RecordValue does not have a relation set")
-		}
-		bnds, _ := rel.bindings(false, false)
-		s := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) RETURNING %s`,
-			rel.Name,
-			rel.fields(false),
-			bnds,
-			rel.fields(true))
-		err := tx.queryAndUpdate(s, v, false)
+		err := tx.insert(ctx, v, nil)
 		if err != nil {
 			return err
 		}
@@ -70,48 +107,124 @@ func (tx *Tx) Insert(vs ...RecordValue) error {
 	return nil
 }
 
+// INSERT v re-reading only the named columns via RETURNING (nothing if
+// none are named) in place of the relation's RefreshAfterWrite policy
+func (tx *Tx) InsertReturning(v RecordValue, names ...string) error {
+	if tx.readOnly {
+		return ErrReadOnly
+	}
+	ret := RefreshCols(names...)
+	return tx.insert(context.Background(), v, &ret)
+}
+
+// INSERT v re-reading the columns of ret (nil means the relation's policy)
+func (tx *Tx) insert(ctx context.Context, v RecordValue, ret *RefreshPolicy) error {
+	rel := v.Relation()
+	if rel == nil {
+		return errors.New("RecordValue does not have a relation set")
+	}
+	p := rel.insertPlan(v)
+	if ret != nil {
+		err := rel.checkRefresh(*ret)
+		if err != nil {
+			return err
+		}
+		p.ret = rel.refreshCols(ret)
+	}
+	return tx.writeAndRefresh(ctx, p, p.insertSql(), v, p.args(v))
+}
+
 // UPDATE RecordValue(s)
 func (tx *Tx) Update(vs ...RecordValue) error {
+	return tx.UpdateContext(context.Background(), vs...)
+}
+
+// like Update but the statements are cancelled when ctx is done
+func (tx *Tx) UpdateContext(ctx context.Context, vs ...RecordValue) error {
+	if tx.readOnly {
+		return ErrReadOnly
+	}
 	for _, v := range vs {
-		rel := v.Relation()
-		if rel == nil {
-			return errors.New("RecordValue does not have a relation set")
+		err := tx.update(ctx, v, nil)
+		if err != nil {
+			return err
 		}
-		pk := rel.pk()
-		if pk == nil {
-			return errors.New("Relation must have a primary key to use Update")
-		}
-		bnds, n := rel.bindings(false, true)
-		s := fmt.Sprintf(`UPDATE %s SET %s WHERE %s = $%d RETURNING %s`,
-			rel.Name,
-			bnds,
-			pk.name,
-			n+1,
-			rel.fields(true))
-		err := tx.queryAndUpdate(s, v, true)
+	}
+	return nil
+}
+
+// UPDATE v re-reading only the named columns via RETURNING (nothing if
+// none are named) in place of the relation's RefreshAfterWrite policy
+func (tx *Tx) UpdateReturning(v RecordValue, names ...string) error {
+	if tx.readOnly {
+		return ErrReadOnly
+	}
+	ret := RefreshCols(names...)
+	return tx.update(context.Background(), v, &ret)
+}
+
+// UPDATE v re-reading the columns of ret (nil means the relation's policy)
+func (tx *Tx) update(ctx context.Context, v RecordValue, ret *RefreshPolicy) error {
+	rel := v.Relation()
+	if rel == nil {
+		return errors.New("RecordValue does not have a relation set")
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		return err
+	}
+	if ret != nil {
+		err = rel.checkRefresh(*ret)
 		if err != nil {
 			return err
 		}
+		p.ret = rel.refreshCols(ret)
+	}
+	p = p.loaded(v)
+	if len(p.set) == 0 {
+		return fmt.Errorf("cannot Update %s: no writable columns are loaded", rel.Name)
+	}
+	args, err := tx.whereArgs(p, v)
+	if err != nil {
+		return err
+	}
+	err = tx.writeAndRefresh(ctx, p, p.updateSql(), v, args)
+	if err != nil {
+		return err
+	}
+	if pk := rel.pk(); pk != nil {
+		return tx.invalidate(rel, v.ValueBy(pk.name))
 	}
 	return nil
 }
 
 // UPDATE or INSERT RecordValue(s)
-func (tx *Tx) Upsert(vs ...RecordValue) (err error) {
+// RecordValues with a NULL primary key are INSERTed
+func (tx *Tx) Upsert(vs ...RecordValue) error {
+	return tx.UpsertContext(context.Background(), vs...)
+}
+
+// like Upsert but the statements are cancelled when ctx is done
+func (tx *Tx) UpsertContext(ctx context.Context, vs ...RecordValue) (err error) {
 	for _, v := range vs {
 		rel := v.Relation()
 		if rel == nil {
 			return errors.New("RecordValue does not have a relation set")
 		}
-		pk := rel.pk()
-		if pk == nil {
+		pks := rel.pks()
+		if len(pks) == 0 {
 			return errors.New("Relation has no primary key")
 		}
-		pkv := v.ValueBy(pk.name)
-		if pkv == nil || pkv.IsNull() {
-			err = tx.Insert(v)
+		insert := false
+		for _, pk := range pks {
+			if pkv := v.ValueBy(pk.name); pkv == nil || pkv.IsNull() {
+				insert = true
+			}
+		}
+		if insert {
+			err = tx.InsertContext(ctx, v)
 		} else {
-			err = tx.Update(v)
+			err = tx.UpdateContext(ctx, v)
 		}
 		if err != nil {
 			return err
@@ -122,38 +235,123 @@ func (tx *Tx) Upsert(vs ...RecordValue) (err error) {
 
 // DELETE RecordValue(s)
 func (tx *Tx) Delete(vs ...RecordValue) error {
+	return tx.DeleteContext(context.Background(), vs...)
+}
+
+// like Delete but the statements are cancelled when ctx is done
+func (tx *Tx) DeleteContext(ctx context.Context, vs ...RecordValue) error {
+	if tx.readOnly {
+		return ErrReadOnly
+	}
 	for _, v := range vs {
 		rel := v.Relation()
 		if rel == nil {
 			return errors.New("RecordValue does not have a relation set")
 		}
-		pk := rel.pk()
-		if pk == nil {
-			return errors.New("Relation has no primary key")
+		p, err := rel.deletePlan()
+		if err != nil {
+			return err
+		}
+		for _, c := range p.key {
+			if v.ValueBy(c.name) == nil {
+				return errors.New("Value must have a primary key set")
+			}
 		}
-		pkv := v.ValueBy(pk.name)
-		if pkv == nil {
-			return errors.New("Value must have a primary key set")
+		args, err := tx.whereArgs(p, v)
+		if err != nil {
+			return err
+		}
+		rs, err := tx.Tx.QueryContext(ctx, p.deleteSql(), args...)
+		if err != nil {
+			return err
 		}
-		s := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`,
-			rel.Name,
-			pk.name)
-		rs, err := tx.Tx.Query(s, pkv)
+		err = rs.Close()
 		if err != nil {
 			return err
 		}
-		rs.Close()
+		if pk := rel.pk(); pk != nil {
+			err = tx.invalidate(rel, v.ValueBy(pk.name))
+			if err != nil {
+				return err
+			}
+		}
+		delete(tx.ctids, v)
 	}
 	return nil
 }
 
+// Commit the transaction
+func (tx *Tx) Commit() error {
+	atomic.StoreInt32(&tx.done, 1)
+	tx.untrack()
+	err := tx.Tx.Commit()
+	if err == nil {
+		for _, fn := range tx.onCommit {
+			fn()
+		}
+	}
+	tx.onCommit = nil
+	return err
+}
+
+// Abort the transaction
+func (tx *Tx) Rollback() error {
+	atomic.StoreInt32(&tx.done, 1)
+	tx.untrack()
+	return tx.Tx.Rollback()
+}
+
+// remove the record with primary key pk from rel's cache now the row
+// is written and again once the Tx commits, as a Get in between reads
+// (and caches) the row as it was before the Tx
+func (tx *Tx) invalidate(rel *Relation, pk interface{}) error {
+	c := rel.cache
+	if c == nil {
+		return nil
+	}
+	key, err := rel.cacheKey(pk)
+	if err != nil {
+		return err
+	}
+	c.Delete(key)
+	tx.onCommit = append(tx.onCommit, func() { c.Delete(key) })
+	return nil
+}
+
+// stop the watchdog (if any) from tracking this tx
+// and the DB from counting it as in progress
+func (tx *Tx) untrack() {
+	if w := tx.db.txWatchdog(); w != nil {
+		w.untrack(tx)
+	}
+	if atomic.CompareAndSwapInt32(&tx.active, 1, 0) {
+		tx.db.inflight.done()
+	}
+}
+
+// like sql.Tx.Exec but fails early if the Tx is READ ONLY
+func (tx *Tx) Exec(q string, vals ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), q, vals...)
+}
+
+// like Exec but the statement is cancelled when ctx is done
+func (tx *Tx) ExecContext(ctx context.Context, q string, vals ...interface{}) (sql.Result, error) {
+	if tx.readOnly {
+		return nil, ErrReadOnly
+	}
+	return tx.Tx.ExecContext(ctx, castComposites(q, vals), vals...)
+}
+
 // like sql.Tx.Query only returns a *Rows rather than *sql.Rows
 func (tx *Tx) Query(q string, vals ...interface{}) (*Rows, error) {
-	rows, err := tx.Tx.Query(q, vals...)
+	return tx.QueryContext(context.Background(), q, vals...)
+}
+
+// like Query but the query is cancelled when ctx is done
+func (tx *Tx) QueryContext(ctx context.Context, q string, vals ...interface{}) (*Rows, error) {
+	rows, err := tx.Tx.QueryContext(ctx, castComposites(q, vals), vals...)
 	if err != nil {
 		return nil, err
 	}
-	rs := new(Rows)
-	rs.Rows = rows
-	return rs, nil
+	return tx.db.newRows(q, rows), nil
 }
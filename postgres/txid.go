@@ -0,0 +1,332 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LSNValue is a Value holding a WAL location
+type LSNValue interface {
+	Value
+	LSN() uint64
+}
+
+// SnapshotValue is a Value holding a transaction snapshot
+type SnapshotValue interface {
+	Value
+	Xmin() uint64
+	Xmax() uint64
+	Xip() []uint64
+	Visible(txid uint64) bool
+}
+
+// WAL location ie "16/B374D848". Can be set from a string,
+// []byte or the uint64 position
+func LSN(data interface{}) (Value, error) {
+	k := new(pgLSN)
+	return k, k.Scan(data)
+}
+
+type pgLSN struct {
+	n     uint64
+	valid bool
+}
+
+func parseLSN(s string) (uint64, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid PG_LSN %s", s)
+	}
+	hi, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PG_LSN %s", s)
+	}
+	lo, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PG_LSN %s", s)
+	}
+	return hi<<32 | lo, nil
+}
+
+func (k *pgLSN) Scan(src interface{}) (err error) {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case uint64:
+		k.n = x
+	case int64:
+		k.n = uint64(x)
+	case int:
+		k.n = uint64(x)
+	case string:
+		k.n, err = parseLSN(x)
+	case []byte:
+		k.n, err = parseLSN(string(x))
+	default:
+		return fmt.Errorf("cannot set PG_LSN value with %T -> %v", src, src)
+	}
+	return err
+}
+
+func (k *pgLSN) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgLSN) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgLSN) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgLSN) String() string {
+	if !k.valid {
+		return ""
+	}
+	return fmt.Sprintf("%X/%X", k.n>>32, uint32(k.n))
+}
+
+func (k *pgLSN) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgLSN) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// the position as a byte offset (so LSNs can be subtracted)
+func (k *pgLSN) LSN() uint64 {
+	return k.n
+}
+
+// 32 bit transaction id
+func XID(data interface{}) (Value, error) {
+	k := new(pgXID)
+	return k, k.Scan(data)
+}
+
+type pgXID struct {
+	n     uint32
+	valid bool
+}
+
+func (k *pgXID) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	var s string
+	switch x := src.(type) {
+	case int64:
+		k.n = uint32(x)
+		return nil
+	case int:
+		k.n = uint32(x)
+		return nil
+	case uint32:
+		k.n = x
+		return nil
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	default:
+		return fmt.Errorf("cannot set XID value with %T -> %v", src, src)
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid XID %s", s)
+	}
+	k.n = uint32(n)
+	return nil
+}
+
+func (k *pgXID) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgXID) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgXID) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgXID) String() string {
+	if !k.valid {
+		return ""
+	}
+	return strconv.FormatUint(uint64(k.n), 10)
+}
+
+func (k *pgXID) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return int64(k.n)
+}
+
+func (k *pgXID) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// txid_snapshot/pg_snapshot ie "10:20:10,14,15"
+func TxidSnapshot(data interface{}) (Value, error) {
+	k := new(pgSnapshot)
+	return k, k.Scan(data)
+}
+
+type pgSnapshot struct {
+	xmin  uint64
+	xmax  uint64
+	xip   []uint64
+	valid bool
+}
+
+func (k *pgSnapshot) parse(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid TXID_SNAPSHOT %s", s)
+	}
+	var err error
+	k.xmin, err = strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid TXID_SNAPSHOT %s", s)
+	}
+	k.xmax, err = strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid TXID_SNAPSHOT %s", s)
+	}
+	k.xip = make([]uint64, 0)
+	if parts[2] == "" {
+		return nil
+	}
+	for _, x := range strings.Split(parts[2], ",") {
+		n, err := strconv.ParseUint(x, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid TXID_SNAPSHOT %s", s)
+		}
+		k.xip = append(k.xip, n)
+	}
+	return nil
+}
+
+func (k *pgSnapshot) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case string:
+		return k.parse(x)
+	case []byte:
+		return k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set TXID_SNAPSHOT value with %T -> %v", src, src)
+	}
+}
+
+func (k *pgSnapshot) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgSnapshot) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgSnapshot) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgSnapshot) String() string {
+	if !k.valid {
+		return ""
+	}
+	xip := make([]string, len(k.xip))
+	for i, x := range k.xip {
+		xip[i] = strconv.FormatUint(x, 10)
+	}
+	return fmt.Sprintf("%d:%d:%s", k.xmin, k.xmax, strings.Join(xip, ","))
+}
+
+func (k *pgSnapshot) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgSnapshot) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+// earliest transaction id that is still active
+func (k *pgSnapshot) Xmin() uint64 {
+	return k.xmin
+}
+
+// first as-yet-unassigned transaction id
+func (k *pgSnapshot) Xmax() uint64 {
+	return k.xmax
+}
+
+// transaction ids in progress at the time of the snapshot
+func (k *pgSnapshot) Xip() []uint64 {
+	return append([]uint64{}, k.xip...)
+}
+
+// like pg_visible_in_snapshot reports whether txid
+// was committed as far as the snapshot is concerned
+func (k *pgSnapshot) Visible(txid uint64) bool {
+	if txid < k.xmin {
+		return true
+	}
+	if txid >= k.xmax {
+		return false
+	}
+	for _, x := range k.xip {
+		if x == txid {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+// UintValue is a Value that can be read as an unsigned 64 bit integer
+type UintValue interface {
+	Value
+	Uint64() (uint64, error)
+}
+
+// OIDUint is an unsigned 32 bit integer Value (ie an oid or xid) whose
+// Val is a uint32 so the full range round trips. Can be set from any Go
+// integer type that fits or a string
+func OIDUint(data interface{}) (Value, error) {
+	k := new(pgUint)
+	return k, k.Scan(data)
+}
+
+type pgUint struct {
+	n     uint32
+	valid bool
+}
+
+func (k *pgUint) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	var n uint64
+	switch x := src.(type) {
+	case int, int8, int16, int32, int64:
+		i, err := fitInt(x, 64)
+		if err != nil {
+			return err
+		}
+		if i < 0 || i > 1<<32-1 {
+			return &IntRangeError{src, 32}
+		}
+		n = uint64(i)
+	case uint:
+		n = uint64(x)
+	case uint8:
+		n = uint64(x)
+	case uint16:
+		n = uint64(x)
+	case uint32:
+		n = uint64(x)
+	case uint64:
+		n = x
+	case string:
+		return k.parse(x)
+	case []byte:
+		return k.parse(string(x))
+	default:
+		return fmt.Errorf("cannot set OID value with %T -> %v", src, src)
+	}
+	if n > 1<<32-1 {
+		return &IntRangeError{src, 32}
+	}
+	k.n = uint32(n)
+	return nil
+}
+
+func (k *pgUint) parse(s string) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	k.n = uint32(n)
+	return nil
+}
+
+func (k *pgUint) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgUint) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return int64(k.n), nil
+}
+
+func (k *pgUint) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgUint) String() string {
+	if !k.valid {
+		return ""
+	}
+	return strconv.FormatUint(uint64(k.n), 10)
+}
+
+func (k *pgUint) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.n
+}
+
+func (k *pgUint) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
+
+func (k *pgUint) Uint64() (uint64, error) {
+	return uint64(k.n), nil
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// queries combined by Union or UnionAll
+type union struct {
+	sql  string        // numbers its own placeholders from $1
+	args []interface{} // params for sql
+}
+
+// Return a new Query for the rows of this query combined with the rows
+// of other (without duplicates). Both queries must be of relations with
+// the same columns. Where, OrderBy, Limit etc called on the returned
+// Query apply to the combined rows, ie:
+//
+//	db.From("person").Where("age < $1", 18).Union(db.From("person").Where("age > $1", 65)).OrderBy("age")
+func (q *Query) Union(other *Query) *Query {
+	return q.combine(other, "UNION")
+}
+
+// Like Union but keeps duplicate rows
+func (q *Query) UnionAll(other *Query) *Query {
+	return q.combine(other, "UNION ALL")
+}
+
+func (q *Query) combine(other *Query, op string) *Query {
+	if q.err != nil {
+		return q
+	}
+	q2 := q.cp()
+	if other.err != nil {
+		q2.err = fmt.Errorf("invalid %s: %w", op, other.err)
+		return q2
+	}
+	if err := sameCols(q.from, other.from); err != nil {
+		q2.err = fmt.Errorf("cannot %s %s and %s: %v", op, q.from.Name, other.from.Name, err)
+		return q2
+	}
+	for _, x := range []*Query{q, other} {
+		if len(x.extraExprs()) > 0 || x.lock != "" || len(x.preloads) > 0 {
+			q2.err = fmt.Errorf("cannot %s queries with extra expressions, preloads or row locks", op)
+			return q2
+		}
+	}
+	left := q.selectSql()
+	q2.union = &union{
+		sql:  fmt.Sprintf("(%s) %s (%s)", left, op, renumber(other.selectSql(), len(q.selectArgs()))),
+		args: append(q.selectArgs(), other.selectArgs()...),
+	}
+	q2.where = nil
+	q2.whereParams = nil
+	q2.order = ""
+	q2.limit = 0
+	q2.offset = 0
+	q2.joins = nil
+	q2.ctes = nil
+	q2.exprs = nil
+	q2.cols = nil
+	q2.picked = nil
+	q2.reverse = false
+	return q2
+}
+
+// check a and b have the same column names and types in the same order
+func sameCols(a, b *Relation) error {
+	if len(a.cols) != len(b.cols) {
+		return fmt.Errorf("%d columns != %d columns", len(a.cols), len(b.cols))
+	}
+	for i, c := range a.cols {
+		if c.name != b.cols[i].name || c.typ != b.cols[i].typ {
+			return fmt.Errorf("column %d is %s %s not %s %s", i+1, c.name, c.typ, b.cols[i].name, b.cols[i].typ)
+		}
+	}
+	return nil
+}
+
+// the FROM item of the query: the relation or
+// the combined queries aliased as the relation
+func (q *Query) fromExpr(offset int) string {
+	if q.union == nil {
+		return q.from.Name
+	}
+	return fmt.Sprintf("(%s) AS %s", renumber(q.union.sql, offset), q.from.Name)
+}
+
+// the params of the combined queries
+func (q *Query) unionArgs() []interface{} {
+	if q.union == nil {
+		return nil
+	}
+	return q.union.args
+}
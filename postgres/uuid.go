@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+func UUID(data interface{}) (Value, error) {
+	k := new(pgUUID)
+	return k, k.Scan(data)
+}
+
+type pgUUID struct {
+	u     [16]byte
+	valid bool
+}
+
+// parse any of the input forms postgres accepts for uuid
+// ie a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11, {a0eebc999c0b4ef8bb6d6bb9bd380a11}
+func parseUUID(s string, u *[16]byte) error {
+	h := s
+	if strings.HasPrefix(h, "{") && strings.HasSuffix(h, "}") {
+		h = h[1 : len(h)-1]
+	}
+	h = strings.Replace(h, "-", "", -1)
+	if len(h) != 32 {
+		return fmt.Errorf("invalid UUID %s", s)
+	}
+	_, err := hex.Decode(u[:], []byte(h))
+	if err != nil {
+		return fmt.Errorf("invalid UUID %s", s)
+	}
+	return nil
+}
+
+func (k *pgUUID) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case [16]byte:
+		k.u = x
+	case string:
+		return parseUUID(x, &k.u)
+	case []byte:
+		// raw 16 byte form
+		if len(x) == 16 {
+			copy(k.u[:], x)
+			return nil
+		}
+		return parseUUID(string(x), &k.u)
+	default:
+		return fmt.Errorf("cannot set UUID Value with %T -> %v", src, src)
+	}
+	return nil
+}
+
+func (k *pgUUID) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgUUID) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return k.String(), nil
+}
+
+func (k *pgUUID) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *pgUUID) String() string {
+	if !k.valid {
+		return ""
+	}
+	h := hex.EncodeToString(k.u[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:])
+}
+
+// returns the canonical string form
+func (k *pgUUID) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return k.String()
+}
+
+func (k *pgUUID) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}
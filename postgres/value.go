@@ -3,6 +3,7 @@ package postgres
 import (
 	"database/sql"
 	"database/sql/driver"
+	"time"
 )
 
 type Value interface {
@@ -12,6 +13,13 @@ type Value interface {
 	String() string
 	bytes() ([]byte, error)
 	Val() interface{}
+	// Val or fallback if NULL
+	ValOr(fallback interface{}) interface{}
+	// a deep copy that can be modified independently
+	Clone() Value
+	// true if other is the same kind with an equal value (NULLs are
+	// equal to each other like IS NOT DISTINCT FROM)
+	Equal(other Value) bool
 }
 
 type IteratorValue interface {
@@ -26,6 +34,7 @@ type MapValue interface {
 	Map() map[string]Value
 	ValueBy(name string) Value
 	Get(name string) interface{}
+	GetOr(name string, fallback interface{}) interface{}
 	Set(name string, src interface{}) error
 }
 
@@ -34,9 +43,62 @@ type RecordValue interface {
 	Map() map[string]Value
 	ValueBy(name string) Value
 	Get(name string) interface{}
+	GetOr(name string, fallback interface{}) interface{}
 	Set(name string, src interface{}) error
 	Relation() *Relation
 	SetRelation(*Relation)
+	Hash() string
+	FieldMap() map[string]Value
+	Snapshot() ([]byte, error)
+	RestoreSnapshot([]byte) error
+	Related(name string) []RecordValue
+	IsPartial() bool
+	Loaded(name string) bool
+	Extra(name string) interface{}
 }
 
 type ToValue func(data interface{}) (Value, error)
+
+type DurationValue interface {
+	Value
+	Duration() time.Duration
+}
+
+// Must panics if err is not nil otherwise returns v.
+// Intended for building literal Values, ie:
+//
+//	q.Where("name = $1", Must(Text("bob")))
+func Must(v Value, err error) Value {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func MustText(data interface{}) Value {
+	return Must(Text(data))
+}
+
+func MustSmallInt(data interface{}) Value {
+	return Must(SmallInt(data))
+}
+
+func MustInteger(data interface{}) Value {
+	return Must(Integer(data))
+}
+
+func MustBigInt(data interface{}) Value {
+	return Must(BigInt(data))
+}
+
+func MustDouble(data interface{}) Value {
+	return Must(Double(data))
+}
+
+func MustBool(data interface{}) Value {
+	return Must(Bool(data))
+}
+
+func MustTimestamp(data interface{}) Value {
+	return Must(Timestamp(data))
+}
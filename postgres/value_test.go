@@ -3,9 +3,16 @@ package postgres
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"math"
+	"net"
+	"strings"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -19,10 +26,26 @@ var date1 = time.Date(2009, time.November, 10, 15, 0, 0, 0, time.UTC)
 var date2 = time.Date(2012, time.January, 1, 23, 0, 0, 0, time.UTC)
 var ok = false
 
-var _ IteratorValue = &pgArray{}
+var _ ArrayValue = &pgArray{}
 var _ IteratorValue = &pgRecord{}
 var _ MapValue = &pgRecord{}
 var _ MapValue = &pgHStore{}
+var _ DurationValue = &pgInterval{}
+var _ LexemeValue = &pgTSVector{}
+var _ LTreeValue = &pgLTree{}
+var _ LSNValue = &pgLSN{}
+var _ RegValue = &pgReg{}
+var _ UintValue = &pgUint{}
+var _ UintValue = &pgNumeric{}
+var _ SnapshotValue = &pgSnapshot{}
+var _ LexemeValue = &pgTSQuery{}
+var _ XMLValue = &pgXML{}
+var _ JSONValue = &pgJSON{}
+var _ OrderedValue = &pgInteger{}
+var _ OrderedValue = &pgNumeric{}
+var _ OrderedValue = &pgTimestampTZ{}
+var _ RangeValue = &pgRange{}
+var _ IteratorValue = &pgMultirange{}
 
 func gobang(t *testing.T, c *Case, msg string, q string, err error) {
 	var drv driver.Value
@@ -758,6 +781,33 @@ func TestTimestampVal(t *testing.T) {
 	}
 }
 
+func TestDateVal(t *testing.T) {
+	v, err := Date(time.Date(2001, 2, 3, 23, 30, 0, 0, time.FixedZone("X", -5*3600)))
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.String() != "2001-02-03" {
+		t.Errorf("unexpected val: %v", v.String())
+	}
+	if !v.Val().(time.Time).Equal(time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected val to be midnight UTC got: %v", v.Val())
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
 func TestArrayVal(t *testing.T) {
 	v, err := Array(Int)([]interface{}{1, 2})
 	if err != nil {
@@ -911,3 +961,1108 @@ func TestHStoreVal(t *testing.T) {
 		t.Errorf("unexpected return type %T for Val()", v.Val())
 	}
 }
+
+func TestUUIDVal(t *testing.T) {
+	v, err := UUID("{A0EEBC999C0B4EF8BB6D6BB9BD380A11}")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.Val().(string) != "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if err = v.Scan("a0eebc99-xxxx"); err == nil {
+		t.Errorf("expected invalid UUID to return an error")
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestIntervalVal(t *testing.T) {
+	v, err := Interval(90 * time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.Val().(time.Duration) != 90*time.Minute {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if v.String() != "01:30:00" {
+		t.Errorf("unexpected string: %v", v.String())
+	}
+	for s, expected := range map[string]string{
+		"1 year 2 mons 3 days 04:05:06.5": "1 year 2 mons 3 days 04:05:06.5",
+		"-1 days +02:03:04":               "-1 days +02:03:04",
+		"@ 1 day 2 hours ago":             "-1 days -02:00:00",
+		"P1Y2M3DT4H5M6S":                  "1 year 2 mons 3 days 04:05:06",
+		"PT0S":                            "00:00:00",
+	} {
+		err = v.Scan(s)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if v.String() != expected {
+			t.Errorf("expected %s to be %s got: %s", s, expected, v.String())
+		}
+	}
+	err = v.Scan("1 day 02:00:00")
+	if err != nil {
+		t.Error(err)
+	}
+	if d := v.(DurationValue).Duration(); d != 26*time.Hour {
+		t.Errorf("expected duration of 26h got: %v", d)
+	}
+	if err = v.Scan("1 fortnight"); err == nil {
+		t.Errorf("expected unknown unit to return an error")
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestInetVal(t *testing.T) {
+	v, err := Inet("192.168.100.128/25")
+	if err != nil {
+		t.Error(err)
+	}
+	if v.String() != "192.168.100.128/25" {
+		t.Errorf("unexpected string: %v", v.String())
+	}
+	err = v.Scan(net.ParseIP("10.0.0.1"))
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if !v.Val().(net.IP).Equal(net.ParseIP("10.0.0.1")) || v.String() != "10.0.0.1" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if err = v.Scan("10.0.0.300"); err == nil {
+		t.Errorf("expected invalid address to return an error")
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestCidrVal(t *testing.T) {
+	v, err := Cidr("2001:db8::/32")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(*net.IPNet).String() != "2001:db8::/32" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if err = v.Scan("10.1.2.3/16"); err == nil {
+		t.Errorf("expected host bits to the right of the mask to return an error")
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestMust(t *testing.T) {
+	if v := MustBigInt(7); v.Val().(int64) != 7 {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if v := Must(VarChar(2)("abc")); v.String() != "ab" {
+		t.Errorf("unexpected val: %v", v.String())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Must to panic on error")
+		}
+	}()
+	MustInteger("x")
+}
+
+func TestMacAddrVal(t *testing.T) {
+	v, err := MacAddr("08002B:010203")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.String() != "08:00:2b:01:02:03" {
+		t.Errorf("unexpected val: %v", v.String())
+	}
+	if err = v.Scan("08:00:2b:01:02:03:04:05"); err == nil {
+		t.Errorf("expected 8 byte address to not fit into MacAddr")
+	}
+	v8, err := MacAddr8("08:00:2b:01:02:03")
+	if err != nil {
+		t.Error(err)
+	}
+	if v8.String() != "08:00:2b:ff:fe:01:02:03" {
+		t.Errorf("unexpected val: %v", v8.String())
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestTSVectorVal(t *testing.T) {
+	v, err := TSVector(`'a':1A,2 'cat':3 'it''s' 'fat':4B`)
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.String() != `'a':1A,2 'cat':3 'it''s' 'fat':4B` {
+		t.Errorf("unexpected val: %v", v.String())
+	}
+	ls := v.(LexemeValue).Lexemes()
+	if len(ls) != 4 || ls[2].Word != "it's" || ls[0].Positions[1] != 2 || ls[3].Weights[0] != 'B' {
+		t.Errorf("unexpected lexemes: %v", ls)
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestTSQueryVal(t *testing.T) {
+	v, err := TSQuery(`'fat' & ( 'rat':AB | !'cat':* ) <-> 'sat'`)
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	words := make([]string, 0)
+	for _, l := range v.(LexemeValue).Lexemes() {
+		words = append(words, l.Word)
+	}
+	if strings.Join(words, ",") != "fat,rat,cat,sat" {
+		t.Errorf("unexpected lexemes: %v", words)
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestXMLVal(t *testing.T) {
+	type note struct {
+		XMLName xml.Name `xml:"note"`
+		To      string   `xml:"to"`
+	}
+	v, err := XML(note{To: "bob"})
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.Val().(string) != "<note><to>bob</to></note>" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	var n note
+	err = v.(XMLValue).Unmarshal(&n)
+	if err != nil {
+		t.Error(err)
+	}
+	if n.To != "bob" {
+		t.Errorf("expected to to be bob got: %v", n.To)
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestRangeVal(t *testing.T) {
+	v, err := Range(Integer)("[1,10)")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	r := v.(RangeValue)
+	if r.Lower().Val().(int64) != 1 || r.Upper().Val().(int64) != 10 || r.Bounds() != "[)" {
+		t.Errorf("unexpected range: %v", v.String())
+	}
+	err = v.Scan([]interface{}{nil, 5, "(]"})
+	if err != nil {
+		t.Error(err)
+	}
+	if !r.Lower().IsNull() || v.String() != "(,5]" {
+		t.Errorf("expected unbounded lower got: %v", v.String())
+	}
+	err = v.Scan("empty")
+	if err != nil {
+		t.Error(err)
+	}
+	if !r.IsEmpty() || v.String() != "empty" {
+		t.Errorf("expected empty range got: %v", v.String())
+	}
+	ts, err := Range(Timestamp)(`["2010-01-01 14:30:00","2010-01-01 15:30:00")`)
+	if err != nil {
+		t.Error(err)
+	}
+	err = ts.Scan(ts.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if ts.(RangeValue).Upper().String() != "2010-01-01T15:30:00Z" {
+		t.Errorf("unexpected upper bound: %v", ts.(RangeValue).Upper())
+	}
+	if err = v.Scan("[1,2,3)"); err == nil {
+		t.Errorf("expected invalid range literal to return an error")
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestTimestampTZRange(t *testing.T) {
+	ist := time.FixedZone("", 5*3600+1800)
+	upper := time.Date(2010, 1, 1, 15, 30, 0, 0, ist)
+	for _, tc := range []struct {
+		oid uint32
+		s   string
+	}{
+		{tstzrangeOid, `["2010-01-01 14:30:00+05:30","2010-01-01 15:30:00+05:30")`},
+		{tstzmultirangeOid, `{["2010-01-01 14:30:00+05:30","2010-01-01 15:30:00+05:30")}`},
+	} {
+		f, ok := typeFor(tc.oid)
+		if !ok {
+			t.Fatalf("no type for oid %d", tc.oid)
+		}
+		k, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := k(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, src := range []interface{}{v.Val(), v.String()} {
+			err = v.Scan(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, ok := v.(RangeValue)
+			if !ok {
+				r = v.(IteratorValue).ValueAt(0).(RangeValue)
+			}
+			got := r.Upper().Val().(time.Time)
+			if !got.Equal(upper) {
+				t.Errorf("expected %v got: %v", upper, got)
+			}
+			if _, off := got.Zone(); off != 5*3600+1800 {
+				t.Errorf("expected the +05:30 offset to be kept got: %v", got)
+			}
+		}
+	}
+	k, err := (&DB{loc: time.UTC}).kind(tstzrangeOid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := k(`["2010-01-01 14:30:00+05:30","2010-01-01 15:30:00+05:30")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.(RangeValue).Upper().String(); s != "2010-01-01T10:00:00Z" {
+		t.Errorf("expected the bound converted to the DB location got: %s", s)
+	}
+}
+
+func TestMultirangeVal(t *testing.T) {
+	v, err := Multirange(Integer)("{[1,3), [5,9)}")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.IsNull() {
+		t.Errorf("expected val to not be NULL")
+	}
+	if v.String() != "{[1,3),[5,9)}" {
+		t.Errorf("unexpected val: %v", v.String())
+	}
+	r := v.(IteratorValue).ValueAt(1).(RangeValue)
+	if r.Lower().Val().(int64) != 5 || r.Upper().Val().(int64) != 9 {
+		t.Errorf("unexpected second range: %v", r)
+	}
+	err = v.Scan("{}")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(v.(IteratorValue).Values()) != 0 {
+		t.Errorf("expected empty multirange got: %v", v.String())
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestLTreeVal(t *testing.T) {
+	v, err := LTree("Top.Science.Astronomy")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	lt := v.(LTreeValue)
+	if lt.Depth() != 3 || lt.Label(0) != "Top" || lt.Label(-1) != "Astronomy" {
+		t.Errorf("unexpected labels: %v", lt.Labels())
+	}
+	p := lt.Parent()
+	if p.String() != "Top.Science" {
+		t.Errorf("unexpected parent: %s", p)
+	}
+	if !p.IsAncestorOf(lt) || lt.IsAncestorOf(p) {
+		t.Errorf("expected %s to be an ancestor of %s", p, lt)
+	}
+	if err = v.Scan("Top.bad label"); err == nil {
+		t.Errorf("expected invalid label to return an error")
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestDomainVal(t *testing.T) {
+	v, err := Domain("positive_int", Integer)(nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = v.Value(); err == nil {
+		t.Errorf("expected NULL to be rejected by NOT NULL domain")
+	}
+	err = v.Scan(5)
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(int64) != 5 {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if x, err := v.Value(); err != nil || x.(int64) != 5 {
+		t.Errorf("unexpected value: %v %v", x, err)
+	}
+}
+
+func TestLSNVal(t *testing.T) {
+	v, err := LSN("16/B374D848")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(string) != "16/B374D848" {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if v.(LSNValue).LSN() != 0x16B374D848 {
+		t.Errorf("unexpected position: %X", v.(LSNValue).LSN())
+	}
+	if err = v.Scan("nope"); err == nil {
+		t.Errorf("expected invalid PG_LSN to return an error")
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestXIDVal(t *testing.T) {
+	v, err := XID([]byte("4294967295"))
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(int64) != 4294967295 {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	if err = v.Scan("-1"); err == nil {
+		t.Errorf("expected invalid XID to return an error")
+	}
+}
+
+func TestTxidSnapshotVal(t *testing.T) {
+	v, err := TxidSnapshot("10:20:10,14,15")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.String() != "10:20:10,14,15" {
+		t.Errorf("unexpected string: %s", v)
+	}
+	snap := v.(SnapshotValue)
+	if snap.Xmin() != 10 || snap.Xmax() != 20 || len(snap.Xip()) != 3 {
+		t.Errorf("unexpected snapshot: %s", v)
+	}
+	if !snap.Visible(9) || snap.Visible(14) || !snap.Visible(13) || snap.Visible(20) {
+		t.Errorf("unexpected visibility for %s", v)
+	}
+	v.Scan(nil)
+	if v.Val() != nil {
+		t.Errorf("expected val to be nil got: %v", v.Val())
+	}
+}
+
+func TestRegVal(t *testing.T) {
+	v, err := RegClass("person")
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	r := v.(RegValue)
+	if r.Name() != "person" || r.Oid() != 0 {
+		t.Errorf("unexpected regclass: %s %d", r.Name(), r.Oid())
+	}
+	v.Scan([]byte("1259"))
+	if r.Oid() != 1259 || r.Name() != "" || v.String() != "1259" {
+		t.Errorf("expected numeric regclass to set the oid got: %s %d", r.Name(), r.Oid())
+	}
+	v.Scan(nil)
+	if !v.IsNull() {
+		t.Errorf("expected val to be NULL")
+	}
+}
+
+func TestOIDUintVal(t *testing.T) {
+	v, err := OIDUint(uint64(4294967295))
+	if err != nil {
+		t.Error(err)
+	}
+	err = v.Scan(v.String())
+	if err != nil {
+		t.Error(err)
+	}
+	if v.Val().(uint32) != 4294967295 {
+		t.Errorf("unexpected val: %v", v.Val())
+	}
+	var rerr *IntRangeError
+	if err = v.Scan(uint64(1 << 32)); !errors.As(err, &rerr) {
+		t.Errorf("expected an IntRangeError got: %v", err)
+	}
+	if err = v.Scan(-1); !errors.As(err, &rerr) {
+		t.Errorf("expected an IntRangeError got: %v", err)
+	}
+}
+
+func TestUint64Fallbacks(t *testing.T) {
+	var rerr *IntRangeError
+	if _, err := BigInt(uint64(math.MaxUint64)); !errors.As(err, &rerr) {
+		t.Errorf("expected an IntRangeError got: %v", err)
+	}
+	if _, err := BigInt(uint64(math.MaxInt64)); err != nil {
+		t.Errorf("expected MaxInt64 to fit into a BigInt: %v", err)
+	}
+	if _, err := SmallInt(-32768); err != nil {
+		t.Errorf("expected MinInt16 to fit into a SmallInt: %v", err)
+	}
+	if _, err := SmallInt(-32769); err == nil {
+		t.Errorf("expected -32769 to not fit into a SmallInt")
+	}
+	v, err := Numeric(20, 0)(uint64(math.MaxUint64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "18446744073709551615" {
+		t.Errorf("unexpected numeric: %s", v)
+	}
+	n, err := v.(UintValue).Uint64()
+	if err != nil || n != math.MaxUint64 {
+		t.Errorf("unexpected Uint64: %d %v", n, err)
+	}
+	v, _ = Numeric(15, 3)(5)
+	if v.String() != "5.000" {
+		t.Errorf("unexpected numeric: %s", v)
+	}
+}
+
+func TestTimestampTZVal(t *testing.T) {
+	v, err := TimestampTZ("2011-01-01 23:01:00+05:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "2011-01-01T23:01:00+05:30" {
+		t.Errorf("expected offset to be preserved got: %s", v)
+	}
+	err = v.Scan(v.Val())
+	if err != nil {
+		t.Error(err)
+	}
+	_, offset := v.Val().(time.Time).Zone()
+	if offset != 5*60*60+30*60 {
+		t.Errorf("unexpected offset: %d", offset)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	v, err = TimestampTZIn(ny)("2011-01-01 12:00:00+00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "2011-01-01T07:00:00-05:00" {
+		t.Errorf("expected time to be converted to New York got: %s", v)
+	}
+}
+
+func TestRecordHash(t *testing.T) {
+	a, _ := Record(Col("a", Text), Col("b", Text))([]interface{}{"x", nil})
+	b, _ := Record(Col("b", Text), Col("a", Text))([]interface{}{nil, "x"})
+	c, _ := Record(Col("a", Text), Col("b", Text))([]interface{}{"x", ""})
+	ha, hb, hc := a.(RecordValue).Hash(), b.(RecordValue).Hash(), c.(RecordValue).Hash()
+	if ha != hb {
+		t.Errorf("expected hash to not depend on column order")
+	}
+	if ha == hc {
+		t.Errorf("expected NULL to hash differently to an empty string")
+	}
+}
+
+func TestHStoreRoundTrip(t *testing.T) {
+	v, err := HStore([]byte(`"a\"b"=>"x, y", c => NULL, "d"=>"NULL", "e\\"=>""`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `"a\"b"=>"x, y","c"=>NULL,"d"=>"NULL","e\\"=>""`
+	if v.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, v)
+	}
+	if !v.(MapValue).ValueBy("c").IsNull() || v.(MapValue).ValueBy("d").IsNull() {
+		t.Errorf("expected only the unquoted NULL to be NULL")
+	}
+	if _, err = HStore([]byte(`"a"=>"b`)); err == nil {
+		t.Errorf("expected unterminated quote to return an error")
+	}
+	// any map of strings must survive encoding and parsing
+	roundTrip := func(m map[string]string, nulls []string) bool {
+		in := make(map[string]*string)
+		for key, val := range m {
+			val := val
+			in[key] = &val
+		}
+		for _, key := range nulls {
+			in[key] = nil
+		}
+		v, err := HStore(in)
+		if err != nil {
+			return false
+		}
+		b, err := v.(*pgHStore).bytes()
+		if err != nil {
+			return false
+		}
+		out, err := parseHStore(b)
+		if err != nil || len(out) != len(in) {
+			return false
+		}
+		for key, val := range in {
+			got, ok := out[key]
+			if !ok || (val == nil) != (got == nil) || (val != nil && *val != *got) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordSnapshot(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", nil, []interface{}{"a", "b,c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := v.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("name", "alice")
+	v.Set("age", 30)
+	err = v.RestoreSnapshot(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("name") != "bob" || !v.ValueBy("age").IsNull() || v.ValueBy("tags").String() != `{"a","b,c"}` {
+		t.Errorf("expected snapshot to be restored got: %v", v.Val())
+	}
+	other := &Relation{Name: "other", k: rel.k, cols: rel.cols}
+	w, _ := other.New(nil)
+	if w.RestoreSnapshot(snap) == nil {
+		t.Errorf("expected restoring into a different relation to fail")
+	}
+	if v.RestoreSnapshot([]byte(`{"version":99,"cols":[]}`)) == nil {
+		t.Errorf("expected an unknown version to fail")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", nil, []interface{}{"a", "b,c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same columns in a different order plus a new one
+	cols := []*col{rel.cols[3], rel.cols[1], Col("nick", Text, Default("none")), rel.cols[0], rel.cols[2]}
+	moved := &Relation{Name: "person", k: Record(cols...), cols: cols}
+	if moved.Fingerprint() == rel.Fingerprint() {
+		t.Errorf("expected adding a column to change the fingerprint")
+	}
+	reordered := &Relation{Name: "person", k: Record(cols[0], cols[1], cols[3], cols[4]), cols: []*col{cols[0], cols[1], cols[3], cols[4]}}
+	if reordered.Fingerprint() != rel.Fingerprint() {
+		t.Errorf("expected the fingerprint not to depend on column order")
+	}
+	w, err := Decode(moved, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.IsNull() || w.Get("id") != int64(1) || w.Get("name") != "bob" || !w.ValueBy("age").IsNull() ||
+		w.ValueBy("tags").String() != `{"a","b,c"}` || w.Get("nick") != "none" {
+		t.Errorf("unexpected decoded record: %v", w.Val())
+	}
+	narrow := &Relation{Name: "person", k: Record(rel.cols[0]), cols: rel.cols[:1]}
+	if _, err := Decode(narrow, b); err == nil {
+		t.Errorf("expected decoding a column the relation does not have to fail")
+	}
+	other := &Relation{Name: "other", k: rel.k, cols: rel.cols}
+	if _, err := Decode(other, b); err == nil {
+		t.Errorf("expected decoding into a different relation to fail")
+	}
+	if _, err := Decode(rel, []byte(`{"version":99,"relation":"person"}`)); err == nil {
+		t.Errorf("expected an unknown version to fail")
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	v, err := JSON(`{"a": {"b": [{"c": "x"}, 12345678901234567890]}, "d": null, "e": "<&>"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := v.(JSONValue)
+	if s, err := j.GetString("a.b[0].c"); err != nil || s != "x" {
+		t.Errorf("expected a.b[0].c to be x got: %q %v", s, err)
+	}
+	child, err := j.Path("a.b[1]")
+	if err != nil || child.String() != "12345678901234567890" {
+		t.Errorf("expected large number to keep its precision got: %v %v", child, err)
+	}
+	child, err = j.Path("e")
+	if err != nil || child.String() != `"<&>"` {
+		t.Errorf("expected html not to be escaped got: %v %v", child, err)
+	}
+	child, err = j.Path("d")
+	if err != nil || !child.IsNull() {
+		t.Errorf("expected json null to be a NULL Value got: %v %v", child, err)
+	}
+	if !j.Exists("d") || j.Exists("a.b[2]") || j.Exists("a.x") || j.Exists("a[0]") {
+		t.Errorf("unexpected result from Exists")
+	}
+	for _, path := range []string{"a..b", "a.b[x]", "a.b[-1]", "a.b[0"} {
+		if _, err = j.Path(path); err == nil {
+			t.Errorf("expected invalid path %s to return an error", path)
+		}
+	}
+	if _, err = JSON("{"); err == nil {
+		t.Errorf("expected invalid json to return an error")
+	}
+}
+
+func TestArrayDims(t *testing.T) {
+	v, err := Array(Int)("{{1,2,3},{4,5,6}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := v.(ArrayValue)
+	if d := a.Dims(); len(d) != 2 || a.Len(1) != 2 || a.Len(2) != 3 || a.Len(3) != 0 {
+		t.Errorf("expected dims [2 3] got: %v", d)
+	}
+	if n := a.ValueAt(1).(ArrayValue).ValueAt(2).Val(); n != int64(6) {
+		t.Errorf("expected [2][3] to be 6 got: %v", n)
+	}
+	if v.String() != "{{1,2,3},{4,5,6}}" {
+		t.Errorf("unexpected encoding: %s", v)
+	}
+	// nested slices build sub-arrays too
+	v, err = Array(Int)([]interface{}{[]interface{}{1}, []interface{}{2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Value(); err == nil {
+		t.Errorf("expected ragged array to fail to encode")
+	}
+	// a quoted element is not a sub-array
+	v, err = Array(Text)(`{"{a}",b}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := v.(ArrayValue).Dims(); len(d) != 1 || v.(ArrayValue).ValueAt(0).String() != "{a}" {
+		t.Errorf("expected a one dimensional text array got: %v", d)
+	}
+	// explicit lower bounds survive a round trip
+	v, err = Array(Int)("[2:4]={1,2,3}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(ArrayValue).Lower(1) != 2 || v.String() != "[2:4]={1,2,3}" {
+		t.Errorf("expected lower bound of 2 got: %s", v)
+	}
+	if _, err = Array(Int)("[1:2][1:2]={1,2}"); err == nil {
+		t.Errorf("expected mismatched bounds to return an error")
+	}
+}
+
+func TestRecordNameMatch(t *testing.T) {
+	cols := []*col{Col("user_id", Integer), Col("Name", Text), Col("name", Text), Col("email", Text)}
+	db := &DB{}
+	rel := &Relation{Name: "account", db: db, k: Record(cols...), cols: cols}
+	v, err := rel.New([]interface{}{1, "A", "a", "x@y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ValueBy("userId") != nil || v.ValueBy("EMAIL") != nil {
+		t.Errorf("expected only exact matches by default")
+	}
+	db.SetNameMatch(MatchCaseInsensitive | MatchSnakeCamel)
+	if v.Get("userId") != int64(1) || v.Get("UserID") != int64(1) || v.Get("EMAIL") != "x@y" {
+		t.Errorf("expected inexact names to resolve")
+	}
+	if v.Get("Name") != "A" || v.Get("name") != "a" {
+		t.Errorf("expected exact matches to win")
+	}
+	if v.ValueBy("NAME") != nil {
+		t.Errorf("expected an ambiguous name to not resolve")
+	}
+	db.SetNameMatch(MatchSnakeCamel)
+	if v.Set("userId", 2) != nil || v.Get("user_id") != int64(2) {
+		t.Errorf("expected Set to resolve camelCase names")
+	}
+}
+
+func TestRecordAlias(t *testing.T) {
+	cols := []*col{Col("user_id", Integer).As("userId"), Col("doc", JSON), Col("name", Text)}
+	rel := &Relation{Name: "account", k: Record(cols...), cols: cols}
+	v, err := rel.New([]interface{}{1, `{"a":[1]}`, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rel.SetAlias("name", "userId"); err == nil {
+		t.Errorf("expected clashing alias to return an error")
+	}
+	if err = rel.SetAlias("name", "displayName"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"userId":1,"doc":{"a":[1]},"displayName":null}` {
+		t.Errorf("unexpected json: %s", b)
+	}
+	if _, ok := v.FieldMap()["userId"]; !ok || v.Get("userId") != int64(1) {
+		t.Errorf("expected aliases to resolve")
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	v, err := testRelation().New([]interface{}{1, nil, 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.GetOr("name", "anon") != "anon" || v.GetOr("age", 0) != int64(20) || v.GetOr("missing", "x") != "x" {
+		t.Errorf("unexpected GetOr results")
+	}
+	if v.ValueBy("tags").ValOr("none") != "none" {
+		t.Errorf("expected ValOr to return fallback for NULL")
+	}
+}
+
+func TestClone(t *testing.T) {
+	v, err := testRelation().New([]interface{}{1, "bob", 20, []interface{}{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := v.Clone().(RecordValue)
+	c.Set("name", "alice")
+	c.ValueBy("tags").(IteratorValue).ValueAt(0).Scan("b")
+	if v.Get("name") != "bob" || v.ValueBy("tags").String() != `{"a"}` {
+		t.Errorf("expected clone to be independent of original got: %v", v.Val())
+	}
+	if c.Relation() != v.Relation() {
+		t.Errorf("expected clone to keep its Relation")
+	}
+	h, _ := HStore(map[string]string{"k": "v"})
+	hc := h.Clone().(MapValue)
+	hc.Set("k", "x")
+	if h.(MapValue).Get("k") != "v" {
+		t.Errorf("expected hstore clone to be independent")
+	}
+	b, _ := Bytes([]byte("abc"))
+	bc := b.Clone()
+	bc.Val().([]byte)[0] = 'x'
+	if b.String() != "abc" {
+		t.Errorf("expected bytea clone to not share memory")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	pairs := []struct {
+		a, b Value
+		eq   bool
+	}{
+		{MustText("a"), MustText("a"), true},
+		{MustText("a"), MustText(nil), false},
+		{MustText(nil), MustText(nil), true},
+		{MustText("1"), MustInteger(1), false},
+		{Must(Numeric(10, 2)("1.0")), Must(Numeric(10, 2)("1.00")), true},
+		{Must(Bytes([]byte{0, 1})), Must(Bytes([]byte{0, 2})), false},
+		{Must(Interval("1 day")), Must(Interval("24:00:00")), true},
+		{MustTimestamp(time.Unix(0, 1)), MustTimestamp(time.Unix(0, 1)), true},
+		{MustTimestamp(time.Unix(0, 1)), MustTimestamp(time.Unix(0, 2)), false},
+		{Must(Array(Int)("{{1,2},{3,4}}")), Must(Array(Int)("{{1,2},{3,4}}")), true},
+		{Must(Array(Int)("{1,2}")), Must(Array(Int)("[0:1]={1,2}")), false},
+		{Must(HStore(`a=>1, b=>NULL`)), Must(HStore(`b=>NULL, a=>1`)), true},
+		{Must(Row(Int, Text)([]interface{}{1, "x"})), Must(Row(Int, Text)([]interface{}{1, "y"})), false},
+		{Must(JSON(`{"a": 1, "b": [true]}`)), Must(JSON(`{"b":[true],"a":1}`)), true},
+	}
+	for i, p := range pairs {
+		if p.a.Equal(p.b) != p.eq || p.b.Equal(p.a) != p.eq {
+			t.Errorf("#%d expected %v = %v to be %v", i, p.a, p.b, p.eq)
+		}
+	}
+	a, _ := testRelation().New([]interface{}{1, "bob", nil, []interface{}{"x"}})
+	if !a.Equal(a.Clone()) {
+		t.Errorf("expected record to equal its clone")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b Value
+		c    int
+	}{
+		{MustInteger(1), MustInteger(2), -1},
+		{MustInteger(2), MustInteger(nil), -1},
+		{MustInteger(nil), MustInteger(nil), 0},
+		{MustText("b"), MustText("a"), 1},
+		{Must(Numeric(10, 2)("10.5")), Must(Numeric(10, 2)("9.75")), 1},
+		{Must(Numeric(10, 2)("NaN")), Must(Numeric(10, 2)("1")), 1},
+		{MustDouble(math.NaN()), MustDouble(math.Inf(1)), 1},
+		{Must(Interval("1 mon")), Must(Interval("31 days")), -1},
+	}
+	for i, c := range cases {
+		n, err := c.a.(OrderedValue).Compare(c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != c.c {
+			t.Errorf("#%d expected Compare(%v, %v) to be %d got %d", i, c.a, c.b, c.c, n)
+		}
+	}
+	if _, err := MustInteger(1).(OrderedValue).Compare(MustText("1")); err == nil {
+		t.Errorf("expected comparing different kinds to return an error")
+	}
+}
+
+func TestCivilTimes(t *testing.T) {
+	type civilDate struct {
+		Year  int
+		Month time.Month
+		Day   int
+	}
+	type civilClock struct {
+		Hour, Minute, Second, Nanosecond int
+	}
+	type civilDateTime struct {
+		Date civilDate
+		Time civilClock
+	}
+	v, err := Date(civilDate{2011, time.March, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "2011-03-04" {
+		t.Errorf("expected date from civil date got: %s", v)
+	}
+	v, err = Timestamp(&civilDateTime{civilDate{2011, time.March, 4}, civilClock{5, 6, 7, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Val().(time.Time).Equal(time.Date(2011, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Errorf("expected timestamp from civil datetime got: %s", v)
+	}
+	if _, err = Date(struct{ Year int }{2011}); err == nil {
+		t.Errorf("expected a struct without Month and Day to fail")
+	}
+	d := 90 * time.Minute
+	v, err = Interval(&d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(DurationValue).Duration() != d {
+		t.Errorf("expected interval from *time.Duration got: %s", v)
+	}
+	var nilDuration *time.Duration
+	if v, _ = Interval(nilDuration); !v.IsNull() {
+		t.Errorf("expected nil *time.Duration to be NULL")
+	}
+}
+
+func TestNullElements(t *testing.T) {
+	v, _ := Array(Text)([]interface{}{"a", nil})
+	if v.String() != `{"a",NULL}` {
+		t.Errorf("expected NULL array element to be unquoted got: %s", v)
+	}
+	v, _ = Row(Text, Int, Text)([]interface{}{nil, nil, "NULL"})
+	if v.String() != `(,,"NULL")` {
+		t.Errorf("expected NULL row fields to be empty got: %s", v)
+	}
+}
+
+func TestSplitNulls(t *testing.T) {
+	v, err := Row(Int, Text, Text, Text)([]byte(`(1,,"",)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := v.(IteratorValue)
+	if r.ValueAt(0).Val() != int64(1) || !r.ValueAt(1).IsNull() || r.ValueAt(2).IsNull() || !r.ValueAt(3).IsNull() {
+		t.Errorf("expected empty row fields to be NULL got: %v", r.Val())
+	}
+	v, err = Array(Text)([]byte(`{a,NULL,"NULL"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := v.(IteratorValue)
+	if len(a.Values()) != 3 || !a.ValueAt(1).IsNull() || a.ValueAt(2).String() != "NULL" {
+		t.Errorf("expected only unquoted NULL to be NULL got: %v", a.Val())
+	}
+	// what we encode we can decode
+	v, _ = Row(Int, Text, Array(Text))([]interface{}{nil, "x", []interface{}{nil, "y"}})
+	w, err := Row(Int, Text, Array(Text))(v.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Equal(w) {
+		t.Errorf("expected %s to round trip got: %s", v, w)
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	const oid = 990001
+	defer func() {
+		typsMu.Lock()
+		delete(typs, oid)
+		typsMu.Unlock()
+	}()
+	RegisterType(oid, func(args ...string) (ToValue, error) {
+		vs, err := argsToInts(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return Char(vs[0]), nil
+	})
+	k, err := (&DB{}).kind(oid, "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := k("ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "ab " {
+		t.Errorf("expected registered Char(3) to pad the value got: %q", v.String())
+	}
+	if _, err := (&DB{}).kind(oid); err == nil {
+		t.Errorf("expected factory error to be returned")
+	}
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// cached result of SHOW server_version_num
+type serverVersion struct {
+	once sync.Once
+	num  int
+	err  error
+}
+
+// A server feature that is only available in some Postgres versions
+type Feature int
+
+const (
+	FeatureOnConflict     Feature = iota // INSERT .. ON CONFLICT
+	FeatureSkipLocked                    // FOR UPDATE .. SKIP LOCKED
+	FeatureMultirange                    // multirange types (for callers to check with Supports)
+	FeatureMerge                         // MERGE
+	FeatureMergeReturning                // MERGE .. RETURNING
+)
+
+// the first server_version_num to support each Feature
+var featureVersions = map[Feature]int{
+	FeatureOnConflict:     90500,
+	FeatureSkipLocked:     90500,
+	FeatureMultirange:     140000,
+	FeatureMerge:          150000,
+	FeatureMergeReturning: 170000,
+}
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureOnConflict:
+		return "ON CONFLICT"
+	case FeatureSkipLocked:
+		return "SKIP LOCKED"
+	case FeatureMultirange:
+		return "multirange types"
+	case FeatureMerge:
+		return "MERGE"
+	case FeatureMergeReturning:
+		return "MERGE .. RETURNING"
+	}
+	return fmt.Sprintf("Feature(%d)", int(f))
+}
+
+// ErrUnsupported is returned (wrapped) when an operation needs
+// a newer server. Check for it with errors.Is
+var ErrUnsupported = errors.New("unsupported by server")
+
+// format a server_version_num ie 90605 -> 9.6, 150002 -> 15
+func versionString(n int) string {
+	if n < 100000 {
+		return fmt.Sprintf("%d.%d", n/10000, n/100%100)
+	}
+	return strconv.Itoa(n / 10000)
+}
+
+// Return the server version as reported by server_version_num
+// ie 150002 for 15.2 or 90605 for 9.6.5. The result is cached
+func (db *DB) ServerVersion() (int, error) {
+	db.version.once.Do(func() {
+		var s string
+		err := db.scanRow([]interface{}{&s}, `SHOW server_version_num`)
+		if err != nil {
+			db.version.err = err
+			return
+		}
+		db.version.num, db.version.err = strconv.Atoi(s)
+	})
+	return db.version.num, db.version.err
+}
+
+// Reports whether the server supports f
+func (db *DB) Supports(f Feature) (bool, error) {
+	n, err := db.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	return n >= featureVersions[f], nil
+}
+
+// return an error wrapping ErrUnsupported if the server does not support f
+func (db *DB) require(f Feature) error {
+	ok, err := db.Supports(f)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s requires Postgres >= %s", ErrUnsupported, f, versionString(featureVersions[f]))
+	}
+	return nil
+}
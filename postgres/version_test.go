@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+)
+
+// a DB that reports server version n without connecting
+func versionDB(n int) *DB {
+	db := new(DB)
+	db.version.once.Do(func() { db.version.num = n })
+	return db
+}
+
+func TestSupports(t *testing.T) {
+	db := versionDB(140005)
+	if ok, _ := db.Supports(FeatureMultirange); !ok {
+		t.Errorf("expected 14 to support multirange")
+	}
+	err := db.require(FeatureMerge)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported got: %v", err)
+	}
+	if err.Error() != "unsupported by server: MERGE requires Postgres >= 15" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if s := versionString(90500); s != "9.5" {
+		t.Errorf("expected 9.5 got: %s", s)
+	}
+}
+
+func TestSkipLockedRequiresVersion(t *testing.T) {
+	rel := testRelation()
+	rel.db = versionDB(90400)
+	q := (&Query{from: rel}).ForUpdate(SkipLocked)
+	if !errors.Is(q.err, ErrUnsupported) {
+		t.Errorf("expected SKIP LOCKED to be refused on 9.4 got: %v", q.err)
+	}
+	rel.db = versionDB(90500)
+	if q = (&Query{from: rel}).ForUpdate(SkipLocked); q.err != nil {
+		t.Errorf("expected SKIP LOCKED on 9.5 got: %v", q.err)
+	}
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// keeps track of open transactions started from a DB
+// and reports any that stay open longer than max
+type txWatchdog struct {
+	mu       sync.Mutex
+	max      time.Duration
+	handler  func(tx *Tx, age time.Duration)
+	active   map[*Tx]time.Time // tx -> time it was started
+	reported map[*Tx]bool      // so each tx is only reported once
+	stop     chan struct{}
+}
+
+// Watch transactions started from this DB (including via Conn) and call
+// handler once for each transaction that has been open longer than max
+// without a Commit or Rollback. The handler may Rollback the Tx to cancel it.
+// If handler is nil the transaction is logged. Should be called before
+// the DB is shared between goroutines
+func (db *DB) WatchTransactions(max time.Duration, handler func(tx *Tx, age time.Duration)) {
+	db.StopWatchingTransactions()
+	if handler == nil {
+		handler = logLongTx
+	}
+	w := &txWatchdog{
+		max:      max,
+		handler:  handler,
+		active:   make(map[*Tx]time.Time),
+		reported: make(map[*Tx]bool),
+		stop:     make(chan struct{}),
+	}
+	db.mu.Lock()
+	db.watchdog = w
+	db.mu.Unlock()
+	go w.run()
+}
+
+// Stop the watchdog started by WatchTransactions (if any)
+func (db *DB) StopWatchingTransactions() {
+	db.mu.Lock()
+	w := db.watchdog
+	db.watchdog = nil
+	db.mu.Unlock()
+	if w != nil {
+		close(w.stop)
+	}
+}
+
+// the running watchdog (if any)
+func (db *DB) txWatchdog() *txWatchdog {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.watchdog
+}
+
+func logLongTx(tx *Tx, age time.Duration) {
+	log.Printf("postgres: transaction open for %s without Commit or Rollback", age)
+}
+
+func (w *txWatchdog) track(tx *Tx) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active[tx] = time.Now()
+}
+
+func (w *txWatchdog) untrack(tx *Tx) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.active, tx)
+	delete(w.reported, tx)
+}
+
+func (w *txWatchdog) run() {
+	interval := w.max / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-tick.C:
+			w.check(now)
+		}
+	}
+}
+
+// call the handler for each newly overdue tx
+// the handler is called without holding the lock so it can Rollback
+func (w *txWatchdog) check(now time.Time) {
+	type overdue struct {
+		tx  *Tx
+		age time.Duration
+	}
+	late := make([]overdue, 0)
+	w.mu.Lock()
+	for tx, started := range w.active {
+		age := now.Sub(started)
+		if age > w.max && !w.reported[tx] {
+			w.reported[tx] = true
+			late = append(late, overdue{tx, age})
+		}
+	}
+	w.mu.Unlock()
+	for _, o := range late {
+		w.handler(o.tx, o.age)
+	}
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// version of the envelope written by Encode
+const wireVersion = 1
+
+type wireRecord struct {
+	Version     int           `json:"version"`
+	Relation    string        `json:"relation"`
+	Fingerprint string        `json:"fingerprint"`
+	Cols        []snapshotCol `json:"cols"`
+}
+
+// Return a hex sha256 of the relation's column names, types and primary
+// key. It does not depend on the order of the columns so only changes
+// when columns are added, dropped, renamed or change type
+func (r *Relation) Fingerprint() string {
+	lines := make([]string, len(r.cols))
+	for i, c := range r.cols {
+		lines[i] = fmt.Sprintf("%s %s %t", c.name, c.typ, c.pk)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", r.Name)
+	for _, l := range lines {
+		fmt.Fprintf(h, "%s\n", l)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Encode returns a versioned JSON encoding of the record with its
+// relation name, the relation's Fingerprint and each column by name, so
+// it can be put on a message queue and decoded by another service with
+// Decode even if the columns are in a different order there
+func Encode(v RecordValue) ([]byte, error) {
+	rel := v.Relation()
+	if rel == nil {
+		return nil, errors.New("RecordValue does not have a relation set")
+	}
+	if v.IsNull() {
+		return nil, fmt.Errorf("cannot encode a NULL %s record", rel.Name)
+	}
+	w := wireRecord{
+		Version:     wireVersion,
+		Relation:    rel.Name,
+		Fingerprint: rel.Fingerprint(),
+		Cols:        make([]snapshotCol, 0, len(rel.cols)),
+	}
+	for _, c := range rel.cols {
+		cv := v.ValueBy(c.name)
+		if cv == nil {
+			return nil, fmt.Errorf("cannot encode %s record: no column %s", rel.Name, c.name)
+		}
+		dv, err := cv.Value()
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode column %s: %v", c.name, err)
+		}
+		wc, err := encodeSnapshotCol(c.name, dv)
+		if err != nil {
+			return nil, err
+		}
+		w.Cols = append(w.Cols, wc)
+	}
+	return json.Marshal(w)
+}
+
+// Decode returns a new RecordValue for rel from the output of Encode.
+// Columns are matched by name. If the encoding was made against a
+// different Fingerprint it is an error for it to have a column rel does
+// not, while columns missing from it are filled in as by rel.New(nil)
+func Decode(rel *Relation, b []byte) (RecordValue, error) {
+	w, err := readWire(b)
+	if err != nil {
+		return nil, err
+	}
+	if w.Relation != rel.Name {
+		return nil, fmt.Errorf("cannot decode %s record as %s", w.Relation, rel.Name)
+	}
+	v, err := rel.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, wc := range w.Cols {
+		cv := v.ValueBy(wc.Name)
+		if cv == nil {
+			return nil, fmt.Errorf("cannot decode %s record: no column %s (encoded with fingerprint %s have %s)",
+				rel.Name, wc.Name, w.Fingerprint, rel.Fingerprint())
+		}
+		src, err := wc.decode()
+		if err != nil {
+			return nil, err
+		}
+		err = cv.Scan(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode column %s: %v", wc.Name, err)
+		}
+	}
+	setNotNull(v)
+	return v, nil
+}
+
+// Decode the output of Encode using the relation named in it
+func (db *DB) Decode(b []byte) (RecordValue, error) {
+	w, err := readWire(b)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := db.Relation(w.Relation)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(rel, b)
+}
+
+func readWire(b []byte) (*wireRecord, error) {
+	w := new(wireRecord)
+	err := json.Unmarshal(b, w)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoded record: %v", err)
+	}
+	if w.Version != wireVersion {
+		return nil, fmt.Errorf("unsupported encoded record version %d", w.Version)
+	}
+	return w, nil
+}
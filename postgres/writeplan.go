@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// writePlan is the single description of which columns an INSERT,
+// UPDATE or DELETE writes, how they are bound and the order their
+// args are passed in so the SQL and the args can't drift apart.
+// set columns are bound as $1..$n followed by the key columns
+type writePlan struct {
+	rel   *Relation
+	set   []*col       // columns written (INSERT values or UPDATE SET)
+	key   []*col       // columns matched in the WHERE (UPDATE and DELETE)
+	ret   []*col       // columns re-read via RETURNING
+	match identityKind // how rows are identified (see Identity)
+}
+
+// plan an INSERT of v. Generated columns, columns not loaded and
+// columns New left to a default expression are never written and
+// primary key columns are omitted when NULL so their default applies.
+// Other NULLs are written as given
+func (r *Relation) insertPlan(v RecordValue) *writePlan {
+	p := &writePlan{rel: r, ret: r.refreshCols(r.refreshInsert), match: r.identity.kind}
+	for _, c := range r.cols {
+		if c.generated || !v.Loaded(c.name) || isDefaulted(v, c.name) {
+			continue
+		}
+		if c.pk {
+			if cv := v.ValueBy(c.name); cv == nil || cv.IsNull() {
+				continue
+			}
+		}
+		p.set = append(p.set, c)
+	}
+	return p
+}
+
+// plan an UPDATE setting every writable column that
+// is not part of the primary key or the row identity
+func (r *Relation) updatePlan() (*writePlan, error) {
+	if r.identity.kind == identityAll {
+		return nil, fmt.Errorf("cannot Update %s: rows identified by all columns can only be Deleted", r.Name)
+	}
+	p, err := r.deletePlan()
+	if err != nil {
+		return nil, err
+	}
+	p.ret = r.refreshCols(r.refreshUpdate)
+	for _, c := range r.cols {
+		if !c.pk && !c.generated && !p.isKey(c) {
+			p.set = append(p.set, c)
+		}
+	}
+	return p, nil
+}
+
+// plan a DELETE matching rows by the relation's Identity
+func (r *Relation) deletePlan() (*writePlan, error) {
+	p := &writePlan{rel: r, match: r.identity.kind}
+	switch r.identity.kind {
+	case identityPK:
+		p.key = r.pks()
+		if len(p.key) == 0 {
+			return nil, errors.New("Relation must have a primary key to use Update or Delete")
+		}
+	case identityCols:
+		for _, name := range r.identity.cols {
+			p.key = append(p.key, r.col(name))
+		}
+	case identityAll:
+		p.key = r.cols
+	}
+	return p, nil
+}
+
+// remove the columns that were not loaded into v (see Query.Select)
+// so a partial record does not overwrite them with NULL
+func (p *writePlan) loaded(v RecordValue) *writePlan {
+	if !v.IsPartial() {
+		return p
+	}
+	var names []string
+	for _, c := range p.set {
+		if !v.Loaded(c.name) {
+			names = append(names, c.name)
+		}
+	}
+	return p.omit(names...)
+}
+
+func (p *writePlan) isKey(c *col) bool {
+	for _, k := range p.key {
+		if k == c {
+			return true
+		}
+	}
+	return false
+}
+
+// remove the named columns from the set columns
+func (p *writePlan) omit(names ...string) *writePlan {
+	set := make([]*col, 0, len(p.set))
+outer:
+	for _, c := range p.set {
+		for _, name := range names {
+			if c.name == name {
+				continue outer
+			}
+		}
+		set = append(set, c)
+	}
+	return &writePlan{rel: p.rel, set: set, key: p.key, ret: p.ret, match: p.match}
+}
+
+// placeholder for the nth arg cast to the column's type
+func (p *writePlan) bind(c *col, n int) string {
+	if c.typ != "" {
+		return fmt.Sprintf("cast($%d as %s)", n, c.typ)
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+func (p *writePlan) names() string {
+	names := make([]string, len(p.set))
+	for i, c := range p.set {
+		names[i] = c.name
+	}
+	return strings.Join(names, ",")
+}
+
+// the WHERE expression identifying the row
+func (p *writePlan) where() string {
+	n := len(p.set)
+	if p.match == identityCtid {
+		return fmt.Sprintf("ctid = cast($%d as tid)", n+1)
+	}
+	op := "="
+	if p.match != identityPK {
+		op = "IS NOT DISTINCT FROM"
+	}
+	ss := make([]string, len(p.key))
+	for i, c := range p.key {
+		ss[i] = fmt.Sprintf("%s %s %s", c.name, op, p.bind(c, n+i+1))
+	}
+	w := strings.Join(ss, " AND ")
+	if p.match == identityAll {
+		// only target one of any duplicate rows
+		return fmt.Sprintf("ctid = (SELECT ctid FROM %s WHERE %s LIMIT 1)", p.rel.Name, w)
+	}
+	return w
+}
+
+// the RETURNING clause (if anything is to be re-read)
+// ctid is always returned when it identifies rows
+func (p *writePlan) returning() string {
+	names := make([]string, 0, len(p.ret)+1)
+	for _, c := range p.ret {
+		names = append(names, c.name)
+	}
+	if p.match == identityCtid {
+		names = append(names, "ctid")
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " RETURNING " + strings.Join(names, ",")
+}
+
+func (p *writePlan) insertSql() string {
+	if len(p.set) == 0 {
+		return fmt.Sprintf(`INSERT INTO %s DEFAULT VALUES%s`,
+			p.rel.Name, p.returning())
+	}
+	bnds := make([]string, len(p.set))
+	for i, c := range p.set {
+		bnds[i] = p.bind(c, i+1)
+	}
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)%s`,
+		p.rel.Name,
+		p.names(),
+		strings.Join(bnds, ","),
+		p.returning())
+}
+
+func (p *writePlan) updateSql() string {
+	sets := make([]string, len(p.set))
+	for i, c := range p.set {
+		sets[i] = fmt.Sprintf("%s = %s", c.name, p.bind(c, i+1))
+	}
+	return fmt.Sprintf(`UPDATE %s SET %s WHERE %s%s`,
+		p.rel.Name,
+		strings.Join(sets, ","),
+		p.where(),
+		p.returning())
+}
+
+func (p *writePlan) deleteSql() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE %s`, p.rel.Name, p.where())
+}
+
+// args for v in the order the plan binds them
+func (p *writePlan) args(v RecordValue) []interface{} {
+	args := make([]interface{}, 0, len(p.set)+len(p.key))
+	for _, c := range p.set {
+		args = append(args, v.ValueBy(c.name))
+	}
+	for _, c := range p.key {
+		args = append(args, v.ValueBy(c.name))
+	}
+	return args
+}
+
+// scan the RETURNING columns into v and the row's ctid (if returned)
+func (p *writePlan) scan(rs *Rows, v RecordValue, ctid *string) error {
+	vals := make([]interface{}, len(p.ret), len(p.ret)+1)
+	for i, c := range p.ret {
+		vals[i] = v.ValueBy(c.name)
+	}
+	if p.match == identityCtid {
+		vals = append(vals, ctid)
+	}
+	return rs.Scan(vals...)
+}
@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+// a join table with a composite primary key and a generated column
+func testMembership() *Relation {
+	cols := []*col{
+		Col("person_id", BigInt),
+		Col("team_id", BigInt),
+		Col("role", Text),
+		Col("label", Text),
+	}
+	cols[0].pk = true
+	cols[1].pk = true
+	cols[3].generated = true
+	return &Relation{Name: "membership", k: Record(cols...), cols: cols}
+}
+
+func TestInsertPlan(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{nil, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := rel.insertPlan(v)
+	expected := `INSERT INTO person (name,age,tags) VALUES ($1,$2,$3) RETURNING id,name,age,tags`
+	if s := p.insertSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if args := p.args(v); len(args) != 3 || args[0].(Value).Val() != "bob" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	rel = testMembership()
+	v, err = rel.New([]interface{}{1, 2, "owner", nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = rel.insertPlan(v)
+	expected = `INSERT INTO membership (person_id,team_id,role) VALUES ($1,$2,$3) RETURNING person_id,team_id,role,label`
+	if s := p.insertSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	expected = `INSERT INTO membership (person_id,team_id) VALUES ($1,$2) RETURNING person_id,team_id,role,label`
+	if s := p.omit("role").insertSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+}
+
+func TestUpdatePlan(t *testing.T) {
+	rel := testMembership()
+	v, err := rel.New([]interface{}{1, 2, "owner", nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `UPDATE membership SET role = $1 WHERE person_id = $2 AND team_id = $3 RETURNING person_id,team_id,role,label`
+	if s := p.updateSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	args := p.args(v)
+	if len(args) != 3 || args[0].(Value).Val() != "owner" || args[2].(Value).Val().(int64) != 2 {
+		t.Errorf("unexpected args: %v", args)
+	}
+	p, err = rel.deletePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `DELETE FROM membership WHERE person_id = $1 AND team_id = $2`
+	if s := p.deleteSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if rel.pk() != nil {
+		t.Errorf("expected pk() to be nil for a composite primary key")
+	}
+	rel.cols[0].pk, rel.cols[1].pk = false, false
+	if _, err = rel.updatePlan(); err == nil {
+		t.Errorf("expected relation without a primary key to return an error")
+	}
+}
+
+func TestRefreshAfterWrite(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{nil, "bob", 20, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rel.RefreshAfterWrite(RefreshCols("id"), RefreshNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `INSERT INTO person (name,age,tags) VALUES ($1,$2,$3) RETURNING id`
+	if s := rel.insertPlan(v).insertSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `UPDATE person SET name = $1,age = $2,tags = $3 WHERE id = $4`
+	if s := p.updateSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if err = rel.RefreshAfterWrite(RefreshCols("nope"), RefreshAll); err == nil {
+		t.Errorf("expected unknown column to return an error")
+	}
+}
+
+func TestIdentityPlans(t *testing.T) {
+	rel := testMembership()
+	rel.cols[0].pk, rel.cols[1].pk = false, false
+	err := rel.SetIdentity(IdentityColumns("person_id", "team_id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `UPDATE membership SET role = $1 WHERE person_id IS NOT DISTINCT FROM $2 AND team_id IS NOT DISTINCT FROM $3 RETURNING person_id,team_id,role,label`
+	if s := p.updateSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	err = rel.SetIdentity(IdentityAllColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rel.updatePlan(); err == nil {
+		t.Errorf("expected Update with IdentityAllColumns to return an error")
+	}
+	p, err = rel.deletePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `DELETE FROM membership WHERE ctid = (SELECT ctid FROM membership WHERE person_id IS NOT DISTINCT FROM $1 AND team_id IS NOT DISTINCT FROM $2 AND role IS NOT DISTINCT FROM $3 AND label IS NOT DISTINCT FROM $4 LIMIT 1)`
+	if s := p.deleteSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	err = rel.SetIdentity(IdentityCtid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `UPDATE membership SET person_id = $1,team_id = $2,role = $3 WHERE ctid = cast($4 as tid) RETURNING person_id,team_id,role,label,ctid`
+	if s := p.updateSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if err = rel.SetIdentity(IdentityColumns("nope")); err == nil {
+		t.Errorf("expected unknown column to return an error")
+	}
+}
+
+func TestParseDefault(t *testing.T) {
+	for expr, lit := range map[string]string{
+		`0`:                             "0",
+		`(-1)`:                          "-1",
+		`2.5`:                           "2.5",
+		`true`:                          "true",
+		`'active'::text`:                "active",
+		`'it''s'::character varying`:    "it's",
+		`'{}'::text[]`:                  "{}",
+		`'1 day'::interval`:             "1 day",
+		`'x'::character varying(20)`:    "x",
+		`'2020-01-01'::date::timestamp`: "2020-01-01",
+	} {
+		if s, ok := parseDefault(expr); !ok || s != lit {
+			t.Errorf("expected %s to be the literal %q got: %q %v", expr, lit, s, ok)
+		}
+	}
+	for _, expr := range []string{
+		`now()`,
+		`nextval('person_id_seq'::regclass)`,
+		`'a'::text || 'b'::text`,
+		`CURRENT_TIMESTAMP`,
+		`NULL::text`,
+		`1.5e3`,
+	} {
+		if s, ok := parseDefault(expr); ok {
+			t.Errorf("expected %s not to be a literal got: %q", expr, s)
+		}
+	}
+}
+
+func TestInsertOmitsDefaults(t *testing.T) {
+	rel := testRelation()
+	rel.col("age").setDefault(`18`)
+	rel.col("tags").setDefault(`ARRAY[]::text[]`)
+	v, err := rel.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("age") != int64(18) {
+		t.Errorf("expected New to fill in the literal default got: %v", v.Get("age"))
+	}
+	if err := v.Set("name", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	p := rel.insertPlan(v)
+	if names := p.names(); names != "name,age" {
+		t.Errorf("expected id and tags to be left to their defaults got: %s", names)
+	}
+	if err := v.Set("tags", nil); err != nil {
+		t.Fatal(err)
+	}
+	if names := rel.insertPlan(v).names(); names != "name,age,tags" {
+		t.Errorf("expected a NULL Set on a column with a default to be written got: %s", names)
+	}
+	w, err := rel.New([]interface{}{nil, "bob", nil, nil})
+	if err != nil || !w.ValueBy("age").IsNull() {
+		t.Errorf("expected defaults only to be filled in by New(nil)")
+	}
+	if names := rel.insertPlan(w).names(); names != "name,age,tags" {
+		t.Errorf("expected explicit NULLs to be written got: %s", names)
+	}
+}
+
+func TestColOptions(t *testing.T) {
+	rel := NewRelation("account",
+		Col("id", BigInt, PrimaryKey()),
+		Col("owner_id", BigInt, NotNull(), References("person", "id")),
+		Col("status", Text, Default("it's new")),
+	)
+	c := rel.col("owner_id")
+	if !c.notNull || c.refT != "person" || c.refF != "id" {
+		t.Errorf("unexpected column metadata: %+v", c)
+	}
+	if pk := rel.pk(); pk == nil || pk.name != "id" {
+		t.Fatalf("expected id to be the primary key")
+	}
+	if d := rel.col("status").def; d != `'it''s new'` {
+		t.Errorf("expected a quoted default got: %s", d)
+	}
+	v, err := rel.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("status") != "it's new" {
+		t.Errorf("expected New to fill in the default got: %v", v.Get("status"))
+	}
+	if err = v.Set("owner_id", 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := `INSERT INTO account (owner_id,status) VALUES ($1,$2) RETURNING id,owner_id,status`
+	if s := rel.insertPlan(v).insertSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected an invalid default to panic")
+		}
+	}()
+	Col("n", Integer, Default("x"))
+}
+
+func TestPartialRecordPlans(t *testing.T) {
+	rel := testRelation()
+	v, err := rel.New([]interface{}{1, "bob", nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPartial(v, []string{"id", "name"})
+	if !v.IsPartial() || v.Loaded("age") || !v.Loaded("name") {
+		t.Fatalf("expected only id and name to be loaded")
+	}
+	p, err := rel.updatePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `UPDATE person SET name = $1 WHERE id = $2 RETURNING id,name,age,tags`
+	if s := p.loaded(v).updateSql(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if err = v.Set("age", 30); err != nil {
+		t.Fatal(err)
+	}
+	expected = `UPDATE person SET name = $1,age = $2 WHERE id = $3 RETURNING id,name,age,tags`
+	if s := p.loaded(v).updateSql(); s != expected {
+		t.Errorf("expected Set to load the column got:\n%s", s)
+	}
+	if c := v.Clone().(RecordValue); !c.IsPartial() || c.Loaded("tags") {
+		t.Errorf("expected a clone to stay partial")
+	}
+	setPartial(v, []string{"id"})
+	if err = (&Tx{}).Update(v); err == nil || !strings.Contains(err.Error(), "no writable columns") {
+		t.Errorf("expected an Update with nothing to SET to fail got: %v", err)
+	}
+}
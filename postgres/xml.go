@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/xml"
+	"fmt"
+)
+
+// A Value holding an xml document that can be decoded with encoding/xml
+type XMLValue interface {
+	Value
+	Unmarshal(v interface{}) error
+}
+
+// Values can be set from a string, []byte or anything
+// encoding/xml can Marshal
+func XML(data interface{}) (Value, error) {
+	k := new(pgXML)
+	return k, k.Scan(data)
+}
+
+type pgXML struct {
+	b     []byte
+	valid bool
+}
+
+func (k *pgXML) Scan(src interface{}) error {
+	if src == nil {
+		k.valid = false
+		return nil
+	}
+	k.valid = true
+	switch x := src.(type) {
+	case string:
+		k.b = []byte(x)
+	case []byte:
+		k.b = append([]byte(nil), x...)
+	default:
+		b, err := xml.Marshal(src)
+		if err != nil {
+			return fmt.Errorf("cannot set XML value with %T -> %v: %v", src, src, err)
+		}
+		k.b = b
+	}
+	return nil
+}
+
+// decode the document into v using encoding/xml
+func (k *pgXML) Unmarshal(v interface{}) error {
+	if !k.valid {
+		return fmt.Errorf("cannot Unmarshal NULL XML value")
+	}
+	return xml.Unmarshal(k.b, v)
+}
+
+func (k *pgXML) IsNull() bool {
+	return !k.valid
+}
+
+func (k *pgXML) Value() (driver.Value, error) {
+	if !k.valid {
+		return nil, nil
+	}
+	return string(k.b), nil
+}
+
+func (k *pgXML) bytes() ([]byte, error) {
+	if !k.valid {
+		return nullBytes, nil
+	}
+	return k.b, nil
+}
+
+func (k *pgXML) String() string {
+	if !k.valid {
+		return ""
+	}
+	return string(k.b)
+}
+
+func (k *pgXML) Val() interface{} {
+	if !k.valid {
+		return nil
+	}
+	return string(k.b)
+}
+
+func (k *pgXML) ValOr(fallback interface{}) interface{} {
+	if k.IsNull() {
+		return fallback
+	}
+	return k.Val()
+}